@@ -0,0 +1,206 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/FacuBar/bookstore_oauth-api/migration"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/infraestructure/cache"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/infraestructure/clients"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/infraestructure/config"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/infraestructure/jwt"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/infraestructure/repositories"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/infraestructure/repositories/memory"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/infraestructure/repositories/postgres"
+)
+
+// runCommand runs one of the admin commands instead of the server
+func runCommand(cfg *config.Config, db *sql.DB, args []string) error {
+	switch args[0] {
+	case "rotate-keys":
+		if err := newKeyManager(cfg.JWT, db).Rotate(); err != nil {
+			return errors.New(err.Message())
+		}
+		log.Println("signing keys rotated")
+		return nil
+
+	case "dead-letters":
+		return runDeadLetters(cfg.RabbitMQ.URI, args[1:])
+
+	case "migrate":
+		return runMigrate(db, args[1:])
+
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// runMigrate applies, reverts or lists the embedded schema migrations:
+// migrate up|down [steps]|status. down reverts one migration unless told
+// otherwise.
+func runMigrate(db *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate up|down [steps]|status")
+	}
+
+	migrator := repositories.NewMigrator(db, migration.Files)
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		if err != nil {
+			return err
+		}
+		log.Printf("%d migrations applied", applied)
+		return nil
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			s, err := strconv.Atoi(args[1])
+			if err != nil || s <= 0 {
+				return fmt.Errorf("invalid steps %q", args[1])
+			}
+			steps = s
+		}
+		reverted, err := migrator.Down(steps)
+		if err != nil {
+			return err
+		}
+		log.Printf("%d migrations reverted", reverted)
+		return nil
+
+	case "status":
+		migrations, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			state := "pending"
+			switch {
+			case m.Dirty:
+				state = "dirty"
+			case m.Applied:
+				state = "applied"
+			}
+			fmt.Printf("%06d\t%s\t%s\n", m.Version, m.Name, state)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+}
+
+// runDeadLetters lists or replays the users events that couldn't be
+// handled: dead-letters list|replay [limit]
+func runDeadLetters(uri string, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: dead-letters list|replay [limit]")
+	}
+
+	limit := 100
+	if len(args) > 1 {
+		l, err := strconv.Atoi(args[1])
+		if err != nil || l <= 0 {
+			return fmt.Errorf("invalid limit %q", args[1])
+		}
+		limit = l
+	}
+
+	switch args[0] {
+	case "list":
+		letters, err := clients.ListDeadLetters(uri, limit)
+		if err != nil {
+			return err
+		}
+		for _, l := range letters {
+			fmt.Printf("%s\tuser %d\tretries %d\t%s\n", l.RoutingKey, l.UserId, l.Retries, l.Reason)
+		}
+		log.Printf("%d dead-lettered events", len(letters))
+		return nil
+
+	case "replay":
+		replayed, err := clients.ReplayDeadLetters(uri, limit)
+		if err != nil {
+			return err
+		}
+		log.Printf("%d dead-lettered events replayed", replayed)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown dead-letters command %q", args[0])
+	}
+}
+
+func newKeyManager(c config.JWT, db *sql.DB) *jwt.KeyManager {
+	return jwt.NewKeyManager(
+		repositories.NewSigningKeyRepository(db),
+		c.SigningAlg,
+		c.KeyRetireAfter,
+	)
+}
+
+// newCacheStore returns where access tokens are cached, Redis when its
+// address is set and an in process LRU otherwise. The cache is off when
+// its ttl is 0.
+func newCacheStore(c config.Cache) cache.Store {
+	if c.TTL <= 0 {
+		return nil
+	}
+	if c.RedisAddr != "" {
+		return cache.NewRedis(c.RedisAddr, c.RedisPassword)
+	}
+	log.Printf("caching tokens in process, revoked tokens stay valid on other replicas for up to %v, set REDIS_ADDR before running more than one", c.TTL)
+	return cache.NewLRU(c.Size)
+}
+
+// storage holds the repositories that can live in another backend, clients,
+// sessions and signing keys are always kept in MySQL so it's required with
+// every backend
+type storage struct {
+	accessTokens ports.AccessTokenRepository
+	users        ports.UsersRepository
+	outbox       ports.OutboxRepository
+	// ping is nil for backends without a connection to check
+	ping func() bool
+}
+
+// newStorage returns the repositories of the configured backend
+func newStorage(c config.Storage, db *sql.DB) (storage, error) {
+	switch c.Backend {
+	case "mysql":
+		return storage{
+			accessTokens: repositories.NewAccessTokenRepository(db),
+			users:        repositories.NewUsersRepository(db),
+			outbox:       repositories.NewOutboxRepository(db),
+		}, nil
+	case "postgres":
+		pg, err := sql.Open("postgres", c.PostgresDSN)
+		if err != nil {
+			return storage{}, fmt.Errorf("postgres: %w, the binary must be built with -tags postgres", err)
+		}
+		if _, err := pg.Exec(postgres.Schema); err != nil {
+			return storage{}, fmt.Errorf("postgres schema: %w", err)
+		}
+		return storage{
+			accessTokens: postgres.NewAccessTokenRepository(pg),
+			users:        postgres.NewUsersRepository(pg),
+			outbox:       postgres.NewOutboxRepository(pg),
+			ping:         func() bool { return pg.Ping() == nil },
+		}, nil
+	case "memory":
+		log.Println("using the memory storage backend, tokens and users are lost on restart")
+		store := memory.NewStore()
+		return storage{
+			accessTokens: memory.NewAccessTokenRepository(store),
+			users:        memory.NewUsersRepository(store),
+			outbox:       memory.NewOutboxRepository(store),
+		}, nil
+	default:
+		return storage{}, fmt.Errorf("unknown storage backend %q", c.Backend)
+	}
+}
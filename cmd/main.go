@@ -8,47 +8,166 @@ import (
 	"os/signal"
 	"time"
 
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
 	"github.com/FacuBar/bookstore_oauth-api/pkg/core/services"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/infraestructure/cache"
 	"github.com/FacuBar/bookstore_oauth-api/pkg/infraestructure/clients"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/infraestructure/config"
 	oauth_grpc "github.com/FacuBar/bookstore_oauth-api/pkg/infraestructure/http/grpc/oauth"
 	"github.com/FacuBar/bookstore_oauth-api/pkg/infraestructure/http/rest"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/infraestructure/policy"
 	"github.com/FacuBar/bookstore_oauth-api/pkg/infraestructure/repositories"
 	"github.com/joho/godotenv"
 )
 
 func main() {
-	err := godotenv.Load()
+	// a .env file is optional, its variables don't override the ones
+	// already set
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		log.Fatalf("couldn't read .env: %v", err)
+	}
+
+	cfg, args, err := config.Load(os.Args[1:])
 	if err != nil {
-		panic("Error loading .env file")
+		log.Fatal(err)
 	}
 
-	db := clients.ConnectDB()
+	// MySQL is needed whatever the storage backend, clients, sessions and
+	// signing keys are only kept there
+	db := clients.ConnectDB(cfg.MySQL)
 	defer db.Close()
 
-	ur := repositories.NewUsersRepository(db)
+	if len(args) > 0 {
+		if err := runCommand(cfg, db, args); err != nil {
+			log.Fatalf("%s: %v", args[0], err)
+		}
+		return
+	}
+
+	// replicas starting together wait on each other, only the first one
+	// applies the migrations
+	if cfg.Migrate.OnStart {
+		if err := runMigrate(db, []string{"up"}); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+	}
+
+	store, err := newStorage(cfg.Storage, db)
+	if err != nil {
+		log.Fatalf("storage error: %v", err)
+	}
+
+	ur := store.users
 	us := services.NewUsersService(ur)
 
-	atr := repositories.NewAccessTokenRepository(db, &http.Client{})
-	ats := services.NewAccessTokenService(atr, us)
+	cr := repositories.NewClientRepository(db)
+	sr := repositories.NewSessionRepository(db)
 
-	router := rest.Handler(ats)
-	srv := http.Server{
-		Handler: router,
-		Addr:    os.Getenv("PORT"),
+	// signing keys are always needed for id tokens, access tokens are only
+	// signed with them when TOKEN_FORMAT is jwt
+	km := newKeyManager(cfg.JWT, db)
+	// a key from a file is kept as the first key so the tokens it
+	// signed before keys were rotated stay valid
+	if path := cfg.JWT.SigningKey; path != "" {
+		if err := km.Import(path); err != nil {
+			log.Fatalf("couldn't import jwt signing key, err: %v", err.Message())
+		}
+	}
+	stopKeys := km.Start(cfg.JWT.KeyRotationInterval, time.Minute)
+	defer stopKeys()
+
+	// a JWT can't outlive the key that signed it, keys stop verifying
+	// tokens KeyRetireAfter after they are rotated out
+	var maxLifetime time.Duration
+	if cfg.Tokens.Format == domain.TokenFormatJWT {
+		maxLifetime = cfg.JWT.KeyRetireAfter
+	}
+	lifetimes := policy.NewLifetimePolicy(cfg.Tokens.LifetimesFile, maxLifetime)
+	if err := lifetimes.Load(); err != nil {
+		log.Fatalf("couldn't load token lifetimes, err: %v", err.Message())
+	}
+	stopLifetimes := lifetimes.Start(cfg.Tokens.LifetimesReloadInterval)
+	defer stopLifetimes()
+
+	atr := store.accessTokens
+	if store := newCacheStore(cfg.Cache); store != nil {
+		atr = cache.NewAccessTokenRepository(atr, store, cache.AccessTokenConfig{
+			TTL:         cfg.Cache.TTL,
+			NegativeTTL: cfg.Cache.NegativeTTL,
+		})
 	}
+	ats := services.NewAccessTokenService(atr, us, cr, sr, clients.NewUsersAPIClient(cfg.UsersAPI), km, services.AccessTokenConfig{
+		TokenFormat:  cfg.Tokens.Format,
+		Issuer:       cfg.HTTP.Issuer,
+		RoleScopes:   cfg.Tokens.RoleScopes,
+		SessionLimit: cfg.Tokens.SessionLimit,
+
+		IdleTimeout:             cfg.Tokens.IdleTimeout,
+		MaxLifetime:             cfg.Tokens.MaxLifetime,
+		ExpirationWriteInterval: cfg.Tokens.ExpiresWriteInterval,
+
+		Lifetimes:   lifetimes,
+		LifetimeCap: maxLifetime,
+	})
 
-	_, err = clients.NewRabbitMQ(os.Getenv("RMQ_URI"), ur)
+	rmq, err := clients.NewRabbitMQ(
+		cfg.RabbitMQ.URI,
+		cfg.RabbitMQ.RetryDelays,
+		ur,
+		ats,
+	)
 	if err != nil {
 		log.Fatalf("rabitmq error: %v\n", err)
 	}
 
+	// events are written to the outbox along with the tokens, the relay
+	// publishes them whenever the broker is reachable
+	relay := clients.NewOAuthEventRelay(cfg.RabbitMQ.URI, store.outbox)
+	stopRelay := relay.Start(cfg.RabbitMQ.EventsRelayInterval)
+	defer stopRelay()
+
+	// expired rows only pile up in mysql, the lock makes a single replica
+	// purge them
+	if cfg.Storage.Backend == "mysql" && cfg.Janitor.Interval > 0 {
+		janitor := repositories.NewJanitor(db, cfg.Janitor.BatchSize)
+		stopJanitor := janitor.Start(cfg.Janitor.Interval)
+		defer stopJanitor()
+	}
+
+	checks := map[string]func() bool{
+		"mysql":    func() bool { return db.Ping() == nil },
+		"rabbitmq": rmq.Connected,
+	}
+	if store.ping != nil {
+		checks[cfg.Storage.Backend] = store.ping
+	}
+	router := rest.Handler(ats, cfg.HTTP.Issuer, checks)
+	srv := http.Server{
+		Handler: router,
+		Addr:    cfg.HTTP.Addr,
+	}
+
 	go func() {
 		if err = srv.ListenAndServe(); err != nil {
 			log.Fatalf("Error while serving: %v", err)
 		}
 	}()
 
-	OauthGrpcServer, err := oauth_grpc.NewGRPCServer(os.Getenv("GRPC_SERVER"), ats)
+	// metrics get their own listener so they aren't served with the api
+	var admin *http.Server
+	if cfg.HTTP.AdminAddr != "" {
+		admin = &http.Server{
+			Handler: rest.AdminHandler(),
+			Addr:    cfg.HTTP.AdminAddr,
+		}
+		go func() {
+			if err := admin.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Error while serving metrics: %v", err)
+			}
+		}()
+	}
+
+	OauthGrpcServer, err := oauth_grpc.NewGRPCServer(cfg.GRPC.Addr, ats)
 	if err != nil {
 		log.Fatalf("couldn't serve grpc server, err: %v", err)
 	}
@@ -63,12 +182,20 @@ func main() {
 		5*time.Second)
 	defer cancel()
 
+	// the users events already delivered are handled before exiting
+	if err := rmq.Close(ctx); err != nil {
+		log.Printf("rabbitmq didn't drain in time: %v", err)
+	}
+
 	go OauthGrpcServer.GracefulStop()
 	go func() {
 		if err := srv.Shutdown(ctx); err != nil {
 			log.Fatal("Server Shutdown:", err)
 		}
 	}()
+	if admin != nil {
+		go admin.Shutdown(ctx)
+	}
 
 	log.Print("Server exiting")
 }
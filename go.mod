@@ -6,13 +6,16 @@ require (
 	github.com/DATA-DOG/go-sqlmock v1.5.0
 	github.com/FacuBar/bookstore_utils-go v0.0.0-20211113145944-498ad1b78ccf
 	github.com/gin-gonic/gin v1.7.4
+	github.com/go-redis/redis/v7 v7.4.1
 	github.com/go-sql-driver/mysql v1.6.0
 	github.com/golang/protobuf v1.4.3
 	github.com/joho/godotenv v1.4.0
+	github.com/lib/pq v1.10.9
 	github.com/satori/go.uuid v1.2.0
 	github.com/streadway/amqp v1.0.0
 	github.com/stretchr/testify v1.7.0
 	google.golang.org/grpc v1.42.0
+	gopkg.in/yaml.v2 v2.2.8
 )
 
 require (
@@ -35,6 +38,5 @@ require (
 	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013 // indirect
 	google.golang.org/protobuf v1.25.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
-	gopkg.in/yaml.v2 v2.2.8 // indirect
 	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
 )
@@ -1,2 +1,2 @@
-DROP TABLE IF EXISTS `access_tokens`
+DROP TABLE IF EXISTS `access_tokens`;
 DROP TABLE IF EXISTS `users`
\ No newline at end of file
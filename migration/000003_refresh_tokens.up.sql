@@ -0,0 +1,11 @@
+CREATE TABLE `refresh_tokens` (
+  `refresh_token` varchar(255) PRIMARY KEY NOT NULL,
+  `family_id` varchar(255) NOT NULL,
+  `access_token` varchar(255) NOT NULL,
+  `user_id` bigint NOT NULL,
+  `user_role` varchar(255) NOT NULL,
+  `expires` bigint NOT NULL,
+  `used` boolean NOT NULL DEFAULT false
+);
+
+CREATE INDEX `refresh_tokens_index_0` ON `refresh_tokens` (`family_id`);
@@ -0,0 +1,3 @@
+ALTER TABLE `access_tokens` DROP COLUMN `client_id`;
+
+DROP TABLE IF EXISTS `oauth_clients`
@@ -0,0 +1,9 @@
+CREATE TABLE `oauth_clients` (
+  `client_id` varchar(255) PRIMARY KEY NOT NULL,
+  `client_secret` varchar(255) NOT NULL,
+  `grant_types` varchar(255) NOT NULL,
+  `scopes` varchar(1024) NOT NULL DEFAULT '',
+  `access_token_ttl` bigint NOT NULL DEFAULT 0
+);
+
+ALTER TABLE `access_tokens` ADD COLUMN `client_id` varchar(255) NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS `authorization_codes`;
+
+ALTER TABLE `refresh_tokens` DROP COLUMN `client_id`;
+
+ALTER TABLE `oauth_clients` DROP COLUMN `redirect_uris`;
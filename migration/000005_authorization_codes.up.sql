@@ -0,0 +1,15 @@
+ALTER TABLE `oauth_clients` ADD COLUMN `redirect_uris` varchar(2048) NOT NULL DEFAULT '';
+
+ALTER TABLE `refresh_tokens` ADD COLUMN `client_id` varchar(255) NOT NULL DEFAULT '';
+
+CREATE TABLE `authorization_codes` (
+  `code` varchar(255) PRIMARY KEY NOT NULL,
+  `client_id` varchar(255) NOT NULL,
+  `redirect_uri` varchar(2048) NOT NULL,
+  `code_challenge` varchar(255) NOT NULL,
+  `code_challenge_method` varchar(16) NOT NULL,
+  `user_id` bigint NOT NULL,
+  `user_role` varchar(255) NOT NULL,
+  `expires` bigint NOT NULL,
+  `used` boolean NOT NULL DEFAULT false
+);
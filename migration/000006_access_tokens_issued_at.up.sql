@@ -0,0 +1 @@
+ALTER TABLE `access_tokens` ADD COLUMN `issued_at` bigint NOT NULL DEFAULT 0;
@@ -0,0 +1,10 @@
+CREATE TABLE `signing_keys` (
+  `kid` varchar(255) PRIMARY KEY NOT NULL,
+  `algorithm` varchar(16) NOT NULL,
+  `private_key` text NOT NULL,
+  `state` varchar(16) NOT NULL,
+  `created_at` bigint NOT NULL,
+  `state_changed_at` bigint NOT NULL
+);
+
+CREATE INDEX `signing_keys_index_0` ON `signing_keys` (`state`);
@@ -0,0 +1,3 @@
+ALTER TABLE `authorization_codes` ADD COLUMN `scope` varchar(1024) NOT NULL DEFAULT '';
+
+ALTER TABLE `authorization_codes` ADD COLUMN `nonce` varchar(255) NOT NULL DEFAULT '';
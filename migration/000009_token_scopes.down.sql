@@ -0,0 +1,3 @@
+ALTER TABLE `refresh_tokens` DROP COLUMN `scopes`;
+
+ALTER TABLE `access_tokens` DROP COLUMN `scopes`;
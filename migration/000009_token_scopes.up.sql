@@ -0,0 +1,3 @@
+ALTER TABLE `access_tokens` ADD COLUMN `scopes` varchar(1024) NOT NULL DEFAULT '';
+
+ALTER TABLE `refresh_tokens` ADD COLUMN `scopes` varchar(1024) NOT NULL DEFAULT '';
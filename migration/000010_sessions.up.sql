@@ -0,0 +1,11 @@
+CREATE TABLE `sessions` (
+  `id` varchar(255) PRIMARY KEY NOT NULL,
+  `user_id` bigint NOT NULL,
+  `client_id` varchar(255) NOT NULL DEFAULT '',
+  `user_agent` varchar(512) NOT NULL DEFAULT '',
+  `ip` varchar(64) NOT NULL DEFAULT '',
+  `created_at` bigint NOT NULL,
+  `last_used_at` bigint NOT NULL
+);
+
+CREATE INDEX `sessions_index_0` ON `sessions` (`user_id`, `created_at`);
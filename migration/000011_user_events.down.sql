@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS `user_versions`;
+
+DROP TABLE IF EXISTS `user_events`
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE TABLE `user_events` (
+  `event_id` varchar(255) PRIMARY KEY NOT NULL,
+  `user_id` bigint NOT NULL,
+  `processed_at` bigint NOT NULL
+);
+
+CREATE INDEX `user_events_index_0` ON `user_events` (`processed_at`);
+
+CREATE TABLE `user_versions` (
+  `user_id` bigint PRIMARY KEY NOT NULL,
+  `version` bigint NOT NULL
+);
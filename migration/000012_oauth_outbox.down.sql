@@ -0,0 +1 @@
+DROP TABLE IF EXISTS `oauth_outbox`
\ No newline at end of file
@@ -0,0 +1,10 @@
+CREATE TABLE `oauth_outbox` (
+  `seq` bigint PRIMARY KEY AUTO_INCREMENT,
+  `id` varchar(255) UNIQUE NOT NULL,
+  `type` varchar(255) NOT NULL,
+  `payload` text NOT NULL,
+  `occurred_at` bigint NOT NULL,
+  `published_at` bigint
+);
+
+CREATE INDEX `oauth_outbox_index_0` ON `oauth_outbox` (`published_at`, `seq`);
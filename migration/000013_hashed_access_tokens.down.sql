@@ -0,0 +1,7 @@
+-- a hash can't be turned back into a token, the access tokens issued
+-- before the rollback are gone and their refresh tokens have to be used.
+-- Refresh tokens can't point to them by their hash anymore, the link is
+-- cleared so they point to no token at all.
+DELETE FROM `access_tokens` WHERE CHAR_LENGTH(`access_token`) = 64;
+
+UPDATE `refresh_tokens` SET `access_token` = '' WHERE CHAR_LENGTH(`access_token`) = 64
\ No newline at end of file
@@ -0,0 +1,6 @@
+-- tokens are stored as the hex SHA-256 of their value, tokens already issued
+-- are hashed in place so they stay valid. A hash is 64 characters long and a
+-- token 36, so rows that are already hashed are left alone.
+UPDATE `access_tokens` SET `access_token` = SHA2(`access_token`, 256) WHERE CHAR_LENGTH(`access_token`) <> 64;
+
+UPDATE `refresh_tokens` SET `access_token` = SHA2(`access_token`, 256) WHERE CHAR_LENGTH(`access_token`) <> 64;
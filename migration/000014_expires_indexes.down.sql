@@ -0,0 +1,5 @@
+DROP INDEX `access_tokens_index_2` ON `access_tokens`;
+
+DROP INDEX `refresh_tokens_index_2` ON `refresh_tokens`;
+
+DROP INDEX `authorization_codes_index_0` ON `authorization_codes`
\ No newline at end of file
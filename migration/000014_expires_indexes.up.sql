@@ -0,0 +1,5 @@
+CREATE INDEX `access_tokens_index_2` ON `access_tokens` (`expires`);
+
+CREATE INDEX `refresh_tokens_index_2` ON `refresh_tokens` (`expires`);
+
+CREATE INDEX `authorization_codes_index_0` ON `authorization_codes` (`expires`);
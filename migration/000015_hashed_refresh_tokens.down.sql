@@ -0,0 +1,3 @@
+-- a hash can't be turned back into a token, the refresh tokens issued
+-- before the rollback are gone and their users have to log in again
+DELETE FROM `refresh_tokens` WHERE CHAR_LENGTH(`refresh_token`) = 64
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- refresh tokens are stored hashed the same way access tokens are, the ones
+-- already issued are hashed in place so they stay valid
+UPDATE `refresh_tokens` SET `refresh_token` = SHA2(`refresh_token`, 256) WHERE CHAR_LENGTH(`refresh_token`) <> 64;
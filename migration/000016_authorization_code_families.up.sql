@@ -0,0 +1,5 @@
+ALTER TABLE `authorization_codes` ADD COLUMN `family_id` varchar(255) NOT NULL DEFAULT '';
+
+-- codes issued before have no family to start, they live for minutes so
+-- the logins still in flight are simply asked to start over
+DELETE FROM `authorization_codes` WHERE `family_id` = '';
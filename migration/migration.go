@@ -0,0 +1,9 @@
+// Package migration embeds the MySQL schema migrations in the binary. Each
+// version has a NNNNNN_name.up.sql and a NNNNNN_name.down.sql file, versions
+// are applied in order and don't need to be contiguous.
+package migration
+
+import "embed"
+
+//go:embed *.sql
+var Files embed.FS
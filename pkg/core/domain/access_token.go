@@ -1,11 +1,49 @@
 package domain
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
 type AccessToken struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IdToken      string `json:"id_token,omitempty"`
+	TokenType    string `json:"token_type"`
 
-	Expires int64 `json:"expires"`
+	Expires  int64 `json:"expires"`
+	IssuedAt int64 `json:"issued_at"`
 
 	UserId   int64  `json:"user_id"`
 	UserRole string `json:"user_role"`
+
+	// ClientId is the client the token was issued to, tokens a client got
+	// on its own behalf have no UserId and password grant tokens have no
+	// ClientId
+	ClientId string `json:"client_id,omitempty"`
+
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// HasScopes tells whether the token was granted every one of scopes
+func (at *AccessToken) HasScopes(scopes ...string) bool {
+	return IncludesScopes(at.Scopes, scopes...)
+}
+
+func (at *AccessToken) IsClientToken() bool {
+	return at.UserId == 0 && at.ClientId != ""
+}
+
+// HashAccessToken is what is stored in place of an access token, and of a
+// refresh token. Tokens are random, so a plain SHA-256 is as good as a keyed
+// hash and lets the tokens stored before they were hashed be hashed by a
+// migration.
+func HashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,46 @@
+package domain
+
+const (
+	CodeChallengeMethodS256 = "S256"
+
+	// ScopeOpenId asks for an id token along with the access token
+	ScopeOpenId = "openid"
+)
+
+// AuthorizationRequest holds the parameters a client sends to the
+// authorization endpoint, they are carried through the login form
+type AuthorizationRequest struct {
+	ResponseType        string `form:"response_type"`
+	ClientId            string `form:"client_id"`
+	RedirectUri         string `form:"redirect_uri"`
+	State               string `form:"state"`
+	Scope               string `form:"scope"`
+	Nonce               string `form:"nonce"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+}
+
+type AuthorizationCode struct {
+	Code string `json:"code"`
+	// FamilyId names the login the code starts, the tokens exchanged for
+	// it and their session get it. It is drawn apart from the code, which
+	// must never be shown once it was used.
+	FamilyId    string `json:"family_id"`
+	ClientId    string `json:"client_id"`
+	RedirectUri string `json:"redirect_uri"`
+	Scope       string `json:"scope"`
+	Nonce       string `json:"nonce"`
+
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+
+	Expires int64 `json:"expires"`
+	Used    bool  `json:"used"`
+
+	UserId   int64  `json:"user_id"`
+	UserRole string `json:"user_role"`
+}
+
+func (ac *AuthorizationCode) HasScope(scope string) bool {
+	return IncludesScopes(ParseScopes(ac.Scope), scope)
+}
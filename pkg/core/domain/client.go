@@ -0,0 +1,51 @@
+package domain
+
+const (
+	GrantTypePassword          = "password"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeAuthorizationCode = "authorization_code"
+)
+
+// Client is a registered oauth client, either a backend service that gets
+// tokens on its own behalf or an app that gets them on behalf of a user
+// through the authorization code grant.
+type Client struct {
+	ClientId string `json:"client_id"`
+	// ClientSecret is the bcrypt hash of the secret, public clients such
+	// as browser apps can't keep one and have none
+	ClientSecret string `json:"-"`
+
+	Grants       []string `json:"grants"`
+	Scopes       []string `json:"scopes"`
+	RedirectUris []string `json:"redirect_uris"`
+
+	// AccessTokenTTL is the lifetime in seconds of the tokens issued to
+	// the client, zero means the service default
+	AccessTokenTTL int64 `json:"access_token_ttl"`
+}
+
+// IsPublic tells whether the client has no secret, public clients are
+// identified by their id alone and rely on PKCE to use their codes
+func (c *Client) IsPublic() bool {
+	return c.ClientSecret == ""
+}
+
+func (c *Client) AllowsGrant(grant string) bool {
+	for _, g := range c.Grants {
+		if g == grant {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsRedirectUri only accepts exact matches against the registered uris
+func (c *Client) AllowsRedirectUri(uri string) bool {
+	for _, u := range c.RedirectUris {
+		if u == uri {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package domain
+
+const (
+	TokenFormatOpaque = "opaque"
+	TokenFormatJWT    = "jwt"
+)
+
+// TokenClaims are the claims carried by self contained access tokens and
+// by id tokens. Id is the key an access token is stored under, id tokens
+// don't have one so they can't be used as access tokens.
+type TokenClaims struct {
+	Issuer   string `json:"iss,omitempty"`
+	Subject  string `json:"sub,omitempty"`
+	Audience string `json:"aud,omitempty"`
+
+	UserId   int64  `json:"user_id,omitempty"`
+	UserRole string `json:"role,omitempty"`
+	ClientId string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+
+	// id token only claims
+	Email string `json:"email,omitempty"`
+	Nonce string `json:"nonce,omitempty"`
+
+	Expires  int64  `json:"exp"`
+	IssuedAt int64  `json:"iat"`
+	Id       string `json:"jti,omitempty"`
+}
+
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+
+	// RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC keys
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
@@ -0,0 +1,35 @@
+package domain
+
+import "time"
+
+const (
+	OAuthEventTokenIssued  = "oauth.event.token_issued"
+	OAuthEventTokenRevoked = "oauth.event.token_revoked"
+	OAuthEventSessionEnded = "oauth.event.session_ended"
+)
+
+// Reasons why tokens are revoked and sessions are ended
+const (
+	OAuthEventReasonRevoked      = "revoked"
+	OAuthEventReasonReused       = "reused"
+	OAuthEventReasonSessionLimit = "session_limit"
+	OAuthEventReasonUserChanged  = "user_changed"
+)
+
+// OAuthEvent tells other services about logins and logouts, it's published
+// to the oauth exchange with its type as routing key. Tokens themselves are
+// never part of an event.
+type OAuthEvent struct {
+	Id         string    `json:"-"`
+	Type       string    `json:"-"`
+	OccurredAt time.Time `json:"-"`
+
+	UserId   int64  `json:"user_id,omitempty"`
+	ClientId string `json:"client_id,omitempty"`
+	// SessionId is empty for client tokens, and for events about every
+	// session of a user
+	SessionId string   `json:"session_id,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+	Expires   int64    `json:"expires,omitempty"`
+	Reason    string   `json:"reason,omitempty"`
+}
@@ -0,0 +1,17 @@
+package domain
+
+type RefreshToken struct {
+	RefreshToken string `json:"refresh_token"`
+	FamilyId     string `json:"family_id"`
+	AccessToken  string `json:"access_token"`
+
+	Expires int64 `json:"expires"`
+	Used    bool  `json:"used"`
+
+	UserId   int64  `json:"user_id"`
+	UserRole string `json:"user_role"`
+	ClientId string `json:"client_id"`
+
+	// Scopes are carried over to the tokens issued on refresh
+	Scopes []string `json:"scopes"`
+}
@@ -0,0 +1,43 @@
+package domain
+
+import "strings"
+
+// ScopeRevokeTokens is granted to trusted services, such as the ones
+// calling the RevokeToken rpc, to revoke tokens issued to any client
+const ScopeRevokeTokens = "oauth:revoke"
+
+// ParseScopes splits a space separated scope parameter, repeated scopes are
+// only kept once
+func ParseScopes(scope string) []string {
+	scopes := []string{}
+	seen := map[string]bool{}
+	for _, s := range strings.Fields(scope) {
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// FormatScopes joins scopes the way they are sent and stored
+func FormatScopes(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// IncludesScopes tells whether every one of required is in scopes
+func IncludesScopes(scopes []string, required ...string) bool {
+	for _, r := range required {
+		found := false
+		for _, s := range scopes {
+			if s == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
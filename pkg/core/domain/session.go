@@ -0,0 +1,21 @@
+package domain
+
+// Session is a login on a device, it lives as long as the refresh token
+// family started by that login and shares its id
+type Session struct {
+	Id       string `json:"id"`
+	UserId   int64  `json:"user_id"`
+	ClientId string `json:"client_id,omitempty"`
+
+	UserAgent string `json:"user_agent"`
+	Ip        string `json:"ip"`
+
+	CreatedAt  int64 `json:"created_at"`
+	LastUsedAt int64 `json:"last_used_at"`
+}
+
+// Device describes where a login comes from
+type Device struct {
+	UserAgent string
+	Ip        string
+}
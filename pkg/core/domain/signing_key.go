@@ -0,0 +1,25 @@
+package domain
+
+// A signing key is published as pending before it signs anything, signs
+// while active, and is still published while retiring so the tokens it
+// signed can be verified until they expire.
+const (
+	SigningKeyPending  = "pending"
+	SigningKeyActive   = "active"
+	SigningKeyRetiring = "retiring"
+	SigningKeyRetired  = "retired"
+)
+
+type SigningKey struct {
+	Kid       string `json:"kid"`
+	Algorithm string `json:"algorithm"`
+
+	// PEM encoded PKCS#8 private key
+	PrivateKey string `json:"-"`
+
+	State string `json:"state"`
+
+	CreatedAt int64 `json:"created_at"`
+	// StateChangedAt is when the key entered its current state
+	StateChangedAt int64 `json:"state_changed_at"`
+}
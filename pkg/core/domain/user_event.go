@@ -0,0 +1,32 @@
+package domain
+
+import "time"
+
+const (
+	UserEventRegister = "users.event.register"
+	UserEventUpdate   = "users.event.update"
+	UserEventDelete   = "users.event.delete"
+)
+
+// UserEvent is a change to a user published by the users service
+type UserEvent struct {
+	Id   string
+	Type string
+	// Version is the version of the event schema
+	Version    int
+	OccurredAt time.Time
+
+	// UserVersion grows with every change to the user, it orders the events
+	// of a user. Legacy events don't have one and are applied as they come.
+	UserVersion int64
+	User        User
+}
+
+// UserEventResult tells what applying a user event did
+type UserEventResult struct {
+	// Applied is false for events already applied and for events older
+	// than the last one applied to the user
+	Applied bool
+	// Previous is the user before the event, if it was replicated
+	Previous *User
+}
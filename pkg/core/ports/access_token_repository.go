@@ -5,11 +5,32 @@ import (
 	"github.com/FacuBar/bookstore_utils-go/rest_errors"
 )
 
+// AccessTokenRepository writes that take events add them to the outbox in
+// the same transaction as the write. Access and refresh tokens are only
+// kept hashed, they are still looked up and revoked by their value, but the
+// AccessToken of a refresh token is the hash of the token issued with it.
 type AccessTokenRepository interface {
 	// Db where access_tokens will be stored
-	Create(domain.AccessToken) rest_errors.RestErr
+	Create(domain.AccessToken, ...domain.OAuthEvent) rest_errors.RestErr
 	GetById(string) (*domain.AccessToken, rest_errors.RestErr)
+	DeleteById(string, ...domain.OAuthEvent) rest_errors.RestErr
+	// DeleteByUser deletes every access token, refresh token and unused
+	// authorization code of the user
+	DeleteByUser(int64, ...domain.OAuthEvent) rest_errors.RestErr
+	// UpdateExpirationTime only ever moves the expiration forward
+	UpdateExpirationTime(string, int64) rest_errors.RestErr
 
-	// Rest client that will interact with the users_api service
-	LoginUser(string, string) (*domain.User, rest_errors.RestErr)
+	// Db where refresh_tokens will be stored, tokens issued from the same
+	// login share a family so they can be revoked together. A refresh token
+	// is stored along with the access token issued with it, in the same
+	// transaction as its events.
+	CreateWithRefreshToken(domain.AccessToken, domain.RefreshToken, ...domain.OAuthEvent) rest_errors.RestErr
+	GetRefreshToken(string) (*domain.RefreshToken, rest_errors.RestErr)
+	UseRefreshToken(string) rest_errors.RestErr
+	RevokeRefreshTokenFamily(string, ...domain.OAuthEvent) rest_errors.RestErr
+
+	// Db where authorization codes will be stored, codes are single use
+	CreateAuthorizationCode(domain.AuthorizationCode) rest_errors.RestErr
+	GetAuthorizationCode(string) (*domain.AuthorizationCode, rest_errors.RestErr)
+	UseAuthorizationCode(string) rest_errors.RestErr
 }
@@ -6,7 +6,25 @@ import (
 )
 
 type AcessTokenService interface {
-	Create(string, string) (*domain.AccessToken, rest_errors.RestErr)
+	Create(string, string, string, domain.Device) (*domain.AccessToken, rest_errors.RestErr)
+	// Refresh takes the refresh token and the credentials of the client it
+	// was issued to, if any
+	Refresh(string, string, string) (*domain.AccessToken, rest_errors.RestErr)
+	CreateForClient(string, string, string) (*domain.AccessToken, rest_errors.RestErr)
+	// CreateFromAuthorizationCode takes the code, the redirect uri, the
+	// client id and secret and the PKCE code verifier
+	CreateFromAuthorizationCode(string, string, string, string, string, domain.Device) (*domain.AccessToken, rest_errors.RestErr)
+	ValidateAuthorizationRequest(domain.AuthorizationRequest) (*domain.Client, rest_errors.RestErr)
+	Authorize(domain.AuthorizationRequest, string, string) (*domain.AuthorizationCode, rest_errors.RestErr)
 	GetById(string) (*domain.AccessToken, rest_errors.RestErr)
-	// UpdateExpirationTime ()
+	// Revoke takes the token, its type hint and the credentials of the
+	// client it was issued to
+	Revoke(string, string, string, string) rest_errors.RestErr
+	RevokeUserTokens(int64) rest_errors.RestErr
+	Introspect(string, string, string) (*domain.TokenIntrospection, rest_errors.RestErr)
+	UserInfo(string) (*domain.UserInfo, rest_errors.RestErr)
+	GetSessions(string) ([]domain.Session, rest_errors.RestErr)
+	EndSession(string, string) rest_errors.RestErr
+	JWKS() domain.JSONWebKeySet
+	UpdateExpirationTime(*domain.AccessToken) rest_errors.RestErr
 }
@@ -0,0 +1,10 @@
+package ports
+
+import (
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+)
+
+type ClientRepository interface {
+	GetById(string) (*domain.Client, rest_errors.RestErr)
+}
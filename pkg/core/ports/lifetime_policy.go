@@ -0,0 +1,9 @@
+package ports
+
+import "time"
+
+type LifetimePolicy interface {
+	// AccessTokenLifetime returns the lifetime of the rule that best matches
+	// a new access token, false when no rule matches
+	AccessTokenLifetime(grantType string, clientId string, role string) (time.Duration, bool)
+}
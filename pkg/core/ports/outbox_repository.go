@@ -0,0 +1,26 @@
+package ports
+
+import (
+	"time"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+)
+
+// OutboxRepository holds the oauth events until they are published, events
+// are added to it by the writes they tell about
+type OutboxRepository interface {
+	// Pending returns up to limit events not yet published, oldest first
+	Pending(limit int) ([]domain.OAuthEvent, rest_errors.RestErr)
+	MarkPublished(ids []string) rest_errors.RestErr
+	// PurgePublished deletes up to limit events published before the time
+	// and returns how many it deleted
+	PurgePublished(before time.Time, limit int) (int64, rest_errors.RestErr)
+
+	// Lead tells whether this replica is the one relaying the events, only
+	// one relays at a time so every event is published once and in order.
+	// Replicas keep asking so one takes over when the leader goes away.
+	Lead() (bool, rest_errors.RestErr)
+	// Resign lets another replica lead right away
+	Resign()
+}
@@ -0,0 +1,16 @@
+package ports
+
+import (
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+)
+
+type SessionRepository interface {
+	Create(domain.Session) rest_errors.RestErr
+	GetById(string) (*domain.Session, rest_errors.RestErr)
+	// Every session of the user, oldest first
+	GetByUser(int64) ([]domain.Session, rest_errors.RestErr)
+	Touch(id string, at int64) rest_errors.RestErr
+	Delete(string) rest_errors.RestErr
+	DeleteByUser(int64) rest_errors.RestErr
+}
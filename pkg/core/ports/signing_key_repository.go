@@ -0,0 +1,15 @@
+package ports
+
+import (
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+)
+
+type SigningKeyRepository interface {
+	Create(domain.SigningKey) rest_errors.RestErr
+	// Every key that hasn't been retired yet
+	GetAll() ([]domain.SigningKey, rest_errors.RestErr)
+	// UpdateState moves the key from one state to another, it fails with a
+	// conflict when the key is no longer in the from state
+	UpdateState(kid string, from string, to string, at int64) rest_errors.RestErr
+}
@@ -0,0 +1,14 @@
+package ports
+
+import (
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+)
+
+type TokenSigner interface {
+	Sign(domain.TokenClaims) (string, rest_errors.RestErr)
+	// Verify checks the signature only, expiration is up to the caller
+	Verify(string) (*domain.TokenClaims, rest_errors.RestErr)
+	// Public keys that can verify the signed tokens
+	JWKS() domain.JSONWebKeySet
+}
@@ -7,5 +7,15 @@ import (
 
 type UsersRepository interface {
 	GetByEmail(string) (*domain.User, rest_errors.RestErr)
+	GetById(int64) (*domain.User, rest_errors.RestErr)
 	Save(*domain.User) rest_errors.RestErr
+	// Update stores the user as given, inserting it when it isn't stored
+	// yet since a replica may hear of a user first through an update
+	Update(*domain.User) rest_errors.RestErr
+	Delete(int64) rest_errors.RestErr
+	// Apply applies the event exactly once, and only if it's newer than the
+	// last event applied to the user. When the event applies, the func is
+	// called with the result before the event is recorded, if it fails
+	// nothing is and the event can be applied again.
+	Apply(*domain.UserEvent, func(*domain.UserEventResult) rest_errors.RestErr) (*domain.UserEventResult, rest_errors.RestErr)
 }
@@ -7,4 +7,5 @@ import (
 
 type UsersService interface {
 	Login(string, string) (*domain.User, rest_errors.RestErr)
+	GetById(int64) (*domain.User, rest_errors.RestErr)
 }
@@ -0,0 +1,13 @@
+package ports
+
+import (
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+)
+
+// UsersAPIClient logs users in through the users service, for the ones
+// whose replication hasn't arrived yet. It fails fast with a 503 while the
+// users service is down.
+type UsersAPIClient interface {
+	LoginUser(string, string) (*domain.User, rest_errors.RestErr)
+}
@@ -1,6 +1,11 @@
 package services
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -9,6 +14,7 @@ import (
 	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
 	"github.com/FacuBar/bookstore_utils-go/rest_errors"
 	uuid "github.com/satori/go.uuid"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -16,16 +22,62 @@ var (
 	instanceTokenService *accessTokenService
 )
 
+// AccessTokenConfig holds the settings of the access token service
+type AccessTokenConfig struct {
+	// TokenFormat is either domain.TokenFormatOpaque or domain.TokenFormatJWT
+	TokenFormat string
+	// Issuer identifies this service in the tokens it signs
+	Issuer string
+	// RoleScopes are the scopes users of each role may be granted
+	RoleScopes map[string][]string
+	// SessionLimit is how many sessions a user can have open at once, the
+	// oldest ones are ended to make room for new ones. Zero means no limit.
+	SessionLimit int
+
+	// IdleTimeout turns on sliding expiration for opaque access tokens,
+	// each use pushes the expiration to IdleTimeout from now. JWTs can't
+	// slide since their expiration is signed.
+	IdleTimeout time.Duration
+	// MaxLifetime caps how far from issue a token can slide, zero means
+	// no cap
+	MaxLifetime time.Duration
+	// ExpirationWriteInterval is how much the expiration has to move before
+	// it's written, so a token used on every request isn't written on every
+	// request
+	ExpirationWriteInterval time.Duration
+
+	// Lifetimes decides how long new access tokens live for clients with
+	// no ttl of their own, tokens it has no rule for get the default
+	Lifetimes ports.LifetimePolicy
+	// LifetimeCap caps the lifetime of new access tokens however it was
+	// resolved, zero means no cap
+	LifetimeCap time.Duration
+}
+
 type accessTokenService struct {
 	repo     ports.AccessTokenRepository
 	uservice ports.UsersService
+	crepo    ports.ClientRepository
+	srepo    ports.SessionRepository
+	// usersApi logs in users that aren't replicated yet
+	usersApi ports.UsersAPIClient
+
+	// signer signs ID tokens, and access tokens too when they are issued
+	// as JWTs. Without it neither kind of JWT is issued.
+	signer ports.TokenSigner
+	config AccessTokenConfig
 }
 
-func NewAccessTokenService(repo ports.AccessTokenRepository, servc ports.UsersService) ports.AcessTokenService {
+func NewAccessTokenService(repo ports.AccessTokenRepository, servc ports.UsersService, crepo ports.ClientRepository, srepo ports.SessionRepository, usersApi ports.UsersAPIClient, signer ports.TokenSigner, config AccessTokenConfig) ports.AcessTokenService {
 	onceTokenService.Do(func() {
 		instanceTokenService = &accessTokenService{
 			repo:     repo,
 			uservice: servc,
+			crepo:    crepo,
+			srepo:    srepo,
+			usersApi: usersApi,
+			signer:   signer,
+			config:   config,
 		}
 	})
 
@@ -33,43 +85,286 @@ func NewAccessTokenService(repo ports.AccessTokenRepository, servc ports.UsersSe
 }
 
 const (
-	expirationTime = 48
+	// expirationTime is the default lifetime of access tokens
+	expirationTime        = 48
+	refreshExpirationTime = 24 * 30
+
+	// authorization codes are exchanged right after the redirect, so
+	// they only need to live for a few minutes
+	authorizationCodeExpirationTime = 10
 )
 
-func (s *accessTokenService) Create(email string, password string) (*domain.AccessToken, rest_errors.RestErr) {
-	if strings.TrimSpace(email) == "" || strings.TrimSpace(password) == "" {
-		return nil, rest_errors.NewBadRequestError("not valid credentials")
+func (s *accessTokenService) Create(email string, password string, scope string, device domain.Device) (*domain.AccessToken, rest_errors.RestErr) {
+	user, err := s.login(email, password)
+	if err != nil {
+		return nil, err
 	}
 
-	var user *domain.User
-	var err rest_errors.RestErr
+	scopes, err := grantScopes(scope, s.config.RoleScopes[user.Role])
+	if err != nil {
+		return nil, err
+	}
 
-	user, err = s.uservice.Login(email, password)
+	// every login starts a new refresh token family, and with it a session
+	familyId := uuid.NewV4().String()
+	at, err := s.issue(domain.AccessToken{UserId: user.Id, UserRole: user.Role, Scopes: scopes}, domain.GrantTypePassword, familyId)
 	if err != nil {
-		if err.Message() != "user not registered" {
-			return nil, err
+		return nil, err
+	}
+
+	if err := s.startSession(familyId, at, device); err != nil {
+		return nil, err
+	}
+
+	return at, nil
+}
+
+// Refresh trades a refresh token for new tokens. Tokens issued to a client
+// can only be refreshed by it, tokens from the password grant belong to no
+// client and need no credentials.
+func (s *accessTokenService) Refresh(refreshToken string, clientId string, clientSecret string) (*domain.AccessToken, rest_errors.RestErr) {
+	refreshToken = strings.TrimSpace(refreshToken)
+	if len(refreshToken) == 0 {
+		return nil, rest_errors.NewBadRequestError("invalid refresh token")
+	}
+
+	rt, err := s.repo.GetRefreshToken(refreshToken)
+	if err != nil {
+		if err.Status() == http.StatusNotFound {
+			return nil, rest_errors.NewBadRequestError("invalid refresh token")
 		}
-		// in case replication of user is delayed, a call
-		// to the users microservice is done
-		user, err = s.repo.LoginUser(email, password)
+		return nil, err
+	}
+
+	if rt.ClientId != "" {
+		client, err := s.identifyClient(clientId, clientSecret)
 		if err != nil {
 			return nil, err
 		}
+		if client.ClientId != rt.ClientId {
+			return nil, rest_errors.NewBadRequestError("invalid refresh token")
+		}
+	}
+
+	// a refresh token is only valid once, if it shows up again it may have
+	// been stolen, so every token issued from the same login is revoked
+	if rt.Used {
+		return nil, s.revokeFamily(rt.FamilyId, rt.UserId, rt.ClientId, "invalid refresh token")
+	}
+
+	if time.Now().After(time.Unix(rt.Expires, 0)) {
+		return nil, rest_errors.NewBadRequestError("invalid refresh token")
+	}
+
+	if err := s.repo.UseRefreshToken(rt.RefreshToken); err != nil {
+		if err.Status() == http.StatusConflict {
+			return nil, s.revokeFamily(rt.FamilyId, rt.UserId, rt.ClientId, "invalid refresh token")
+		}
+		return nil, err
 	}
 
-	accestToken := domain.AccessToken{
-		UserId:      user.Id,
-		UserRole:    user.Role,
-		Expires:     time.Now().UTC().Add(expirationTime * time.Hour).Unix(),
+	if err := s.srepo.Touch(rt.FamilyId, time.Now().UTC().Unix()); err != nil {
+		return nil, err
+	}
+
+	return s.issue(domain.AccessToken{UserId: rt.UserId, UserRole: rt.UserRole, ClientId: rt.ClientId, Scopes: rt.Scopes}, domain.GrantTypeRefreshToken, rt.FamilyId)
+}
+
+func (s *accessTokenService) CreateForClient(clientId string, clientSecret string, scope string) (*domain.AccessToken, rest_errors.RestErr) {
+	client, err := s.authenticateClient(clientId, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.AllowsGrant(domain.GrantTypeClientCredentials) {
+		return nil, rest_errors.NewBadRequestError("grant_type not allowed for client")
+	}
+
+	scopes, err := grantScopes(scope, client.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := s.accessTokenLifetime(domain.GrantTypeClientCredentials, client.ClientId, "", time.Duration(client.AccessTokenTTL)*time.Second)
+
+	// client tokens carry no user and get no refresh token, the client
+	// can always ask for a new one with its own credentials
+	now := time.Now().UTC()
+	accessToken := domain.AccessToken{
+		ClientId:    client.ClientId,
+		Scopes:      scopes,
+		Expires:     now.Add(ttl).Unix(),
+		IssuedAt:    now.Unix(),
 		AccessToken: uuid.NewV4().String(),
 		TokenType:   "Bearer",
 	}
 
-	if err := s.repo.Create(accestToken); err != nil {
+	issued := newOAuthEvent(domain.OAuthEventTokenIssued)
+	issued.ClientId = client.ClientId
+	issued.Scopes = scopes
+	issued.Expires = accessToken.Expires
+
+	if err := s.repo.Create(accessToken, issued); err != nil {
+		return nil, err
+	}
+
+	if err := s.sign(&accessToken); err != nil {
+		return nil, err
+	}
+
+	return &accessToken, nil
+}
+
+// ValidateAuthorizationRequest checks the client and its redirect uri, it
+// must pass before anything is rendered or redirected to that uri
+func (s *accessTokenService) ValidateAuthorizationRequest(req domain.AuthorizationRequest) (*domain.Client, rest_errors.RestErr) {
+	if req.ResponseType != "code" {
+		return nil, rest_errors.NewBadRequestError("response_type not supported")
+	}
+
+	client, err := s.crepo.GetById(req.ClientId)
+	if err != nil {
+		if err.Status() == http.StatusNotFound {
+			return nil, rest_errors.NewBadRequestError("invalid client")
+		}
+		return nil, err
+	}
+
+	if !client.AllowsGrant(domain.GrantTypeAuthorizationCode) {
+		return nil, rest_errors.NewBadRequestError("grant_type not allowed for client")
+	}
+
+	if !client.AllowsRedirectUri(req.RedirectUri) {
+		return nil, rest_errors.NewBadRequestError("invalid redirect_uri")
+	}
+
+	// PKCE is mandatory, and only with S256 since plain gives no protection
+	// to browser clients
+	if req.CodeChallengeMethod != domain.CodeChallengeMethodS256 {
+		return nil, rest_errors.NewBadRequestError("code_challenge_method not supported")
+	}
+	if len(req.CodeChallenge) != 43 {
+		return nil, rest_errors.NewBadRequestError("invalid code_challenge")
+	}
+
+	// the user's role narrows the scopes further once they log in
+	allowed := append([]string{domain.ScopeOpenId}, client.Scopes...)
+	if !domain.IncludesScopes(allowed, domain.ParseScopes(req.Scope)...) {
+		return nil, rest_errors.NewBadRequestError("invalid scope")
+	}
+
+	return client, nil
+}
+
+func (s *accessTokenService) Authorize(req domain.AuthorizationRequest, email string, password string) (*domain.AuthorizationCode, rest_errors.RestErr) {
+	client, err := s.ValidateAuthorizationRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// the login form only tells a failed login apart from other errors, it
+	// doesn't say whether the email or the password was wrong
+	user, err := s.login(email, password)
+	if err != nil {
+		if err.Status() >= http.StatusInternalServerError {
+			return nil, err
+		}
+		return nil, rest_errors.NewUnauthorizedError("invalid email or password")
+	}
+
+	// a client acting for a user gets no more than what both of them are
+	// allowed, openid only asks for an id token so it's always allowed
+	allowed := []string{}
+	for _, scope := range client.Scopes {
+		if domain.IncludesScopes(s.config.RoleScopes[user.Role], scope) {
+			allowed = append(allowed, scope)
+		}
+	}
+	if domain.IncludesScopes(domain.ParseScopes(req.Scope), domain.ScopeOpenId) {
+		allowed = append(allowed, domain.ScopeOpenId)
+	}
+
+	scopes, err := grantScopes(req.Scope, allowed)
+	if err != nil {
+		return nil, err
+	}
+
+	ac := domain.AuthorizationCode{
+		Code:                uuid.NewV4().String(),
+		FamilyId:            uuid.NewV4().String(),
+		ClientId:            client.ClientId,
+		RedirectUri:         req.RedirectUri,
+		Scope:               domain.FormatScopes(scopes),
+		Nonce:               req.Nonce,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		UserId:              user.Id,
+		UserRole:            user.Role,
+		Expires:             time.Now().UTC().Add(authorizationCodeExpirationTime * time.Minute).Unix(),
+	}
+
+	if err := s.repo.CreateAuthorizationCode(ac); err != nil {
 		return nil, err
 	}
 
-	return &accestToken, nil
+	return &ac, nil
+}
+
+func (s *accessTokenService) CreateFromAuthorizationCode(code string, redirectUri string, clientId string, clientSecret string, codeVerifier string, device domain.Device) (*domain.AccessToken, rest_errors.RestErr) {
+	client, err := s.identifyClient(clientId, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == 0 {
+		return nil, rest_errors.NewBadRequestError("invalid authorization code")
+	}
+
+	ac, err := s.repo.GetAuthorizationCode(code)
+	if err != nil {
+		if err.Status() == http.StatusNotFound {
+			return nil, rest_errors.NewBadRequestError("invalid authorization code")
+		}
+		return nil, err
+	}
+
+	// the tokens issued from a code belong to the family stored with it, so
+	// a replayed code revokes whatever was issued the first time
+	if ac.Used {
+		return nil, s.revokeFamily(ac.FamilyId, ac.UserId, ac.ClientId, "invalid authorization code")
+	}
+
+	if time.Now().After(time.Unix(ac.Expires, 0)) ||
+		ac.ClientId != client.ClientId ||
+		ac.RedirectUri != redirectUri ||
+		!verifyCodeChallenge(ac.CodeChallenge, codeVerifier) {
+		return nil, rest_errors.NewBadRequestError("invalid authorization code")
+	}
+
+	if err := s.repo.UseAuthorizationCode(ac.Code); err != nil {
+		if err.Status() == http.StatusConflict {
+			return nil, s.revokeFamily(ac.FamilyId, ac.UserId, ac.ClientId, "invalid authorization code")
+		}
+		return nil, err
+	}
+
+	at, err := s.issue(domain.AccessToken{UserId: ac.UserId, UserRole: ac.UserRole, ClientId: ac.ClientId, Scopes: domain.ParseScopes(ac.Scope)}, domain.GrantTypeAuthorizationCode, ac.FamilyId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.startSession(ac.FamilyId, at, device); err != nil {
+		return nil, err
+	}
+
+	if ac.HasScope(domain.ScopeOpenId) {
+		if err := s.signIdToken(at, ac.Nonce); err != nil {
+			return nil, err
+		}
+	}
+
+	return at, nil
 }
 
 func (s *accessTokenService) GetById(id string) (*domain.AccessToken, rest_errors.RestErr) {
@@ -78,6 +373,43 @@ func (s *accessTokenService) GetById(id string) (*domain.AccessToken, rest_error
 		return nil, rest_errors.NewBadRequestError("invalid access token id")
 	}
 
+	// JWTs are verified locally, then looked up by their jti so the ones
+	// revoked before they expire are rejected
+	if s.isJWT(id) {
+		claims, err := s.signer.Verify(id)
+		if err != nil {
+			return nil, err
+		}
+
+		// ID tokens are signed with the same keys but carry no jti, they
+		// are meant for the client and can't be used as access tokens
+		if claims.Id == "" {
+			return nil, rest_errors.NewUnauthorizedError("invalid access token")
+		}
+
+		if time.Now().After(time.Unix(claims.Expires, 0)) {
+			return nil, rest_errors.NewUnauthorizedError("Token expired")
+		}
+
+		if _, err := s.repo.GetById(claims.Id); err != nil {
+			if err.Status() == http.StatusNotFound {
+				return nil, rest_errors.NewUnauthorizedError("invalid access token")
+			}
+			return nil, err
+		}
+
+		return &domain.AccessToken{
+			AccessToken: id,
+			TokenType:   "Bearer",
+			Expires:     claims.Expires,
+			IssuedAt:    claims.IssuedAt,
+			UserId:      claims.UserId,
+			UserRole:    claims.UserRole,
+			ClientId:    claims.ClientId,
+			Scopes:      domain.ParseScopes(claims.Scope),
+		}, nil
+	}
+
 	accessToken, err := s.repo.GetById(id)
 	if err != nil {
 		return nil, err
@@ -87,5 +419,528 @@ func (s *accessTokenService) GetById(id string) (*domain.AccessToken, rest_error
 		return nil, rest_errors.NewUnauthorizedError("Token expired")
 	}
 
+	if err := s.UpdateExpirationTime(accessToken); err != nil {
+		return nil, err
+	}
+
 	return accessToken, nil
 }
+
+// UpdateExpirationTime slides the expiration of an opaque access token that
+// was just used, it does nothing unless sliding expiration is on
+func (s *accessTokenService) UpdateExpirationTime(at *domain.AccessToken) rest_errors.RestErr {
+	if s.config.IdleTimeout <= 0 || s.isJWT(at.AccessToken) {
+		return nil
+	}
+
+	expires := time.Now().UTC().Add(s.config.IdleTimeout).Unix()
+	if s.config.MaxLifetime > 0 {
+		if max := at.IssuedAt + int64(s.config.MaxLifetime/time.Second); expires > max {
+			expires = max
+		}
+	}
+
+	// the stored expiration tells when the token was last written, no
+	// need to keep any other state to throttle the writes
+	if expires <= at.Expires || expires-at.Expires < int64(s.config.ExpirationWriteInterval/time.Second) {
+		return nil
+	}
+
+	if err := s.repo.UpdateExpirationTime(at.AccessToken, expires); err != nil {
+		return err
+	}
+
+	at.Expires = expires
+	return nil
+}
+
+// Revoke revokes an access or a refresh token, revoking a refresh token
+// also revokes every token issued from the same login. A token issued to a
+// client can only be revoked by that client, public clients with their id
+// alone, or by a trusted client granted the revoke scope. Tokens issued to
+// no client, like the ones of the password grant, are revoked by anyone
+// presenting them. Unknown tokens are not an error, the caller only cares
+// about the token not being valid.
+func (s *accessTokenService) Revoke(token string, tokenTypeHint string, clientId string, clientSecret string) rest_errors.RestErr {
+	token = strings.TrimSpace(token)
+	if len(token) == 0 {
+		return rest_errors.NewBadRequestError("invalid token")
+	}
+
+	if s.isJWT(token) {
+		claims, err := s.signer.Verify(token)
+		if err != nil || claims.Id == "" {
+			// not one of our access tokens, so there's nothing to revoke
+			return nil
+		}
+		token = claims.Id
+	} else if tokenTypeHint != domain.TokenTypeHintAccessToken {
+		rt, err := s.repo.GetRefreshToken(token)
+		if err == nil {
+			if err := s.authorizeRevocation(rt.ClientId, clientId, clientSecret); err != nil {
+				return err
+			}
+			return s.endSession(rt.FamilyId, rt.UserId, rt.ClientId, domain.OAuthEventReasonRevoked)
+		}
+		if err.Status() != http.StatusNotFound {
+			return err
+		}
+	}
+
+	// the token is looked up first so that no event is published for
+	// tokens that were already gone
+	at, err := s.repo.GetById(token)
+	if err != nil {
+		if err.Status() == http.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+	if err := s.authorizeRevocation(at.ClientId, clientId, clientSecret); err != nil {
+		return err
+	}
+
+	revoked := newOAuthEvent(domain.OAuthEventTokenRevoked)
+	revoked.UserId = at.UserId
+	revoked.ClientId = at.ClientId
+	revoked.Reason = domain.OAuthEventReasonRevoked
+
+	return s.repo.DeleteById(at.AccessToken, revoked)
+}
+
+// RevokeUserTokens revokes every token of the user and ends all of their
+// sessions
+func (s *accessTokenService) RevokeUserTokens(userId int64) rest_errors.RestErr {
+	sessions, err := s.srepo.GetByUser(userId)
+	if err != nil {
+		return err
+	}
+
+	revoked := newOAuthEvent(domain.OAuthEventTokenRevoked)
+	revoked.UserId = userId
+	revoked.Reason = domain.OAuthEventReasonUserChanged
+
+	events := []domain.OAuthEvent{revoked}
+	for _, session := range sessions {
+		events = append(events, sessionEndedEvent(session.Id, userId, session.ClientId, domain.OAuthEventReasonUserChanged))
+	}
+
+	if err := s.repo.DeleteByUser(userId, events...); err != nil {
+		return err
+	}
+	return s.srepo.DeleteByUser(userId)
+}
+
+// Introspect describes the token to an authenticated client, any token that
+// can't be used right now is reported as inactive instead of as an error
+func (s *accessTokenService) Introspect(token string, clientId string, clientSecret string) (*domain.TokenIntrospection, rest_errors.RestErr) {
+	if _, err := s.authenticateClient(clientId, clientSecret); err != nil {
+		return nil, err
+	}
+
+	at, err := s.GetById(token)
+	if err != nil {
+		switch err.Status() {
+		case http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound:
+			return &domain.TokenIntrospection{Active: false}, nil
+		default:
+			return nil, err
+		}
+	}
+
+	introspection := domain.TokenIntrospection{
+		Active:    true,
+		Scope:     domain.FormatScopes(at.Scopes),
+		ClientId:  at.ClientId,
+		Sub:       at.ClientId,
+		Exp:       at.Expires,
+		Iat:       at.IssuedAt,
+		TokenType: "Bearer",
+	}
+	if !at.IsClientToken() {
+		introspection.Sub = strconv.FormatInt(at.UserId, 10)
+	}
+
+	return &introspection, nil
+}
+
+// UserInfo returns the claims of the user the access token was issued to,
+// tokens issued to a client on its own behalf have no user to describe
+func (s *accessTokenService) UserInfo(token string) (*domain.UserInfo, rest_errors.RestErr) {
+	at, err := s.userToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.uservice.GetById(at.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.UserInfo{
+		Sub:   strconv.FormatInt(user.Id, 10),
+		Email: user.Email,
+		Role:  user.Role,
+	}, nil
+}
+
+// GetSessions lists the sessions of the user the access token was issued to
+func (s *accessTokenService) GetSessions(token string) ([]domain.Session, rest_errors.RestErr) {
+	at, err := s.userToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.srepo.GetByUser(at.UserId)
+}
+
+// EndSession revokes every token of one of the sessions of the user the
+// access token was issued to, sessions of other users are reported as not
+// found
+func (s *accessTokenService) EndSession(token string, sessionId string) rest_errors.RestErr {
+	at, err := s.userToken(token)
+	if err != nil {
+		return err
+	}
+
+	session, err := s.srepo.GetById(sessionId)
+	if err != nil {
+		return err
+	}
+	if session.UserId != at.UserId {
+		return rest_errors.NewNotFoundError("session not found")
+	}
+
+	return s.endSession(session.Id, session.UserId, session.ClientId, domain.OAuthEventReasonRevoked)
+}
+
+// JWKS returns the keys that verify the JWTs signed by this service, the
+// set is empty when there is no signer
+func (s *accessTokenService) JWKS() domain.JSONWebKeySet {
+	if s.signer == nil {
+		return domain.JSONWebKeySet{Keys: []domain.JSONWebKey{}}
+	}
+	return s.signer.JWKS()
+}
+
+func (s *accessTokenService) login(email string, password string) (*domain.User, rest_errors.RestErr) {
+	if strings.TrimSpace(email) == "" || strings.TrimSpace(password) == "" {
+		return nil, rest_errors.NewBadRequestError("not valid credentials")
+	}
+
+	user, err := s.uservice.Login(email, password)
+	if err != nil {
+		if err.Message() != "user not registered" {
+			return nil, err
+		}
+		// in case replication of user is delayed, a call
+		// to the users microservice is done
+		user, err = s.usersApi.LoginUser(email, password)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// issue fills in at with a fresh access token and refresh token and
+// stores both, at must come with the subject of the token already set
+func (s *accessTokenService) issue(at domain.AccessToken, grantType string, familyId string) (*domain.AccessToken, rest_errors.RestErr) {
+	now := time.Now().UTC()
+
+	at.Expires = now.Add(s.accessTokenLifetime(grantType, at.ClientId, at.UserRole, 0)).Unix()
+	at.IssuedAt = now.Unix()
+	at.AccessToken = uuid.NewV4().String()
+	at.RefreshToken = uuid.NewV4().String()
+	at.TokenType = "Bearer"
+
+	refreshToken := domain.RefreshToken{
+		RefreshToken: at.RefreshToken,
+		FamilyId:     familyId,
+		AccessToken:  at.AccessToken,
+		UserId:       at.UserId,
+		UserRole:     at.UserRole,
+		ClientId:     at.ClientId,
+		Scopes:       at.Scopes,
+		Expires:      now.Add(refreshExpirationTime * time.Hour).Unix(),
+	}
+
+	issued := newOAuthEvent(domain.OAuthEventTokenIssued)
+	issued.UserId = at.UserId
+	issued.ClientId = at.ClientId
+	issued.SessionId = familyId
+	issued.Scopes = at.Scopes
+	issued.Expires = at.Expires
+
+	// both tokens are stored together, a grant that fails leaves nothing
+	// behind and publishes nothing
+	if err := s.repo.CreateWithRefreshToken(at, refreshToken, issued); err != nil {
+		return nil, err
+	}
+
+	if err := s.sign(&at); err != nil {
+		return nil, err
+	}
+
+	return &at, nil
+}
+
+// accessTokenLifetime resolves how long a new access token lives, clientTTL
+// is the ttl registered for the client if any. The ttl was set for that one
+// client so it wins over the policy, whose rules are meant for many. None
+// of them goes over the cap.
+func (s *accessTokenService) accessTokenLifetime(grantType string, clientId string, role string, clientTTL time.Duration) time.Duration {
+	lifetime := expirationTime * time.Hour
+	if clientTTL > 0 {
+		lifetime = clientTTL
+	} else if s.config.Lifetimes != nil {
+		if l, ok := s.config.Lifetimes.AccessTokenLifetime(grantType, clientId, role); ok {
+			lifetime = l
+		}
+	}
+	if s.config.LifetimeCap > 0 && lifetime > s.config.LifetimeCap {
+		lifetime = s.config.LifetimeCap
+	}
+	return lifetime
+}
+
+// sign swaps the stored id of at for a JWT carrying it as jti, the JWT is
+// what the client gets but the id is what the db knows about
+func (s *accessTokenService) sign(at *domain.AccessToken) rest_errors.RestErr {
+	if s.signer == nil || s.config.TokenFormat != domain.TokenFormatJWT {
+		return nil
+	}
+
+	claims := domain.TokenClaims{
+		Issuer:   s.config.Issuer,
+		Subject:  at.ClientId,
+		UserId:   at.UserId,
+		UserRole: at.UserRole,
+		ClientId: at.ClientId,
+		Scope:    domain.FormatScopes(at.Scopes),
+		Expires:  at.Expires,
+		IssuedAt: at.IssuedAt,
+		Id:       at.AccessToken,
+	}
+	if !at.IsClientToken() {
+		claims.Subject = strconv.FormatInt(at.UserId, 10)
+	}
+
+	token, err := s.signer.Sign(claims)
+	if err != nil {
+		return err
+	}
+
+	at.AccessToken = token
+	return nil
+}
+
+// signIdToken adds an ID token for the user of at, addressed to the client
+// it was issued to
+func (s *accessTokenService) signIdToken(at *domain.AccessToken, nonce string) rest_errors.RestErr {
+	if s.signer == nil {
+		return rest_errors.NewInternalServerError("id tokens can't be signed")
+	}
+
+	claims := domain.TokenClaims{
+		Issuer:   s.config.Issuer,
+		Subject:  strconv.FormatInt(at.UserId, 10),
+		Audience: at.ClientId,
+		UserId:   at.UserId,
+		UserRole: at.UserRole,
+		Nonce:    nonce,
+		Expires:  at.Expires,
+		IssuedAt: at.IssuedAt,
+	}
+
+	// the email is only known if the user has already been replicated
+	user, err := s.uservice.GetById(at.UserId)
+	if err != nil && err.Status() != http.StatusNotFound {
+		return err
+	}
+	if err == nil {
+		claims.Email = user.Email
+	}
+
+	token, err := s.signer.Sign(claims)
+	if err != nil {
+		return err
+	}
+
+	at.IdToken = token
+	return nil
+}
+
+func (s *accessTokenService) isJWT(token string) bool {
+	return s.signer != nil && strings.Count(token, ".") == 2
+}
+
+// authenticateClient only lets in confidential clients with their secret
+func (s *accessTokenService) authenticateClient(clientId string, clientSecret string) (*domain.Client, rest_errors.RestErr) {
+	client, err := s.identifyClient(clientId, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if client.IsPublic() {
+		return nil, rest_errors.NewUnauthorizedError("invalid client credentials")
+	}
+	return client, nil
+}
+
+// identifyClient is authenticateClient for the endpoints public clients
+// use too, they are taken at their word since they have no secret
+func (s *accessTokenService) identifyClient(clientId string, clientSecret string) (*domain.Client, rest_errors.RestErr) {
+	if strings.TrimSpace(clientId) == "" {
+		return nil, rest_errors.NewUnauthorizedError("invalid client credentials")
+	}
+
+	client, err := s.crepo.GetById(clientId)
+	if err != nil {
+		if err.Status() == http.StatusNotFound {
+			return nil, rest_errors.NewUnauthorizedError("invalid client credentials")
+		}
+		return nil, err
+	}
+
+	if client.IsPublic() {
+		return client, nil
+	}
+	if clientSecret == "" || bcrypt.CompareHashAndPassword([]byte(client.ClientSecret), []byte(clientSecret)) != nil {
+		return nil, rest_errors.NewUnauthorizedError("invalid client credentials")
+	}
+	return client, nil
+}
+
+// authorizeRevocation checks that the caller may revoke a token issued to
+// owner. Credentials are still checked when they are sent for a token of no
+// client, so a mistyped secret doesn't go unnoticed.
+func (s *accessTokenService) authorizeRevocation(owner string, clientId string, clientSecret string) rest_errors.RestErr {
+	if owner == "" && clientId == "" && clientSecret == "" {
+		return nil
+	}
+	client, err := s.identifyClient(clientId, clientSecret)
+	if err != nil {
+		return err
+	}
+	if owner == "" || client.ClientId == owner {
+		return nil
+	}
+	if !client.IsPublic() && domain.IncludesScopes(client.Scopes, domain.ScopeRevokeTokens) {
+		return nil
+	}
+	return errTokenOfAnotherClient()
+}
+
+// errTokenOfAnotherClient tells a client that tried to revoke a token it
+// wasn't issued, tokens of users logged in without a client included
+func errTokenOfAnotherClient() rest_errors.RestErr {
+	return rest_errors.NewRestError("token was issued to another client", http.StatusForbidden, "unauthorized_client")
+}
+
+// revokeFamily ends the session of the family and returns message as a bad
+// request, unless ending it fails
+func (s *accessTokenService) revokeFamily(familyId string, userId int64, clientId string, message string) rest_errors.RestErr {
+	if err := s.endSession(familyId, userId, clientId, domain.OAuthEventReasonReused); err != nil {
+		return err
+	}
+	return rest_errors.NewBadRequestError(message)
+}
+
+// startSession records the login that started the family of at, the oldest
+// sessions of the user are ended first to stay within the session limit
+func (s *accessTokenService) startSession(familyId string, at *domain.AccessToken, device domain.Device) rest_errors.RestErr {
+	if s.config.SessionLimit > 0 {
+		sessions, err := s.srepo.GetByUser(at.UserId)
+		if err != nil {
+			return err
+		}
+		for i := 0; i <= len(sessions)-s.config.SessionLimit; i++ {
+			if err := s.endSession(sessions[i].Id, sessions[i].UserId, sessions[i].ClientId, domain.OAuthEventReasonSessionLimit); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.srepo.Create(domain.Session{
+		Id:         familyId,
+		UserId:     at.UserId,
+		ClientId:   at.ClientId,
+		UserAgent:  device.UserAgent,
+		Ip:         device.Ip,
+		CreatedAt:  at.IssuedAt,
+		LastUsedAt: at.IssuedAt,
+	})
+}
+
+// endSession revokes every token of the family and forgets its session,
+// reason tells the other services why
+func (s *accessTokenService) endSession(familyId string, userId int64, clientId string, reason string) rest_errors.RestErr {
+	revoked := newOAuthEvent(domain.OAuthEventTokenRevoked)
+	revoked.UserId = userId
+	revoked.ClientId = clientId
+	revoked.SessionId = familyId
+	revoked.Reason = reason
+
+	if err := s.repo.RevokeRefreshTokenFamily(familyId, revoked, sessionEndedEvent(familyId, userId, clientId, reason)); err != nil {
+		return err
+	}
+	return s.srepo.Delete(familyId)
+}
+
+func newOAuthEvent(eventType string) domain.OAuthEvent {
+	return domain.OAuthEvent{
+		Id:         uuid.NewV4().String(),
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+	}
+}
+
+func sessionEndedEvent(sessionId string, userId int64, clientId string, reason string) domain.OAuthEvent {
+	ended := newOAuthEvent(domain.OAuthEventSessionEnded)
+	ended.UserId = userId
+	ended.ClientId = clientId
+	ended.SessionId = sessionId
+	ended.Reason = reason
+	return ended
+}
+
+// userToken validates an access token that must have been issued to a user
+func (s *accessTokenService) userToken(token string) (*domain.AccessToken, rest_errors.RestErr) {
+	at, err := s.GetById(token)
+	if err != nil {
+		if err.Status() == http.StatusNotFound {
+			return nil, rest_errors.NewUnauthorizedError("invalid access token")
+		}
+		return nil, err
+	}
+
+	if at.IsClientToken() {
+		return nil, rest_errors.NewRestError("access token has no user", http.StatusForbidden, "forbidden")
+	}
+	return at, nil
+}
+
+// grantScopes resolves the scopes of a new token, every requested scope
+// must be allowed and requesting none grants all of the allowed ones
+func grantScopes(scope string, allowed []string) ([]string, rest_errors.RestErr) {
+	requested := domain.ParseScopes(scope)
+	if len(requested) == 0 {
+		return append([]string{}, allowed...), nil
+	}
+
+	if !domain.IncludesScopes(allowed, requested...) {
+		return nil, rest_errors.NewBadRequestError("invalid scope")
+	}
+	return requested, nil
+}
+
+func verifyCodeChallenge(challenge string, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
@@ -0,0 +1,540 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/infraestructure/repositories/memory"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// signerMock hands out numbered tokens, only the ones it signed verify
+type signerMock struct {
+	claims map[string]domain.TokenClaims
+}
+
+func (m *signerMock) Sign(claims domain.TokenClaims) (string, rest_errors.RestErr) {
+	token := fmt.Sprintf("header.%d.signature", len(m.claims))
+	m.claims[token] = claims
+	return token, nil
+}
+
+func (m *signerMock) Verify(token string) (*domain.TokenClaims, rest_errors.RestErr) {
+	claims, ok := m.claims[token]
+	if !ok {
+		return nil, rest_errors.NewUnauthorizedError("invalid access token")
+	}
+	return &claims, nil
+}
+
+func (m *signerMock) JWKS() domain.JSONWebKeySet {
+	return domain.JSONWebKeySet{Keys: []domain.JSONWebKey{}}
+}
+
+// usersServiceMock knows a single user, jane, whose password is password
+type usersServiceMock struct{}
+
+var userTest = domain.User{Id: 1, Email: "jane@bookstore.com", Role: "user"}
+
+func (usersServiceMock) Login(email string, password string) (*domain.User, rest_errors.RestErr) {
+	if email != userTest.Email || password != "password" {
+		return nil, rest_errors.NewUnauthorizedError("invalid credentials")
+	}
+	user := userTest
+	return &user, nil
+}
+
+func (usersServiceMock) GetById(id int64) (*domain.User, rest_errors.RestErr) {
+	if id != userTest.Id {
+		return nil, rest_errors.NewNotFoundError("user not found")
+	}
+	user := userTest
+	return &user, nil
+}
+
+type clientRepoMock map[string]domain.Client
+
+func (m clientRepoMock) GetById(id string) (*domain.Client, rest_errors.RestErr) {
+	client, ok := m[id]
+	if !ok {
+		return nil, rest_errors.NewNotFoundError("client not found")
+	}
+	return &client, nil
+}
+
+// sessionRepoMock keeps the sessions in creation order
+type sessionRepoMock struct {
+	sessions []domain.Session
+}
+
+func (m *sessionRepoMock) Create(session domain.Session) rest_errors.RestErr {
+	m.sessions = append(m.sessions, session)
+	return nil
+}
+
+func (m *sessionRepoMock) GetById(id string) (*domain.Session, rest_errors.RestErr) {
+	for _, session := range m.sessions {
+		if session.Id == id {
+			return &session, nil
+		}
+	}
+	return nil, rest_errors.NewNotFoundError("session not found")
+}
+
+func (m *sessionRepoMock) GetByUser(userId int64) ([]domain.Session, rest_errors.RestErr) {
+	sessions := []domain.Session{}
+	for _, session := range m.sessions {
+		if session.UserId == userId {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *sessionRepoMock) Touch(id string, at int64) rest_errors.RestErr {
+	return nil
+}
+
+func (m *sessionRepoMock) Delete(id string) rest_errors.RestErr {
+	return m.deleteWhere(func(session domain.Session) bool { return session.Id == id })
+}
+
+func (m *sessionRepoMock) DeleteByUser(userId int64) rest_errors.RestErr {
+	return m.deleteWhere(func(session domain.Session) bool { return session.UserId == userId })
+}
+
+func (m *sessionRepoMock) deleteWhere(match func(domain.Session) bool) rest_errors.RestErr {
+	kept := []domain.Session{}
+	for _, session := range m.sessions {
+		if !match(session) {
+			kept = append(kept, session)
+		}
+	}
+	m.sessions = kept
+	return nil
+}
+
+const clientSecretTest = "catalog-secret"
+
+// newServiceTest returns a service issuing tokens in format, with the
+// tokens kept in memory. The service isn't the singleton so every test
+// gets its own.
+func newServiceTest(t *testing.T, format string) *accessTokenService {
+	secret, err := bcrypt.GenerateFromPassword([]byte(clientSecretTest), bcrypt.MinCost)
+	require.Nil(t, err)
+
+	return &accessTokenService{
+		repo:     memory.NewAccessTokenRepository(memory.NewStore()),
+		uservice: usersServiceMock{},
+		crepo: clientRepoMock{
+			"catalog": {
+				ClientId:     "catalog",
+				ClientSecret: string(secret),
+				Grants:       []string{domain.GrantTypeClientCredentials},
+				Scopes:       []string{"books:read"},
+			},
+			"billing": {
+				ClientId:     "billing",
+				ClientSecret: string(secret),
+				Grants:       []string{domain.GrantTypeClientCredentials},
+				Scopes:       []string{"books:read"},
+			},
+			"portal": {
+				ClientId:     "portal",
+				ClientSecret: string(secret),
+				Grants:       []string{domain.GrantTypeAuthorizationCode, domain.GrantTypeRefreshToken},
+				Scopes:       []string{"books:read"},
+				RedirectUris: []string{"https://portal.bookstore.com/callback"},
+			},
+			"accounts": {
+				ClientId:     "accounts",
+				ClientSecret: string(secret),
+				Grants:       []string{domain.GrantTypeClientCredentials},
+				Scopes:       []string{domain.ScopeRevokeTokens},
+			},
+			"spa": {
+				ClientId:     "spa",
+				Grants:       []string{domain.GrantTypeAuthorizationCode, domain.GrantTypeRefreshToken},
+				Scopes:       []string{"books:read"},
+				RedirectUris: []string{"https://spa.bookstore.com/callback"},
+			},
+		},
+		srepo:  &sessionRepoMock{},
+		signer: &signerMock{claims: map[string]domain.TokenClaims{}},
+		config: AccessTokenConfig{
+			TokenFormat: format,
+			Issuer:      "http://localhost:8081",
+			RoleScopes:  map[string][]string{"user": {"books:read"}},
+		},
+	}
+}
+
+func TestRevokeJWT(t *testing.T) {
+	t.Run("Revoke", func(t *testing.T) {
+		s := newServiceTest(t, domain.TokenFormatJWT)
+		at, err := s.CreateForClient("catalog", clientSecretTest, "")
+		require.Nil(t, err)
+		require.True(t, s.isJWT(at.AccessToken))
+
+		_, err = s.GetById(at.AccessToken)
+		assert.Nil(t, err)
+		introspection, err := s.Introspect(at.AccessToken, "catalog", clientSecretTest)
+		require.Nil(t, err)
+		assert.True(t, introspection.Active)
+
+		require.Nil(t, s.Revoke(at.AccessToken, domain.TokenTypeHintAccessToken, "catalog", clientSecretTest))
+
+		_, err = s.GetById(at.AccessToken)
+		if assert.NotNil(t, err) {
+			assert.EqualValues(t, http.StatusUnauthorized, err.Status())
+		}
+		introspection, err = s.Introspect(at.AccessToken, "catalog", clientSecretTest)
+		require.Nil(t, err)
+		assert.False(t, introspection.Active)
+	})
+
+	t.Run("RevokeUserTokens", func(t *testing.T) {
+		s := newServiceTest(t, domain.TokenFormatJWT)
+		at, err := s.Create(userTest.Email, "password", "", domain.Device{})
+		require.Nil(t, err)
+
+		require.Nil(t, s.RevokeUserTokens(userTest.Id))
+
+		_, err = s.GetById(at.AccessToken)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("EndSession", func(t *testing.T) {
+		s := newServiceTest(t, domain.TokenFormatJWT)
+		at, err := s.Create(userTest.Email, "password", "", domain.Device{})
+		require.Nil(t, err)
+		sessions := s.srepo.(*sessionRepoMock).sessions
+		require.Len(t, sessions, 1)
+
+		// ending the session revokes every token of it
+		require.Nil(t, s.EndSession(at.AccessToken, sessions[0].Id))
+
+		_, err = s.GetById(at.AccessToken)
+		assert.NotNil(t, err)
+	})
+}
+
+// tokens from the password grant belong to no client, presenting them is
+// enough to revoke them
+func TestRevokePasswordGrantToken(t *testing.T) {
+	t.Run("AccessToken", func(t *testing.T) {
+		s := newServiceTest(t, domain.TokenFormatOpaque)
+		at, err := s.Create(userTest.Email, "password", "", domain.Device{})
+		require.Nil(t, err)
+
+		require.Nil(t, s.Revoke(at.AccessToken, domain.TokenTypeHintAccessToken, "", ""))
+
+		_, err = s.GetById(at.AccessToken)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("RefreshToken", func(t *testing.T) {
+		s := newServiceTest(t, domain.TokenFormatOpaque)
+		at, err := s.Create(userTest.Email, "password", "", domain.Device{})
+		require.Nil(t, err)
+
+		require.Nil(t, s.Revoke(at.RefreshToken, "", "", ""))
+
+		_, err = s.GetById(at.AccessToken)
+		assert.NotNil(t, err)
+		_, err = s.Refresh(at.RefreshToken, "", "")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("JWT", func(t *testing.T) {
+		s := newServiceTest(t, domain.TokenFormatJWT)
+		at, err := s.Create(userTest.Email, "password", "", domain.Device{})
+		require.Nil(t, err)
+
+		require.Nil(t, s.Revoke(at.AccessToken, "", "", ""))
+
+		_, err = s.GetById(at.AccessToken)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestRevokeClientAuthentication(t *testing.T) {
+	t.Run("ErrorNoCredentials", func(t *testing.T) {
+		s := newServiceTest(t, domain.TokenFormatOpaque)
+		at, err := s.CreateForClient("catalog", clientSecretTest, "")
+		require.Nil(t, err)
+
+		err = s.Revoke(at.AccessToken, "", "", "")
+
+		if assert.NotNil(t, err) {
+			assert.EqualValues(t, http.StatusUnauthorized, err.Status())
+		}
+		_, err = s.GetById(at.AccessToken)
+		assert.Nil(t, err)
+	})
+
+	t.Run("ErrorWrongSecret", func(t *testing.T) {
+		s := newServiceTest(t, domain.TokenFormatOpaque)
+		at, err := s.CreateForClient("catalog", clientSecretTest, "")
+		require.Nil(t, err)
+
+		err = s.Revoke(at.AccessToken, "", "catalog", "wrong")
+
+		if assert.NotNil(t, err) {
+			assert.EqualValues(t, http.StatusUnauthorized, err.Status())
+		}
+	})
+
+	t.Run("ErrorTokenOfAnotherClient", func(t *testing.T) {
+		s := newServiceTest(t, domain.TokenFormatOpaque)
+		at, err := s.CreateForClient("catalog", clientSecretTest, "")
+		require.Nil(t, err)
+
+		err = s.Revoke(at.AccessToken, "", "billing", clientSecretTest)
+
+		if assert.NotNil(t, err) {
+			assert.EqualValues(t, http.StatusForbidden, err.Status())
+		}
+		_, err = s.GetById(at.AccessToken)
+		assert.Nil(t, err)
+	})
+
+	t.Run("ErrorPublicClientWithRevokeScope", func(t *testing.T) {
+		s := newServiceTest(t, domain.TokenFormatOpaque)
+		spa := s.crepo.(clientRepoMock)["spa"]
+		spa.Scopes = []string{domain.ScopeRevokeTokens}
+		s.crepo.(clientRepoMock)["spa"] = spa
+		at, err := s.CreateForClient("catalog", clientSecretTest, "")
+		require.Nil(t, err)
+
+		err = s.Revoke(at.AccessToken, "", "spa", "")
+
+		if assert.NotNil(t, err) {
+			assert.EqualValues(t, http.StatusForbidden, err.Status())
+		}
+	})
+
+	t.Run("NoErrorTrustedClient", func(t *testing.T) {
+		s := newServiceTest(t, domain.TokenFormatOpaque)
+		at, err := s.CreateForClient("catalog", clientSecretTest, "")
+		require.Nil(t, err)
+
+		assert.Nil(t, s.Revoke(at.AccessToken, "", "accounts", clientSecretTest))
+
+		_, err = s.GetById(at.AccessToken)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ErrorWrongSecretForTokenOfNoClient", func(t *testing.T) {
+		s := newServiceTest(t, domain.TokenFormatOpaque)
+		at, err := s.Create(userTest.Email, "password", "", domain.Device{})
+		require.Nil(t, err)
+
+		err = s.Revoke(at.AccessToken, "", "catalog", "wrong")
+
+		if assert.NotNil(t, err) {
+			assert.EqualValues(t, http.StatusUnauthorized, err.Status())
+		}
+	})
+
+	t.Run("NoErrorUnknownToken", func(t *testing.T) {
+		s := newServiceTest(t, domain.TokenFormatOpaque)
+
+		assert.Nil(t, s.Revoke("b255ce76-4a87-4293-ae19-08768c96ea05", "", "catalog", clientSecretTest))
+	})
+}
+
+// codeVerifierTest is the PKCE verifier of every code in the tests
+const codeVerifierTest = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+// authorizeTest logs jane in through client and returns the code
+func authorizeTest(t *testing.T, s *accessTokenService, client string) string {
+	sum := sha256.Sum256([]byte(codeVerifierTest))
+	code, err := s.Authorize(domain.AuthorizationRequest{
+		ResponseType:        "code",
+		ClientId:            client,
+		RedirectUri:         "https://" + client + ".bookstore.com/callback",
+		Scope:               "books:read",
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(sum[:]),
+		CodeChallengeMethod: domain.CodeChallengeMethodS256,
+	}, userTest.Email, "password")
+	require.Nil(t, err)
+	return code.Code
+}
+
+func TestAuthorizeErrors(t *testing.T) {
+	sum := sha256.Sum256([]byte(codeVerifierTest))
+	req := domain.AuthorizationRequest{
+		ResponseType:        "code",
+		ClientId:            "spa",
+		RedirectUri:         "https://spa.bookstore.com/callback",
+		Scope:               "books:read",
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(sum[:]),
+		CodeChallengeMethod: domain.CodeChallengeMethodS256,
+	}
+
+	t.Run("ErrorWrongPassword", func(t *testing.T) {
+		s := newServiceTest(t, domain.TokenFormatOpaque)
+
+		code, err := s.Authorize(req, userTest.Email, "wrong")
+
+		assert.Nil(t, code)
+		if assert.NotNil(t, err) {
+			assert.EqualValues(t, http.StatusUnauthorized, err.Status())
+			assert.EqualValues(t, "invalid email or password", err.Message())
+		}
+	})
+
+	t.Run("ErrorScopeNotAllowedForRole", func(t *testing.T) {
+		s := newServiceTest(t, domain.TokenFormatOpaque)
+		s.config.RoleScopes = map[string][]string{}
+
+		code, err := s.Authorize(req, userTest.Email, "password")
+
+		assert.Nil(t, code)
+		if assert.NotNil(t, err) {
+			assert.EqualValues(t, http.StatusBadRequest, err.Status())
+			assert.EqualValues(t, "invalid scope", err.Message())
+		}
+	})
+}
+
+func TestTokenEndpointClientAuthentication(t *testing.T) {
+	t.Run("ErrorConfidentialClientWithoutSecret", func(t *testing.T) {
+		s := newServiceTest(t, domain.TokenFormatOpaque)
+		code := authorizeTest(t, s, "portal")
+
+		at, err := s.CreateFromAuthorizationCode(code, "https://portal.bookstore.com/callback", "portal", "", codeVerifierTest, domain.Device{})
+
+		assert.Nil(t, at)
+		if assert.NotNil(t, err) {
+			assert.EqualValues(t, http.StatusUnauthorized, err.Status())
+		}
+	})
+
+	t.Run("ConfidentialClient", func(t *testing.T) {
+		s := newServiceTest(t, domain.TokenFormatOpaque)
+		code := authorizeTest(t, s, "portal")
+
+		at, err := s.CreateFromAuthorizationCode(code, "https://portal.bookstore.com/callback", "portal", clientSecretTest, codeVerifierTest, domain.Device{})
+		require.Nil(t, err)
+
+		_, err = s.Refresh(at.RefreshToken, "portal", "")
+		if assert.NotNil(t, err) {
+			assert.EqualValues(t, http.StatusUnauthorized, err.Status())
+		}
+
+		_, err = s.Refresh(at.RefreshToken, "billing", clientSecretTest)
+		if assert.NotNil(t, err) {
+			assert.EqualValues(t, http.StatusBadRequest, err.Status())
+		}
+
+		// the failed attempts didn't use the refresh token up
+		refreshed, err := s.Refresh(at.RefreshToken, "portal", clientSecretTest)
+		assert.Nil(t, err)
+		assert.NotNil(t, refreshed)
+	})
+
+	t.Run("PublicClient", func(t *testing.T) {
+		s := newServiceTest(t, domain.TokenFormatOpaque)
+		code := authorizeTest(t, s, "spa")
+
+		at, err := s.CreateFromAuthorizationCode(code, "https://spa.bookstore.com/callback", "spa", "", codeVerifierTest, domain.Device{})
+		require.Nil(t, err)
+
+		refreshed, err := s.Refresh(at.RefreshToken, "spa", "")
+		require.Nil(t, err)
+
+		assert.Nil(t, s.Revoke(refreshed.RefreshToken, domain.TokenTypeHintRefreshToken, "spa", ""))
+	})
+
+	t.Run("ErrorPublicClientIntrospect", func(t *testing.T) {
+		s := newServiceTest(t, domain.TokenFormatOpaque)
+
+		_, err := s.Introspect("b255ce76-4a87-4293-ae19-08768c96ea05", "spa", "")
+
+		if assert.NotNil(t, err) {
+			assert.EqualValues(t, http.StatusUnauthorized, err.Status())
+		}
+	})
+
+	t.Run("PasswordGrantNeedsNoClient", func(t *testing.T) {
+		s := newServiceTest(t, domain.TokenFormatOpaque)
+		at, err := s.Create(userTest.Email, "password", "", domain.Device{})
+		require.Nil(t, err)
+
+		_, err = s.Refresh(at.RefreshToken, "", "")
+		assert.Nil(t, err)
+	})
+}
+
+// the session of a code is shown to the user and to event consumers, so it
+// must not give the code away
+func TestAuthorizationCodeSession(t *testing.T) {
+	s := newServiceTest(t, domain.TokenFormatOpaque)
+	code := authorizeTest(t, s, "spa")
+
+	at, err := s.CreateFromAuthorizationCode(code, "https://spa.bookstore.com/callback", "spa", "", codeVerifierTest, domain.Device{})
+	require.Nil(t, err)
+
+	sessions := s.srepo.(*sessionRepoMock).sessions
+	if assert.Len(t, sessions, 1) {
+		assert.NotEmpty(t, sessions[0].Id)
+		assert.NotEqual(t, code, sessions[0].Id)
+	}
+
+	t.Run("ReplayEndsSession", func(t *testing.T) {
+		_, err := s.CreateFromAuthorizationCode(code, "https://spa.bookstore.com/callback", "spa", "", codeVerifierTest, domain.Device{})
+
+		assert.NotNil(t, err)
+		assert.Empty(t, s.srepo.(*sessionRepoMock).sessions)
+		_, err = s.GetById(at.AccessToken)
+		assert.NotNil(t, err)
+	})
+}
+
+// lifetimePolicyMock gives every token the same lifetime
+type lifetimePolicyMock time.Duration
+
+func (m lifetimePolicyMock) AccessTokenLifetime(grantType string, clientId string, role string) (time.Duration, bool) {
+	return time.Duration(m), true
+}
+
+func TestAccessTokenLifetime(t *testing.T) {
+	s := newServiceTest(t, domain.TokenFormatOpaque)
+	s.config.Lifetimes = lifetimePolicyMock(time.Hour)
+
+	t.Run("Policy", func(t *testing.T) {
+		lifetime := s.accessTokenLifetime(domain.GrantTypeClientCredentials, "catalog", "", 0)
+		assert.EqualValues(t, time.Hour, lifetime)
+	})
+
+	t.Run("ClientTTLOverPolicy", func(t *testing.T) {
+		lifetime := s.accessTokenLifetime(domain.GrantTypeClientCredentials, "catalog", "", 5*time.Minute)
+		assert.EqualValues(t, 5*time.Minute, lifetime)
+	})
+
+	t.Run("CapOverClientTTL", func(t *testing.T) {
+		s := newServiceTest(t, domain.TokenFormatJWT)
+		s.config.LifetimeCap = 30 * time.Minute
+
+		lifetime := s.accessTokenLifetime(domain.GrantTypeClientCredentials, "catalog", "", 2*time.Hour)
+		assert.EqualValues(t, 30*time.Minute, lifetime)
+	})
+
+	t.Run("CapOverDefault", func(t *testing.T) {
+		s := newServiceTest(t, domain.TokenFormatJWT)
+		s.config.LifetimeCap = 30 * time.Minute
+
+		lifetime := s.accessTokenLifetime(domain.GrantTypePassword, "", "user", 0)
+		assert.EqualValues(t, 30*time.Minute, lifetime)
+	})
+}
@@ -47,3 +47,10 @@ func (s *usersService) Login(email, password string) (*domain.User, rest_errors.
 	}
 	return user, nil
 }
+
+func (s *usersService) GetById(id int64) (*domain.User, rest_errors.RestErr) {
+	if id <= 0 {
+		return nil, rest_errors.NewBadRequestError("invalid user id")
+	}
+	return s.repo.GetById(id)
+}
@@ -0,0 +1,195 @@
+package cache
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+)
+
+// tokens are only ever part of a key hashed, the way the repositories
+// store them, and cached without their value
+const (
+	keyAccessToken = "oauth:access_token:"
+	// the access tokens cached for a user, and the ones issued to a family
+	// of refresh tokens, so revoking them can find them
+	keyUserTokens   = "oauth:user_tokens:"
+	keyFamilyTokens = "oauth:family_tokens:"
+)
+
+// notFound is what is stored for tokens that don't exist
+var notFound = []byte{}
+
+// AccessTokenConfig tells how long tokens are cached
+type AccessTokenConfig struct {
+	// TTL is how long a token is cached at most, it's also how long a
+	// revocation can go unnoticed if an invalidation is lost
+	TTL time.Duration
+	// NegativeTTL is how long a token that doesn't exist is remembered as
+	// such, zero means tokens that don't exist aren't cached
+	NegativeTTL time.Duration
+}
+
+// accessTokenRepository caches the access tokens looked up by id, every
+// other method goes straight to the repository it wraps. Writes that
+// revoke tokens invalidate them once the repository is done.
+type accessTokenRepository struct {
+	ports.AccessTokenRepository
+	store  Store
+	config AccessTokenConfig
+}
+
+func NewAccessTokenRepository(repo ports.AccessTokenRepository, store Store, config AccessTokenConfig) ports.AccessTokenRepository {
+	return &accessTokenRepository{
+		AccessTokenRepository: repo,
+		store:                 store,
+		config:                config,
+	}
+}
+
+// GetById falls back to the repository when the cache fails, a broken
+// cache makes validation slower but never makes it fail
+func (r *accessTokenRepository) GetById(id string) (*domain.AccessToken, rest_errors.RestErr) {
+	hash := domain.HashAccessToken(id)
+	key := keyAccessToken + hash
+
+	value, ok, err := r.store.Get(key)
+	if err != nil {
+		log.Printf("error while reading cached access token: %v", err)
+	}
+	if ok {
+		if len(value) == 0 {
+			return nil, rest_errors.NewNotFoundError("access_token not found")
+		}
+		var at domain.AccessToken
+		if err := json.Unmarshal(value, &at); err == nil {
+			at.AccessToken = id
+			return &at, nil
+		}
+	}
+
+	at, restErr := r.AccessTokenRepository.GetById(id)
+	if restErr != nil {
+		if restErr.Status() == http.StatusNotFound && r.config.NegativeTTL > 0 {
+			r.set(key, notFound, r.config.NegativeTTL)
+		}
+		return nil, restErr
+	}
+
+	// an expired token is no use to anyone, it's not worth caching
+	ttl := r.config.TTL
+	if untilExpired := time.Until(time.Unix(at.Expires, 0)); untilExpired < ttl {
+		ttl = untilExpired
+	}
+	if ttl <= 0 {
+		return at, nil
+	}
+
+	cached := *at
+	cached.AccessToken = ""
+	value, err = json.Marshal(cached)
+	if err != nil {
+		return at, nil
+	}
+	if at.UserId != 0 {
+		if err := r.store.AddToSet(keyUserTokens+strconv.FormatInt(at.UserId, 10), hash, r.config.TTL); err != nil {
+			// a token the user index doesn't know about can't be cached,
+			// revoking the tokens of the user would miss it
+			log.Printf("error while indexing cached access token: %v", err)
+			return at, nil
+		}
+	}
+	r.set(key, value, ttl)
+
+	return at, nil
+}
+
+// Create forgets the token in case it was looked up before it existed
+func (r *accessTokenRepository) Create(at domain.AccessToken, events ...domain.OAuthEvent) rest_errors.RestErr {
+	if err := r.AccessTokenRepository.Create(at, events...); err != nil {
+		return err
+	}
+	r.invalidate(keyAccessToken + domain.HashAccessToken(at.AccessToken))
+	return nil
+}
+
+func (r *accessTokenRepository) DeleteById(id string, events ...domain.OAuthEvent) rest_errors.RestErr {
+	if err := r.AccessTokenRepository.DeleteById(id, events...); err != nil {
+		return err
+	}
+	r.invalidate(keyAccessToken + domain.HashAccessToken(id))
+	return nil
+}
+
+func (r *accessTokenRepository) DeleteByUser(userId int64, events ...domain.OAuthEvent) rest_errors.RestErr {
+	if err := r.AccessTokenRepository.DeleteByUser(userId, events...); err != nil {
+		return err
+	}
+	r.invalidateSet(keyUserTokens + strconv.FormatInt(userId, 10))
+	return nil
+}
+
+// UpdateExpirationTime forgets the token so its new expiration is read
+func (r *accessTokenRepository) UpdateExpirationTime(id string, expires int64) rest_errors.RestErr {
+	if err := r.AccessTokenRepository.UpdateExpirationTime(id, expires); err != nil {
+		return err
+	}
+	r.invalidate(keyAccessToken + domain.HashAccessToken(id))
+	return nil
+}
+
+// CreateWithRefreshToken forgets the token like Create does, and remembers
+// which access token was issued to the family, access tokens don't know the
+// family they belong to
+func (r *accessTokenRepository) CreateWithRefreshToken(at domain.AccessToken, rt domain.RefreshToken, events ...domain.OAuthEvent) rest_errors.RestErr {
+	if err := r.AccessTokenRepository.CreateWithRefreshToken(at, rt, events...); err != nil {
+		return err
+	}
+	r.invalidate(keyAccessToken + domain.HashAccessToken(at.AccessToken))
+	if err := r.store.AddToSet(keyFamilyTokens+rt.FamilyId, domain.HashAccessToken(rt.AccessToken), time.Until(time.Unix(rt.Expires, 0))); err != nil {
+		log.Printf("error while indexing access token of family: %v", err)
+	}
+	return nil
+}
+
+func (r *accessTokenRepository) RevokeRefreshTokenFamily(familyId string, events ...domain.OAuthEvent) rest_errors.RestErr {
+	if err := r.AccessTokenRepository.RevokeRefreshTokenFamily(familyId, events...); err != nil {
+		return err
+	}
+	r.invalidateSet(keyFamilyTokens + familyId)
+	return nil
+}
+
+func (r *accessTokenRepository) set(key string, value []byte, ttl time.Duration) {
+	if err := r.store.Set(key, value, ttl); err != nil {
+		log.Printf("error while caching access token: %v", err)
+	}
+}
+
+// invalidate can't undo the write that came before it, so a failure is only
+// logged, the entry still goes away once its ttl is over
+func (r *accessTokenRepository) invalidate(keys ...string) {
+	if err := r.store.Delete(keys...); err != nil {
+		log.Printf("error while invalidating cached access tokens: %v", err)
+	}
+}
+
+// invalidateSet forgets every token in the set at key, and the set itself
+func (r *accessTokenRepository) invalidateSet(key string) {
+	hashes, err := r.store.SetMembers(key)
+	if err != nil {
+		log.Printf("error while invalidating cached access tokens: %v", err)
+		return
+	}
+
+	keys := []string{key}
+	for _, hash := range hashes {
+		keys = append(keys, keyAccessToken+hash)
+	}
+	r.invalidate(keys...)
+}
@@ -0,0 +1,217 @@
+package cache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// tokenRepoMock keeps the tokens in a map and counts the lookups that got
+// to it
+type tokenRepoMock struct {
+	ports.AccessTokenRepository
+	tokens  map[string]domain.AccessToken
+	lookups int
+}
+
+func newTokenRepoMock(tokens ...domain.AccessToken) *tokenRepoMock {
+	m := &tokenRepoMock{tokens: map[string]domain.AccessToken{}}
+	for _, at := range tokens {
+		m.tokens[at.AccessToken] = at
+	}
+	return m
+}
+
+func (m *tokenRepoMock) GetById(id string) (*domain.AccessToken, rest_errors.RestErr) {
+	m.lookups++
+	at, ok := m.tokens[id]
+	if !ok {
+		return nil, rest_errors.NewNotFoundError("access_token not found")
+	}
+	return &at, nil
+}
+
+func (m *tokenRepoMock) Create(at domain.AccessToken, events ...domain.OAuthEvent) rest_errors.RestErr {
+	m.tokens[at.AccessToken] = at
+	return nil
+}
+
+func (m *tokenRepoMock) DeleteById(id string, events ...domain.OAuthEvent) rest_errors.RestErr {
+	delete(m.tokens, id)
+	return nil
+}
+
+func (m *tokenRepoMock) DeleteByUser(userId int64, events ...domain.OAuthEvent) rest_errors.RestErr {
+	for id, at := range m.tokens {
+		if at.UserId == userId {
+			delete(m.tokens, id)
+		}
+	}
+	return nil
+}
+
+func (m *tokenRepoMock) CreateWithRefreshToken(at domain.AccessToken, rt domain.RefreshToken, events ...domain.OAuthEvent) rest_errors.RestErr {
+	m.tokens[at.AccessToken] = at
+	return nil
+}
+
+func (m *tokenRepoMock) RevokeRefreshTokenFamily(familyId string, events ...domain.OAuthEvent) rest_errors.RestErr {
+	// the mock only ever issues one token per family, named after it
+	delete(m.tokens, familyId)
+	return nil
+}
+
+func newTokenTest(id string, userId int64) domain.AccessToken {
+	return domain.AccessToken{
+		AccessToken: id,
+		TokenType:   "Bearer",
+		UserId:      userId,
+		UserRole:    "user",
+		Scopes:      []string{"books:read"},
+		Expires:     time.Now().Add(time.Hour).Unix(),
+		IssuedAt:    time.Now().Unix(),
+	}
+}
+
+var cacheConfigTest = AccessTokenConfig{TTL: time.Minute, NegativeTTL: time.Minute}
+
+// stores runs the test against both backends
+func stores(t *testing.T, test func(t *testing.T, store Store)) {
+	t.Run("LRU", func(t *testing.T) {
+		test(t, NewLRU(100))
+	})
+	t.Run("Redis", func(t *testing.T) {
+		r, _ := newRedisStub(t)
+		test(t, r)
+	})
+}
+
+func TestCachedGetById(t *testing.T) {
+	stores(t, func(t *testing.T, store Store) {
+		at := newTokenTest("084a4a0f-92cc-46e6-9b57-1d2aed3c389e", 1)
+		repo := newTokenRepoMock(at)
+		cached := NewAccessTokenRepository(repo, store, cacheConfigTest)
+
+		for i := 0; i < 3; i++ {
+			got, err := cached.GetById(at.AccessToken)
+			assert.Nil(t, err)
+			assert.EqualValues(t, at, *got)
+		}
+		assert.EqualValues(t, 1, repo.lookups)
+
+		// the token is kept out of the cache, as it is out of the db
+		_, ok, _ := store.Get(keyAccessToken + at.AccessToken)
+		assert.False(t, ok)
+		value, ok, _ := store.Get(keyAccessToken + domain.HashAccessToken(at.AccessToken))
+		assert.True(t, ok)
+		assert.NotContains(t, string(value), at.AccessToken)
+	})
+}
+
+func TestCachedGetByIdNotFound(t *testing.T) {
+	stores(t, func(t *testing.T, store Store) {
+		repo := newTokenRepoMock()
+		cached := NewAccessTokenRepository(repo, store, cacheConfigTest)
+
+		for i := 0; i < 3; i++ {
+			got, err := cached.GetById("unknown")
+			assert.Nil(t, got)
+			assert.NotNil(t, err)
+			assert.EqualValues(t, http.StatusNotFound, err.Status())
+		}
+		assert.EqualValues(t, 1, repo.lookups)
+
+		// a token created with an id that was looked up isn't hidden
+		at := newTokenTest("unknown", 1)
+		assert.Nil(t, cached.Create(at))
+		got, err := cached.GetById("unknown")
+		assert.Nil(t, err)
+		assert.EqualValues(t, at, *got)
+	})
+}
+
+func TestCachedGetByIdExpiredToken(t *testing.T) {
+	at := newTokenTest("084a4a0f-92cc-46e6-9b57-1d2aed3c389e", 1)
+	at.Expires = time.Now().Add(-time.Minute).Unix()
+	repo := newTokenRepoMock(at)
+	cached := NewAccessTokenRepository(repo, NewLRU(100), cacheConfigTest)
+
+	cached.GetById(at.AccessToken)
+	cached.GetById(at.AccessToken)
+
+	assert.EqualValues(t, 2, repo.lookups)
+}
+
+func TestCachedGetByIdStoreDown(t *testing.T) {
+	at := newTokenTest("084a4a0f-92cc-46e6-9b57-1d2aed3c389e", 1)
+	repo := newTokenRepoMock(at)
+	r, stub := newRedisStub(t)
+	stub.setDown(true)
+	cached := NewAccessTokenRepository(repo, r, cacheConfigTest)
+
+	got, err := cached.GetById(at.AccessToken)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, at, *got)
+}
+
+func TestCachedInvalidation(t *testing.T) {
+	t.Run("DeleteById", func(t *testing.T) {
+		stores(t, func(t *testing.T, store Store) {
+			at := newTokenTest("084a4a0f-92cc-46e6-9b57-1d2aed3c389e", 1)
+			cached := NewAccessTokenRepository(newTokenRepoMock(at), store, cacheConfigTest)
+			cached.GetById(at.AccessToken)
+
+			assert.Nil(t, cached.DeleteById(at.AccessToken))
+
+			_, err := cached.GetById(at.AccessToken)
+			assert.NotNil(t, err)
+			assert.EqualValues(t, http.StatusNotFound, err.Status())
+		})
+	})
+
+	t.Run("DeleteByUser", func(t *testing.T) {
+		stores(t, func(t *testing.T, store Store) {
+			first := newTokenTest("084a4a0f-92cc-46e6-9b57-1d2aed3c389e", 1)
+			second := newTokenTest("5d2c7e1a-3b4f-4c8d-9e0a-1b2c3d4e5f60", 1)
+			other := newTokenTest("7a8b9c0d-1e2f-4a3b-8c4d-5e6f7a8b9c0d", 2)
+			cached := NewAccessTokenRepository(newTokenRepoMock(first, second, other), store, cacheConfigTest)
+			for _, at := range []domain.AccessToken{first, second, other} {
+				cached.GetById(at.AccessToken)
+			}
+
+			assert.Nil(t, cached.DeleteByUser(1))
+
+			for _, at := range []domain.AccessToken{first, second} {
+				_, err := cached.GetById(at.AccessToken)
+				assert.NotNil(t, err)
+			}
+			_, err := cached.GetById(other.AccessToken)
+			assert.Nil(t, err)
+		})
+	})
+
+	t.Run("RevokeRefreshTokenFamily", func(t *testing.T) {
+		stores(t, func(t *testing.T, store Store) {
+			at := newTokenTest("084a4a0f-92cc-46e6-9b57-1d2aed3c389e", 1)
+			cached := NewAccessTokenRepository(newTokenRepoMock(), store, cacheConfigTest)
+			assert.Nil(t, cached.CreateWithRefreshToken(at, domain.RefreshToken{
+				RefreshToken: "b1e6c2d4-8f3a-4e5b-9c7d-0a1b2c3d4e5f",
+				FamilyId:     at.AccessToken,
+				AccessToken:  at.AccessToken,
+				Expires:      time.Now().Add(time.Hour).Unix(),
+			}))
+			cached.GetById(at.AccessToken)
+
+			assert.Nil(t, cached.RevokeRefreshTokenFamily(at.AccessToken))
+
+			_, err := cached.GetById(at.AccessToken)
+			assert.NotNil(t, err)
+		})
+	})
+}
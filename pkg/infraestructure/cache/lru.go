@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU is an in process Store that holds up to size entries, the least
+// recently used ones are evicted to make room. Each replica has its own, so
+// it only learns about the invalidations made by that same replica.
+type LRU struct {
+	size int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order has the most recently used entry at the front
+	order *list.List
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	members map[string]struct{}
+	expires time.Time
+}
+
+func NewLRU(size int) *LRU {
+	return &LRU{
+		size:    size,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+func (c *LRU) Get(key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.get(key)
+	if !ok || entry.members != nil {
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (c *LRU) Set(key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.put(&lruEntry{key: key, value: value, expires: time.Now().Add(ttl)})
+	return nil
+}
+
+func (c *LRU) Delete(keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		if e, ok := c.entries[key]; ok {
+			c.remove(e)
+		}
+	}
+	return nil
+}
+
+func (c *LRU) AddToSet(key string, member string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.get(key)
+	if !ok || entry.members == nil {
+		entry = &lruEntry{key: key, members: map[string]struct{}{}}
+	}
+	entry.members[member] = struct{}{}
+	entry.expires = time.Now().Add(ttl)
+	c.put(entry)
+	return nil
+}
+
+func (c *LRU) SetMembers(key string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	members := []string{}
+	if entry, ok := c.get(key); ok {
+		for member := range entry.members {
+			members = append(members, member)
+		}
+	}
+	return members, nil
+}
+
+// get returns the entry at key unless it has expired, and marks it as used
+func (c *LRU) get(key string) (*lruEntry, bool) {
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := e.Value.(*lruEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(e)
+		return nil, false
+	}
+
+	c.order.MoveToFront(e)
+	return entry, true
+}
+
+func (c *LRU) put(entry *lruEntry) {
+	if e, ok := c.entries[entry.key]; ok {
+		e.Value = entry
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.entries[entry.key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *LRU) remove(e *list.Element) {
+	c.order.Remove(e)
+	delete(c.entries, e.Value.(*lruEntry).key)
+}
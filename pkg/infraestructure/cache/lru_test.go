@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRU(t *testing.T) {
+	t.Run("EvictsLeastRecentlyUsed", func(t *testing.T) {
+		c := NewLRU(2)
+		c.Set("a", []byte("1"), time.Minute)
+		c.Set("b", []byte("2"), time.Minute)
+
+		// a is used, so b is the one evicted
+		c.Get("a")
+		c.Set("c", []byte("3"), time.Minute)
+
+		_, ok, _ := c.Get("a")
+		assert.True(t, ok)
+		_, ok, _ = c.Get("b")
+		assert.False(t, ok)
+		_, ok, _ = c.Get("c")
+		assert.True(t, ok)
+	})
+
+	t.Run("Expires", func(t *testing.T) {
+		c := NewLRU(2)
+		c.Set("a", []byte("1"), -time.Second)
+
+		_, ok, _ := c.Get("a")
+		assert.False(t, ok)
+		assert.Len(t, c.entries, 0)
+	})
+
+	t.Run("Sets", func(t *testing.T) {
+		c := NewLRU(2)
+		c.AddToSet("s", "a", time.Minute)
+		c.AddToSet("s", "b", time.Minute)
+
+		members, _ := c.SetMembers("s")
+		assert.ElementsMatch(t, []string{"a", "b"}, members)
+
+		// a set isn't a value
+		_, ok, _ := c.Get("s")
+		assert.False(t, ok)
+
+		c.Delete("s")
+		members, _ = c.SetMembers("s")
+		assert.Len(t, members, 0)
+	})
+}
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+const (
+	redisTimeout  = time.Second
+	redisPoolSize = 10
+)
+
+// Redis is a Store backed by a Redis server, so every replica sees the same
+// entries and invalidations
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis doesn't connect until the first command, password may be empty
+func NewRedis(addr string, password string) *Redis {
+	return &Redis{
+		client: redis.NewClient(&redis.Options{
+			Addr:         addr,
+			Password:     password,
+			DialTimeout:  redisTimeout,
+			ReadTimeout:  redisTimeout,
+			WriteTimeout: redisTimeout,
+			PoolSize:     redisPoolSize,
+		}),
+	}
+}
+
+func (r *Redis) Get(key string) ([]byte, bool, error) {
+	value, err := r.client.Get(key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (r *Redis) Set(key string, value []byte, ttl time.Duration) error {
+	return r.client.Set(key, value, millis(ttl)).Err()
+}
+
+func (r *Redis) Delete(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return r.client.Del(keys...).Err()
+}
+
+func (r *Redis) AddToSet(key string, member string, ttl time.Duration) error {
+	pipe := r.client.Pipeline()
+	pipe.SAdd(key, member)
+	pipe.PExpire(key, millis(ttl))
+	_, err := pipe.Exec()
+	return err
+}
+
+func (r *Redis) SetMembers(key string) ([]string, error) {
+	return r.client.SMembers(key).Result()
+}
+
+// millis rounds ttl down to what Redis can keep, a ttl under a millisecond
+// would be sent as no ttl at all
+func millis(ttl time.Duration) time.Duration {
+	if ttl < time.Millisecond {
+		return time.Millisecond
+	}
+	return ttl.Truncate(time.Millisecond)
+}
@@ -0,0 +1,278 @@
+package cache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// redisStub is an in memory stand-in for a Redis server, it speaks the
+// protocol for the commands the cache uses
+type redisStub struct {
+	listener net.Listener
+
+	mu      sync.Mutex
+	values  map[string]string
+	sets    map[string]map[string]struct{}
+	expires map[string]time.Time
+	down    bool
+}
+
+func newRedisStub(t *testing.T) (*Redis, *redisStub) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("couldn't start redis stub: %v", err)
+	}
+
+	stub := &redisStub{
+		listener: l,
+		values:   map[string]string{},
+		sets:     map[string]map[string]struct{}{},
+		expires:  map[string]time.Time{},
+	}
+	go stub.serve()
+	t.Cleanup(func() { l.Close() })
+
+	return NewRedis(l.Addr().String(), ""), stub
+}
+
+func (s *redisStub) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *redisStub) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		down := s.down
+		response := s.run(args)
+		s.mu.Unlock()
+		if down {
+			return
+		}
+
+		if _, err := conn.Write([]byte(response)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *redisStub) run(args []string) string {
+	cmd, key := strings.ToUpper(args[0]), ""
+	if len(args) > 1 {
+		key = args[1]
+		if expires, ok := s.expires[key]; ok && time.Now().After(expires) {
+			s.del(key)
+		}
+	}
+
+	switch cmd {
+	case "GET":
+		value, ok := s.values[key]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "SET":
+		s.del(key)
+		s.values[key] = args[2]
+		if len(args) == 5 {
+			switch strings.ToUpper(args[3]) {
+			case "PX":
+				s.expireIn(key, args[4])
+			case "EX":
+				s.expireIn(key, args[4]+"000")
+			}
+		}
+		return "+OK\r\n"
+	case "DEL":
+		for _, k := range args[1:] {
+			s.del(k)
+		}
+		return fmt.Sprintf(":%d\r\n", len(args)-1)
+	case "SADD":
+		if _, ok := s.values[key]; ok {
+			return "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+		}
+		if s.sets[key] == nil {
+			s.sets[key] = map[string]struct{}{}
+		}
+		s.sets[key][args[2]] = struct{}{}
+		return ":1\r\n"
+	case "PEXPIRE":
+		s.expireIn(key, args[2])
+		return ":1\r\n"
+	case "SMEMBERS":
+		reply := fmt.Sprintf("*%d\r\n", len(s.sets[key]))
+		for member := range s.sets[key] {
+			reply += fmt.Sprintf("$%d\r\n%s\r\n", len(member), member)
+		}
+		return reply
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+	}
+}
+
+// readCommand reads one command the way clients send them, as an array of
+// bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected command %q", line)
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, fmt.Errorf("unexpected argument %q", line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", errors.New("malformed command")
+	}
+	return line[:len(line)-2], nil
+}
+
+func (s *redisStub) expireIn(key string, ms string) {
+	n, _ := strconv.Atoi(ms)
+	s.expires[key] = time.Now().Add(time.Duration(n) * time.Millisecond)
+}
+
+func (s *redisStub) del(key string) {
+	delete(s.values, key)
+	delete(s.sets, key)
+	delete(s.expires, key)
+}
+
+// setDown makes the stub drop every connection without replying
+func (s *redisStub) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+func TestRedis(t *testing.T) {
+	t.Run("GetSetDelete", func(t *testing.T) {
+		r, _ := newRedisStub(t)
+
+		_, ok, err := r.Get("a")
+		assert.Nil(t, err)
+		assert.False(t, ok)
+
+		assert.Nil(t, r.Set("a", []byte("value\r\nwith a line break"), time.Minute))
+		value, ok, err := r.Get("a")
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		assert.EqualValues(t, "value\r\nwith a line break", value)
+
+		assert.Nil(t, r.Delete("a", "b"))
+		_, ok, _ = r.Get("a")
+		assert.False(t, ok)
+	})
+
+	t.Run("EmptyValue", func(t *testing.T) {
+		r, _ := newRedisStub(t)
+
+		assert.Nil(t, r.Set("a", []byte{}, time.Minute))
+		value, ok, err := r.Get("a")
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		assert.Len(t, value, 0)
+	})
+
+	t.Run("Expires", func(t *testing.T) {
+		r, _ := newRedisStub(t)
+
+		assert.Nil(t, r.Set("a", []byte("value"), time.Millisecond))
+		time.Sleep(5 * time.Millisecond)
+		_, ok, err := r.Get("a")
+		assert.Nil(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("Sets", func(t *testing.T) {
+		r, _ := newRedisStub(t)
+
+		assert.Nil(t, r.AddToSet("s", "a", time.Minute))
+		assert.Nil(t, r.AddToSet("s", "b", time.Minute))
+		members, err := r.SetMembers("s")
+		assert.Nil(t, err)
+		assert.ElementsMatch(t, []string{"a", "b"}, members)
+	})
+
+	t.Run("ErrorReply", func(t *testing.T) {
+		r, _ := newRedisStub(t)
+
+		assert.Nil(t, r.Set("a", []byte("value"), time.Minute))
+		err := r.AddToSet("a", "b", time.Minute)
+		assert.NotNil(t, err)
+
+		// the connection is still in sync after an error reply
+		value, ok, err := r.Get("a")
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		assert.EqualValues(t, "value", value)
+	})
+
+	t.Run("ErrorConnection", func(t *testing.T) {
+		r, stub := newRedisStub(t)
+		stub.setDown(true)
+
+		_, _, err := r.Get("a")
+		assert.NotNil(t, err)
+
+		stub.setDown(false)
+		_, _, err = r.Get("a")
+		assert.Nil(t, err)
+	})
+}
@@ -0,0 +1,16 @@
+package cache
+
+import "time"
+
+// Store keeps values for a while, either in process or in Redis
+type Store interface {
+	// Get returns false when key isn't stored or has expired
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	Delete(keys ...string) error
+
+	// AddToSet adds member to the set at key, the whole set expires ttl
+	// after the last member was added
+	AddToSet(key string, member string, ttl time.Duration) error
+	SetMembers(key string) ([]string, error)
+}
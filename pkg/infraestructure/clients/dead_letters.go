@@ -0,0 +1,98 @@
+package clients
+
+import "github.com/streadway/amqp"
+
+// DeadLetter is a users event that couldn't be handled
+type DeadLetter struct {
+	RoutingKey string
+	Reason     string
+	Retries    int
+	// UserId is zero when the body couldn't be decoded
+	UserId int64
+}
+
+// ListDeadLetters returns up to limit dead-lettered users events, they are
+// left in the queue
+func ListDeadLetters(url string, limit int) ([]DeadLetter, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	// closing the channel gives back every message that wasn't acked
+	defer ch.Close()
+
+	letters := []DeadLetter{}
+	for len(letters) < limit {
+		d, ok, err := ch.Get(usersDeadLetterQueue, false)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+
+		letter := DeadLetter{
+			RoutingKey: originalRoutingKey(d),
+			Retries:    headerInt(d.Headers, headerRetries),
+		}
+		if deaths, ok := d.Headers["x-death"].([]interface{}); ok && len(deaths) > 0 {
+			if death, ok := deaths[0].(amqp.Table); ok {
+				letter.Reason, _ = death["reason"].(string)
+			}
+		}
+		if event, err := decodeUserEvent(d); err == nil {
+			letter.UserId = event.User.Id
+		}
+
+		letters = append(letters, letter)
+	}
+
+	return letters, nil
+}
+
+// ReplayDeadLetters moves up to limit dead-lettered users events back into
+// the users queue with a fresh set of retries, it returns how many were
+// moved
+func ReplayDeadLetters(url string, limit int) (int, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return 0, err
+	}
+	defer ch.Close()
+
+	// the replayed events only go to this service, publishing them to the
+	// users exchange again would deliver them to every other consumer
+	replayed := 0
+	for replayed < limit {
+		d, ok, err := ch.Get(usersDeadLetterQueue, false)
+		if err != nil {
+			return replayed, err
+		}
+		if !ok {
+			break
+		}
+
+		headers := amqp.Table{headerOriginalRoutingKey: originalRoutingKey(d)}
+		if err := ch.Publish("", usersQueue, false, false, republishing(d, headers)); err != nil {
+			return replayed, err
+		}
+		if err := d.Ack(false); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+
+	return replayed, nil
+}
@@ -3,20 +3,13 @@ package clients
 import (
 	"database/sql"
 	"fmt"
-	"os"
 
+	"github.com/FacuBar/bookstore_oauth-api/pkg/infraestructure/config"
 	_ "github.com/go-sql-driver/mysql"
 )
 
-func ConnectDB() *sql.DB {
-	dataSourceName := fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8",
-		os.Getenv("MYSQL_USER"),
-		os.Getenv("MYSQL_PASSWORD"),
-		os.Getenv("MYSQL_ADDRESS"),
-		os.Getenv("MYSQL_DB"),
-	)
-
-	db, err := sql.Open("mysql", dataSourceName)
+func ConnectDB(c config.MySQL) *sql.DB {
+	db, err := sql.Open("mysql", c.DSN())
 	if err != nil {
 		panic(err.Error())
 	}
@@ -0,0 +1,241 @@
+package clients
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
+	"github.com/streadway/amqp"
+)
+
+const (
+	// oauthExchange is a topic exchange, consumers can bind to
+	// oauth.event.# to get every event
+	oauthExchange     = "oauth"
+	oauthEventVersion = 1
+
+	relayBatchSize = 100
+
+	// published events are kept a while to look into what was sent, then
+	// the leader purges them
+	publishedRetention = 24 * time.Hour
+	purgeBatchSize     = 1000
+)
+
+// oauthEventEnvelope is the same envelope the users events come in
+type oauthEventEnvelope struct {
+	Id         string            `json:"id"`
+	Type       string            `json:"type"`
+	Version    int               `json:"version"`
+	OccurredAt time.Time         `json:"occurred_at"`
+	Payload    domain.OAuthEvent `json:"payload"`
+}
+
+// OAuthEventRelay publishes the events in the outbox to the oauth exchange,
+// oldest first. Publishing is at least once: an event the broker didn't
+// confirm is published again, so consumers should skip the message ids
+// they already handled. Only the replica leading the outbox relays.
+type OAuthEventRelay struct {
+	url    string
+	outbox ports.OutboxRepository
+
+	mu       sync.Mutex
+	conn     *amqp.Connection
+	ch       *amqp.Channel
+	confirms chan amqp.Confirmation
+}
+
+func NewOAuthEventRelay(url string, outbox ports.OutboxRepository) *OAuthEventRelay {
+	return &OAuthEventRelay{
+		url:    url,
+		outbox: outbox,
+	}
+}
+
+// Start relays the pending events every interval until the returned func is
+// called, a broker that's down only delays the events
+func (r *OAuthEventRelay) Start(interval time.Duration) func() {
+	done := make(chan struct{})
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := r.Relay(); err != nil {
+					log.Printf("error while relaying oauth events: %v", err)
+				}
+			case <-done:
+				ticker.Stop()
+				r.mu.Lock()
+				r.close()
+				r.mu.Unlock()
+				r.outbox.Resign()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// Relay publishes every pending event when this replica leads the outbox
+// and purges the old published ones, it returns how many were published
+func (r *OAuthEventRelay) Relay() (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	leader, err := r.outbox.Lead()
+	if err != nil {
+		return 0, errors.New(err.Message())
+	}
+	if !leader {
+		// another replica may have taken over, this one's channel is idle
+		r.close()
+		return 0, nil
+	}
+
+	published, relayErr := r.relay()
+	if relayErr != nil {
+		return published, relayErr
+	}
+	return published, r.purge()
+}
+
+func (r *OAuthEventRelay) relay() (int, error) {
+	published := 0
+	for {
+		events, err := r.outbox.Pending(relayBatchSize)
+		if err != nil {
+			return published, errors.New(err.Message())
+		}
+		if len(events) == 0 {
+			return published, nil
+		}
+
+		ids := []string{}
+		var publishErr error
+		for _, event := range events {
+			if publishErr = r.publish(event); publishErr != nil {
+				// the channel may be broken, the next attempt opens a new one
+				r.close()
+				break
+			}
+			ids = append(ids, event.Id)
+		}
+
+		if err := r.outbox.MarkPublished(ids); err != nil {
+			return published, errors.New(err.Message())
+		}
+		published += len(ids)
+
+		if publishErr != nil {
+			return published, publishErr
+		}
+		if len(events) < relayBatchSize {
+			return published, nil
+		}
+	}
+}
+
+// purge deletes the events published before the retention in batches
+func (r *OAuthEventRelay) purge() error {
+	before := time.Now().Add(-publishedRetention)
+	for {
+		purged, err := r.outbox.PurgePublished(before, purgeBatchSize)
+		if err != nil {
+			return errors.New(err.Message())
+		}
+		if purged < purgeBatchSize {
+			return nil
+		}
+	}
+}
+
+// publish sends the event and waits for the broker to confirm it
+func (r *OAuthEventRelay) publish(event domain.OAuthEvent) error {
+	if r.ch == nil {
+		if err := r.open(); err != nil {
+			return err
+		}
+	}
+
+	body, err := json.Marshal(oauthEventEnvelope{
+		Id:         event.Id,
+		Type:       event.Type,
+		Version:    oauthEventVersion,
+		OccurredAt: event.OccurredAt,
+		Payload:    event,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := r.ch.Publish(oauthExchange, event.Type, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		MessageId:    event.Id,
+		Timestamp:    event.OccurredAt,
+		DeliveryMode: amqp.Persistent,
+		Body:         body,
+	}); err != nil {
+		return err
+	}
+
+	confirmation, ok := <-r.confirms
+	if !ok {
+		return errors.New("channel closed before the event was confirmed")
+	}
+	if !confirmation.Ack {
+		return errors.New("event not confirmed by the broker")
+	}
+	return nil
+}
+
+func (r *OAuthEventRelay) open() error {
+	conn, err := amqp.Dial(r.url)
+	if err != nil {
+		return err
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	if err := ch.ExchangeDeclare(
+		oauthExchange,
+		"topic",
+		true,
+		false,
+		false,
+		false,
+		nil,
+	); err != nil {
+		conn.Close()
+		return err
+	}
+
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return err
+	}
+
+	r.conn = conn
+	r.ch = ch
+	r.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+	return nil
+}
+
+func (r *OAuthEventRelay) close() {
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	r.conn = nil
+	r.ch = nil
+	r.confirms = nil
+}
@@ -1,33 +1,283 @@
 package clients
 
 import (
-	"bytes"
-	"encoding/gob"
-	"fmt"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
 
 	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
 	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
 	"github.com/streadway/amqp"
 )
 
+const (
+	usersExchange = "users"
+
+	// usersQueue outlives the service so no event is lost while it's down,
+	// messages that can't be handled end up in usersDeadLetterQueue
+	usersQueue               = "oauth.users"
+	usersDeadLetterExchange  = "oauth.users.dlx"
+	usersDeadLetterQueue     = "oauth.users.dead"
+	usersRetryQueuePrefix    = "oauth.users.retry."
+	headerRetries            = "x-retries"
+	headerOriginalRoutingKey = "x-original-routing-key"
+)
+
+var usersEvents = []string{domain.UserEventRegister, domain.UserEventUpdate, domain.UserEventDelete}
+
+// RabbitMQ consumes the users events. A message that fails is retried once
+// per delay in retryDelays, waiting that long in a delay queue before each
+// retry, and then dead-lettered. When the connection is lost it reconnects
+// on its own, backing off between attempts.
 type RabbitMQ struct {
-	Connection *amqp.Connection
-	Channel    *amqp.Channel
+	url         string
+	retryDelays []time.Duration
+	userS       ports.UsersRepository
+	ats         ports.AcessTokenService
+
+	mu        sync.Mutex
+	session   *rabbitSession
+	connected bool
+	closing   bool
+
+	// done is closed to stop reconnecting, stopped once the consumer is gone
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+type rabbitSession struct {
+	conn   *amqp.Connection
+	ch     *amqp.Channel
+	msgs   <-chan amqp.Delivery
+	closed chan *amqp.Error
 }
 
-func NewRabbitMQ(url string, userS ports.UsersRepository) (*RabbitMQ, error) {
-	conn, err := amqp.Dial(url)
+const (
+	consumerTag = "oauth-api"
+
+	reconnectMinBackoff = time.Second
+	reconnectMaxBackoff = time.Minute
+)
+
+// NewRabbitMQ fails if it can't connect the first time, after that it keeps
+// reconnecting until it's closed
+func NewRabbitMQ(url string, retryDelays []time.Duration, userS ports.UsersRepository, ats ports.AcessTokenService) (*RabbitMQ, error) {
+	r := &RabbitMQ{
+		url:         url,
+		retryDelays: retryDelays,
+		userS:       userS,
+		ats:         ats,
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+
+	s, err := r.connect()
 	if err != nil {
 		return nil, err
 	}
 
+	go r.run(s)
+
+	return r, nil
+}
+
+// Connected tells whether the consumer is connected to the broker right now
+func (r *RabbitMQ) Connected() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.connected
+}
+
+// Close stops consuming and waits for the messages already delivered to be
+// handled before closing the connection, or until ctx is done
+func (r *RabbitMQ) Close(ctx context.Context) error {
+	r.mu.Lock()
+	if r.closing {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closing = true
+	s := r.session
+	r.mu.Unlock()
+
+	close(r.done)
+	if s != nil {
+		// the deliveries channel is closed once the broker confirms, the
+		// ones it already sent are still handled
+		s.ch.Cancel(consumerTag, false)
+	}
+
+	var err error
+	select {
+	case <-r.stopped:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.session != nil {
+		r.session.conn.Close()
+	}
+	r.connected = false
+	return err
+}
+
+// run handles the deliveries of s, and reconnects every time the connection
+// is lost
+func (r *RabbitMQ) run(s *rabbitSession) {
+	defer close(r.stopped)
+
+	for {
+		err := r.consume(s)
+
+		select {
+		case <-r.done:
+			return
+		default:
+		}
+
+		r.mu.Lock()
+		r.connected = false
+		r.mu.Unlock()
+		log.Printf("rabbitmq connection lost: %v", err)
+
+		if s = r.reconnect(); s == nil {
+			return
+		}
+	}
+}
+
+func (r *RabbitMQ) consume(s *rabbitSession) error {
+	for {
+		select {
+		case d, ok := <-s.msgs:
+			if !ok {
+				return errors.New("deliveries channel closed")
+			}
+			r.handle(s.ch, d)
+
+		case err := <-s.closed:
+			if err == nil {
+				return errors.New("connection closed")
+			}
+			return err
+		}
+	}
+}
+
+// reconnect keeps trying to connect with an exponential backoff, it returns
+// nil if it's closed before it succeeds
+func (r *RabbitMQ) reconnect() *rabbitSession {
+	backoff := reconnectMinBackoff
+	for {
+		select {
+		case <-r.done:
+			return nil
+		case <-time.After(backoff):
+		}
+
+		s, err := r.connect()
+		if err == nil {
+			log.Println("rabbitmq reconnected")
+			return s
+		}
+		log.Printf("couldn't reconnect to rabbitmq, retrying in %v: %v", backoff, err)
+
+		if backoff *= 2; backoff > reconnectMaxBackoff {
+			backoff = reconnectMaxBackoff
+		}
+	}
+}
+
+// connect opens a connection, declares the whole topology again since the
+// broker may have lost it, and starts consuming
+func (r *RabbitMQ) connect() (*rabbitSession, error) {
+	conn, err := amqp.Dial(r.url)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := r.open(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Close may have been called while connecting
+	if r.closing {
+		conn.Close()
+		return nil, errors.New("closed")
+	}
+	r.session = s
+	r.connected = true
+	return s, nil
+}
+
+func (r *RabbitMQ) open(conn *amqp.Connection) (*rabbitSession, error) {
 	ch, err := conn.Channel()
 	if err != nil {
 		return nil, err
 	}
 
-	if err = ch.ExchangeDeclare(
-		"users",
+	if err := declareUsersTopology(ch, r.retryDelays); err != nil {
+		return nil, err
+	}
+
+	if err := ch.Qos(10, 0, false); err != nil {
+		return nil, err
+	}
+
+	msgs, err := ch.Consume(
+		usersQueue,  // queue
+		consumerTag, // consumer
+		false,       // auto ack
+		false,       // exclusive
+		false,       // no local
+		false,       // no wait
+		nil,         // args
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rabbitSession{
+		conn:   conn,
+		ch:     ch,
+		msgs:   msgs,
+		closed: conn.NotifyClose(make(chan *amqp.Error, 1)),
+	}, nil
+}
+
+func (r *RabbitMQ) handle(ch *amqp.Channel, d amqp.Delivery) {
+	routingKey := originalRoutingKey(d)
+
+	event, err := decodeUserEvent(d)
+	if err != nil {
+		// it will never decode, so it goes straight to the dead letters
+		log.Printf("couldn't decode message with routing key %v: %v", routingKey, err)
+		d.Nack(false, false)
+		return
+	}
+
+	if err := handleUserEvent(event, r.userS, r.ats); err != nil {
+		log.Printf("couldn't handle %v %v for user %v: %v", event.Type, event.Id, event.User.Id, err.Message())
+		retry(ch, d, routingKey, r.retryDelays)
+		return
+	}
+	d.Ack(false)
+}
+
+// declareUsersTopology declares the queue the events are consumed from, a
+// delay queue per retry delay and the dead letter queue
+func declareUsersTopology(ch *amqp.Channel, retryDelays []time.Duration) error {
+	if err := ch.ExchangeDeclare(
+		usersExchange,
 		"direct",
 		true,
 		false,
@@ -35,77 +285,157 @@ func NewRabbitMQ(url string, userS ports.UsersRepository) (*RabbitMQ, error) {
 		false,
 		nil,
 	); err != nil {
-		return nil, err
+		return err
 	}
 
-	q, err := ch.QueueDeclare(
-		"",    // name
-		false, // durable
-		false, // delete when unused
-		true,  // exclusive
-		false, // no-wait
-		nil,   // arguments
-	)
-	if err != nil {
-		return nil, err
+	if err := ch.ExchangeDeclare(
+		usersDeadLetterExchange,
+		"fanout",
+		true,
+		false,
+		false,
+		false,
+		nil,
+	); err != nil {
+		return err
 	}
 
-	events := []string{"users.event.register", "users.event.update", "users.event.delete"}
+	if _, err := ch.QueueDeclare(
+		usersDeadLetterQueue, // name
+		true,                 // durable
+		false,                // delete when unused
+		false,                // exclusive
+		false,                // no-wait
+		nil,                  // arguments
+	); err != nil {
+		return err
+	}
+	if err := ch.QueueBind(usersDeadLetterQueue, "", usersDeadLetterExchange, false, nil); err != nil {
+		return err
+	}
 
-	for _, event := range events {
-		if err = ch.QueueBind(
-			q.Name,  // queue name
-			event,   // routing key
-			"users", // exchange
+	if _, err := ch.QueueDeclare(
+		usersQueue, // name
+		true,       // durable
+		false,      // delete when unused
+		false,      // exclusive
+		false,      // no-wait
+		amqp.Table{"x-dead-letter-exchange": usersDeadLetterExchange},
+	); err != nil {
+		return err
+	}
+
+	for _, event := range usersEvents {
+		if err := ch.QueueBind(
+			usersQueue,    // queue name
+			event,         // routing key
+			usersExchange, // exchange
 			false,
 			nil,
 		); err != nil {
-			return nil, err
+			return err
 		}
 	}
 
-	msgs, err := ch.Consume(
-		q.Name, // queue
-		"",     // consumer
-		false,  // auto ack
-		false,  // exclusive
-		false,  // no local
-		false,  // no wait
-		nil,    // args
-	)
-	if err != nil {
-		return nil, err
+	// messages wait in a delay queue until they expire, then they are
+	// dead-lettered back into the users queue through the default exchange
+	for _, delay := range retryDelays {
+		if _, err := ch.QueueDeclare(
+			retryQueue(delay),
+			true,
+			false,
+			false,
+			false,
+			amqp.Table{
+				"x-message-ttl":             int64(delay / time.Millisecond),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": usersQueue,
+			},
+		); err != nil {
+			return err
+		}
 	}
 
-	go func() {
-		for d := range msgs {
-			body := d.Body
-			reader := bytes.NewReader(body)
-			var user domain.User
-
-			gob.NewDecoder(reader).Decode(&user)
-
-			fmt.Printf("message received: %v\nwith routing key: %v\n", user, d.RoutingKey)
-			switch d.RoutingKey {
-			case "users.event.register":
-				err := userS.Save(&user)
-				if err == nil {
-					d.Ack(false)
-				}
-			case "users.event.update":
-				fmt.Printf("%v to be implemented", d.RoutingKey)
-			case "users.event.delete":
-				fmt.Printf("%v to be implemented", d.RoutingKey)
-			}
-		}
-	}()
+	return nil
+}
 
-	return &RabbitMQ{
-		Connection: conn,
-		Channel:    ch,
-	}, nil
+// retry sends a failed message to the delay queue of its next attempt, or
+// dead-letters it once it has run out of attempts
+func retry(ch *amqp.Channel, d amqp.Delivery, routingKey string, retryDelays []time.Duration) {
+	retries := headerInt(d.Headers, headerRetries)
+	if retries >= len(retryDelays) {
+		d.Nack(false, false)
+		return
+	}
+
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[headerRetries] = int32(retries + 1)
+	headers[headerOriginalRoutingKey] = routingKey
+
+	if err := ch.Publish("", retryQueue(retryDelays[retries]), false, false, republishing(d, headers)); err != nil {
+		// the retry couldn't be scheduled, it's retried right away instead
+		d.Nack(false, true)
+		return
+	}
+	d.Ack(false)
+}
+
+// republishing copies d to be published again with headers
+func republishing(d amqp.Delivery, headers amqp.Table) amqp.Publishing {
+	return amqp.Publishing{
+		Headers:      headers,
+		ContentType:  d.ContentType,
+		MessageId:    d.MessageId,
+		Timestamp:    d.Timestamp,
+		DeliveryMode: amqp.Persistent,
+		Body:         d.Body,
+	}
+}
+
+func retryQueue(delay time.Duration) string {
+	return usersRetryQueuePrefix + delay.String()
+}
+
+// originalRoutingKey is the routing key the event was published with, the
+// delay queues route retried messages with the name of the users queue
+func originalRoutingKey(d amqp.Delivery) string {
+	if key, ok := d.Headers[headerOriginalRoutingKey].(string); ok {
+		return key
+	}
+	return d.RoutingKey
 }
 
-func (r *RabbitMQ) Close() {
-	r.Connection.Close()
+func headerInt(headers amqp.Table, key string) int {
+	switch v := headers[key].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	default:
+		return 0
+	}
+}
+
+// handleUserEvent applies the event to the users replica, a user that is
+// deleted or whose role or password changes loses every token issued to
+// them. Events that were already applied, or that are older than the last
+// one applied, change nothing. The event is only recorded as applied once
+// the tokens are revoked, so a failed revocation is retried with it.
+func handleUserEvent(event *domain.UserEvent, userS ports.UsersRepository, ats ports.AcessTokenService) rest_errors.RestErr {
+	_, err := userS.Apply(event, func(result *domain.UserEventResult) rest_errors.RestErr {
+		previous := result.Previous
+		switch {
+		case event.Type == domain.UserEventDelete,
+			previous != nil && (previous.Role != event.User.Role || previous.Password != event.User.Password):
+			return ats.RevokeUserTokens(event.User.Id)
+		default:
+			return nil
+		}
+	})
+	return err
 }
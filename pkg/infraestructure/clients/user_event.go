@@ -0,0 +1,128 @@
+package clients
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"time"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/streadway/amqp"
+)
+
+const (
+	contentTypeJSON = "application/json"
+	// contentTypeGob is what the users service used to publish, messages
+	// without a content type are taken as gob too
+	contentTypeGob = "application/x-gob"
+
+	userEventVersion = 1
+)
+
+// userEventEnvelope is the JSON schema of the users events
+type userEventEnvelope struct {
+	Id         string    `json:"id"`
+	Type       string    `json:"type"`
+	Version    int       `json:"version"`
+	OccurredAt time.Time `json:"occurred_at"`
+	// UserVersion orders the events of the same user
+	UserVersion int64           `json:"user_version"`
+	Payload     json.RawMessage `json:"payload"`
+}
+
+// decodeUserEvent decodes the event with the decoder its content type asks
+// for, any event that decodes to something unusable is an error
+func decodeUserEvent(d amqp.Delivery) (*domain.UserEvent, error) {
+	contentType := contentTypeGob
+	if d.ContentType != "" {
+		mediaType, _, err := mime.ParseMediaType(d.ContentType)
+		if err != nil {
+			return nil, fmt.Errorf("invalid content type %q", d.ContentType)
+		}
+		contentType = mediaType
+	}
+
+	var event *domain.UserEvent
+	var err error
+	switch contentType {
+	case contentTypeJSON:
+		event, err = decodeJSONUserEvent(d.Body)
+	case contentTypeGob:
+		event, err = decodeGobUserEvent(d)
+	default:
+		return nil, fmt.Errorf("content type %q not supported", d.ContentType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateUserEvent(event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+func decodeJSONUserEvent(body []byte) (*domain.UserEvent, error) {
+	var envelope userEventEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, err
+	}
+	if envelope.Version != userEventVersion {
+		return nil, fmt.Errorf("event version %d not supported", envelope.Version)
+	}
+	if len(envelope.Payload) == 0 {
+		return nil, errors.New("event has no payload")
+	}
+
+	event := domain.UserEvent{
+		Id:          envelope.Id,
+		Type:        envelope.Type,
+		Version:     envelope.Version,
+		OccurredAt:  envelope.OccurredAt,
+		UserVersion: envelope.UserVersion,
+	}
+	if err := json.Unmarshal(envelope.Payload, &event.User); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// decodeGobUserEvent reads the legacy events, a bare gob encoded user whose
+// type is its routing key
+func decodeGobUserEvent(d amqp.Delivery) (*domain.UserEvent, error) {
+	event := domain.UserEvent{
+		Id:         d.MessageId,
+		Type:       originalRoutingKey(d),
+		OccurredAt: d.Timestamp,
+	}
+	if err := gob.NewDecoder(bytes.NewReader(d.Body)).Decode(&event.User); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func validateUserEvent(event *domain.UserEvent) error {
+	if event.User.Id <= 0 {
+		return errors.New("event has no user id")
+	}
+	// the id is what tells a redelivered event apart from a new one, only
+	// the legacy gob events, which have no version, may come without it
+	if event.Version > 0 && event.Id == "" {
+		return errors.New("event has no id")
+	}
+
+	switch event.Type {
+	case domain.UserEventRegister, domain.UserEventUpdate:
+		if event.User.Email == "" || event.User.Role == "" {
+			return errors.New("event user is incomplete")
+		}
+		return nil
+	case domain.UserEventDelete:
+		return nil
+	default:
+		return fmt.Errorf("unknown event type %q", event.Type)
+	}
+}
@@ -0,0 +1,98 @@
+package clients
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+	"time"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeUserEvent(t *testing.T) {
+	t.Run("JSON", func(t *testing.T) {
+		d := amqp.Delivery{
+			ContentType: "application/json; charset=utf-8",
+			RoutingKey:  domain.UserEventUpdate,
+			Body: []byte(`{"id": "0d9c2f0e-6b1a-4d55-9d3e-2a1f0c7b8e44", "type": "users.event.update", "version": 1,
+				"occurred_at": "2021-11-20T15:04:05Z",
+				"user_version": 4,
+				"payload": {"id": 1, "email": "jane@bookstore.com", "password": "$2a$10$hash", "role": "admin"}}`),
+		}
+
+		event, err := decodeUserEvent(d)
+
+		assert.Nil(t, err)
+		assert.EqualValues(t, "0d9c2f0e-6b1a-4d55-9d3e-2a1f0c7b8e44", event.Id)
+		assert.EqualValues(t, domain.UserEventUpdate, event.Type)
+		assert.EqualValues(t, time.Date(2021, 11, 20, 15, 4, 5, 0, time.UTC), event.OccurredAt.UTC())
+		assert.EqualValues(t, 4, event.UserVersion)
+		assert.EqualValues(t, 1, event.User.Id)
+		assert.EqualValues(t, "admin", event.User.Role)
+	})
+
+	t.Run("LegacyGob", func(t *testing.T) {
+		var body bytes.Buffer
+		gob.NewEncoder(&body).Encode(domain.User{Id: 1, Email: "jane@bookstore.com", Role: "user"})
+
+		// retried messages carry the routing key they were published with
+		d := amqp.Delivery{
+			RoutingKey: usersQueue,
+			Headers:    amqp.Table{headerOriginalRoutingKey: domain.UserEventRegister},
+			Body:       body.Bytes(),
+		}
+
+		event, err := decodeUserEvent(d)
+
+		assert.Nil(t, err)
+		assert.EqualValues(t, domain.UserEventRegister, event.Type)
+		assert.EqualValues(t, "jane@bookstore.com", event.User.Email)
+	})
+
+	t.Run("ErrorUnsupportedVersion", func(t *testing.T) {
+		d := amqp.Delivery{
+			ContentType: "application/json",
+			Body:        []byte(`{"type": "users.event.delete", "version": 2, "payload": {"id": 1}}`),
+		}
+
+		event, err := decodeUserEvent(d)
+
+		assert.Nil(t, event)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ErrorZeroValueUser", func(t *testing.T) {
+		d := amqp.Delivery{
+			ContentType: "application/json",
+			Body:        []byte(`{"type": "users.event.register", "version": 1, "payload": {}}`),
+		}
+
+		event, err := decodeUserEvent(d)
+
+		assert.Nil(t, event)
+		assert.EqualValues(t, "event has no user id", err.Error())
+	})
+
+	t.Run("ErrorNoEventId", func(t *testing.T) {
+		d := amqp.Delivery{
+			ContentType: "application/json",
+			Body:        []byte(`{"type": "users.event.delete", "version": 1, "payload": {"id": 1}}`),
+		}
+
+		event, err := decodeUserEvent(d)
+
+		assert.Nil(t, event)
+		assert.EqualValues(t, "event has no id", err.Error())
+	})
+
+	t.Run("ErrorUnsupportedContentType", func(t *testing.T) {
+		d := amqp.Delivery{ContentType: "text/plain", Body: []byte("1")}
+
+		event, err := decodeUserEvent(d)
+
+		assert.Nil(t, event)
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,176 @@
+package clients
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/infraestructure/config"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+)
+
+// usersAPIMetrics are published on /debug/vars, counters add up since the
+// process started
+var usersAPIMetrics = expvar.NewMap("users_api")
+
+// usersAPIClient logs users in through the users service. Requests that
+// fail to reach it or get a 5xx are retried, logins that still fail count
+// against a breaker that makes the next ones fail right away.
+type usersAPIClient struct {
+	rest    *http.Client
+	url     string
+	retries int
+	backoff time.Duration
+	breaker *breaker
+}
+
+func NewUsersAPIClient(c config.UsersAPI) ports.UsersAPIClient {
+	return &usersAPIClient{
+		rest:    &http.Client{Timeout: c.Timeout},
+		url:     strings.TrimSuffix(c.URL, "/"),
+		retries: c.Retries,
+		backoff: c.RetryBackoff,
+		breaker: &breaker{
+			failures: c.BreakerFailures,
+			cooldown: c.BreakerCooldown,
+			now:      time.Now,
+		},
+	}
+}
+
+func usersAPIUnavailable() rest_errors.RestErr {
+	return rest_errors.NewRestError("users service unavailable", http.StatusServiceUnavailable, "service_unavailable")
+}
+
+func (u *usersAPIClient) LoginUser(email, password string) (*domain.User, rest_errors.RestErr) {
+	if !u.breaker.allow() {
+		usersAPIMetrics.Add("rejected", 1)
+		return nil, usersAPIUnavailable()
+	}
+
+	request := struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}{
+		Email:    email,
+		Password: password,
+	}
+	jsonReq, _ := json.Marshal(request)
+
+	for attempt := 0; ; attempt++ {
+		user, err, unavailable := u.login(jsonReq)
+		if !unavailable {
+			// wrong credentials are an answer too, the service is up
+			u.breaker.done(true)
+			return user, err
+		}
+		if attempt == u.retries {
+			usersAPIMetrics.Add("unavailable", 1)
+			u.breaker.done(false)
+			return nil, usersAPIUnavailable()
+		}
+
+		usersAPIMetrics.Add("retries", 1)
+		time.Sleep(u.wait(attempt))
+	}
+}
+
+// login makes a single attempt, unavailable tells whether it's worth
+// retrying
+func (u *usersAPIClient) login(jsonReq []byte) (user *domain.User, restErr rest_errors.RestErr, unavailable bool) {
+	response, err := u.rest.Post(u.url+"/users/login", "application/json", bytes.NewReader(jsonReq))
+	if err != nil {
+		log.Printf("error while calling the users service: %v", err)
+		return nil, nil, true
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusInternalServerError {
+		log.Printf("users service answered %d", response.StatusCode)
+		return nil, nil, true
+	}
+
+	if response.StatusCode > 299 {
+		bodyBytes, _ := io.ReadAll(response.Body)
+		restErr, err := rest_errors.NewRestErrorFromBytes(bodyBytes)
+		if err != nil {
+			return nil, rest_errors.NewInternalServerError("invalid restclient response"), false
+		}
+		return nil, restErr, false
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(&user); err != nil {
+		return nil, rest_errors.NewInternalServerError("error when trying to unmarshal users response"), false
+	}
+	return user, nil, false
+}
+
+// wait is a random time up to the backoff doubled on every attempt, so
+// replicas retrying together spread out
+func (u *usersAPIClient) wait(attempt int) time.Duration {
+	ceiling := u.backoff << uint(attempt)
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)))
+}
+
+// breaker opens once failures logins in a row failed. While it's open
+// logins fail right away, after the cooldown a single one is let through
+// and its outcome closes or opens the breaker again.
+type breaker struct {
+	failures int
+	cooldown time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	failed   int
+	openedAt time.Time
+	probing  bool
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failed < b.failures {
+		return true
+	}
+	if b.probing || b.now().Sub(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *breaker) done(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if ok {
+		if b.failed >= b.failures {
+			log.Println("users service is back, breaker closed")
+		}
+		b.failed = 0
+		return
+	}
+
+	b.failed++
+	if b.failed >= b.failures {
+		if b.failed == b.failures {
+			usersAPIMetrics.Add("breaker_opened", 1)
+			log.Printf("users service failed %d times in a row, breaker open for %v", b.failed, b.cooldown)
+		}
+		b.openedAt = b.now()
+	}
+}
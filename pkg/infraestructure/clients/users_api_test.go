@@ -0,0 +1,188 @@
+package clients
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/infraestructure/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// newUsersAPITest returns a client of a users service answering with
+// handler, and how many requests it got
+func newUsersAPITest(t *testing.T, handler http.HandlerFunc) (*usersAPIClient, *int32) {
+	var requests int32
+	testServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		handler(rw, req)
+	}))
+	t.Cleanup(testServer.Close)
+
+	client := NewUsersAPIClient(config.UsersAPI{
+		URL:             testServer.URL + "/",
+		Timeout:         100 * time.Millisecond,
+		Retries:         2,
+		RetryBackoff:    time.Millisecond,
+		BreakerFailures: 2,
+		BreakerCooldown: time.Minute,
+	})
+	return client.(*usersAPIClient), &requests
+}
+
+func TestLoginUser(t *testing.T) {
+	t.Run("NoError", func(t *testing.T) {
+		client, _ := newUsersAPITest(t, func(rw http.ResponseWriter, req *http.Request) {
+			assert.EqualValues(t, "/users/login", req.URL.Path)
+			rw.WriteHeader(http.StatusOK)
+			rw.Write([]byte(`{"id":1,"first_name":"Oscar","last_name":"Isaac","email": "oscaac@gmail.com","date_created": "2021-11-19 03:07:42","role":"user"}`))
+		})
+
+		user, err := client.LoginUser("oscaac@gmail.com", "password")
+
+		assert.Nil(t, err)
+		assert.NotNil(t, user)
+		assert.EqualValues(t, 1, user.Id)
+		assert.EqualValues(t, "oscaac@gmail.com", user.Email)
+	})
+
+	t.Run("ErrorReceivedFromRequest", func(t *testing.T) {
+		client, requests := newUsersAPITest(t, func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(`{"message": "Invalid credentials","status": 400,"error": "bad_request"}`))
+		})
+
+		user, err := client.LoginUser("oscaac@gmail.com", "password")
+
+		assert.Nil(t, user)
+		assert.NotNil(t, err)
+		assert.EqualValues(t, http.StatusBadRequest, err.Status())
+		assert.EqualValues(t, "Invalid credentials", err.Message())
+		// wrong credentials aren't retried
+		assert.EqualValues(t, 1, atomic.LoadInt32(requests))
+	})
+
+	t.Run("ErrorUnmarshalingErrorResponse", func(t *testing.T) {
+		client, _ := newUsersAPITest(t, func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(`{"message": "Invalid credentials","status": "400","error": "bad_request"}`))
+		})
+
+		user, err := client.LoginUser("oscaac@gmail.com", "password")
+
+		assert.Nil(t, user)
+		assert.NotNil(t, err)
+		assert.EqualValues(t, "invalid restclient response", err.Message())
+	})
+
+	t.Run("ErrorUnmarshalingUserResponse", func(t *testing.T) {
+		client, _ := newUsersAPITest(t, func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(http.StatusOK)
+			rw.Write([]byte(`{"id":"1","first_name":"Oscar","last_name":"Isaac"}`))
+		})
+
+		user, err := client.LoginUser("oscaac@gmail.com", "password")
+
+		assert.Nil(t, user)
+		assert.NotNil(t, err)
+		assert.EqualValues(t, "error when trying to unmarshal users response", err.Message())
+	})
+
+	t.Run("RetriedAfterServerError", func(t *testing.T) {
+		var calls int32
+		client, requests := newUsersAPITest(t, func(rw http.ResponseWriter, req *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				rw.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			rw.WriteHeader(http.StatusOK)
+			rw.Write([]byte(`{"id":1,"email": "oscaac@gmail.com","role":"user"}`))
+		})
+
+		user, err := client.LoginUser("oscaac@gmail.com", "password")
+
+		assert.Nil(t, err)
+		assert.EqualValues(t, 1, user.Id)
+		assert.EqualValues(t, 2, atomic.LoadInt32(requests))
+	})
+
+	t.Run("ErrorTimeout", func(t *testing.T) {
+		client, requests := newUsersAPITest(t, func(rw http.ResponseWriter, req *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		})
+
+		user, err := client.LoginUser("oscaac@gmail.com", "password")
+
+		assert.Nil(t, user)
+		assert.NotNil(t, err)
+		assert.EqualValues(t, http.StatusServiceUnavailable, err.Status())
+		assert.EqualValues(t, "users service unavailable", err.Message())
+		// the first attempt and both retries
+		assert.EqualValues(t, 3, atomic.LoadInt32(requests))
+	})
+
+	t.Run("ErrorSendingRequest", func(t *testing.T) {
+		testServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}))
+		testServer.Close()
+		client := NewUsersAPIClient(config.UsersAPI{URL: testServer.URL, Timeout: time.Second, BreakerFailures: 1, BreakerCooldown: time.Minute})
+
+		user, err := client.LoginUser("oscaac@gmail.com", "password")
+
+		assert.Nil(t, user)
+		assert.NotNil(t, err)
+		assert.EqualValues(t, http.StatusServiceUnavailable, err.Status())
+	})
+}
+
+func TestLoginUserBreaker(t *testing.T) {
+	var down int32 = 1
+	client, requests := newUsersAPITest(t, func(rw http.ResponseWriter, req *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+		rw.Write([]byte(`{"id":1,"email": "oscaac@gmail.com","role":"user"}`))
+	})
+	now := time.Now()
+	client.breaker.now = func() time.Time { return now }
+
+	// two logins failing after their retries open the breaker
+	for i := 0; i < 2; i++ {
+		_, err := client.LoginUser("oscaac@gmail.com", "password")
+		assert.EqualValues(t, http.StatusServiceUnavailable, err.Status())
+	}
+	assert.EqualValues(t, 6, atomic.LoadInt32(requests))
+
+	t.Run("Open", func(t *testing.T) {
+		user, err := client.LoginUser("oscaac@gmail.com", "password")
+
+		assert.Nil(t, user)
+		assert.EqualValues(t, http.StatusServiceUnavailable, err.Status())
+		assert.EqualValues(t, 6, atomic.LoadInt32(requests))
+	})
+
+	t.Run("ProbeFails", func(t *testing.T) {
+		now = now.Add(time.Minute)
+
+		_, err := client.LoginUser("oscaac@gmail.com", "password")
+
+		assert.EqualValues(t, http.StatusServiceUnavailable, err.Status())
+		assert.EqualValues(t, 9, atomic.LoadInt32(requests))
+		// the cooldown starts over
+		assert.False(t, client.breaker.allow())
+	})
+
+	t.Run("ProbeSucceeds", func(t *testing.T) {
+		now = now.Add(time.Minute)
+		atomic.StoreInt32(&down, 0)
+
+		user, err := client.LoginUser("oscaac@gmail.com", "password")
+
+		assert.Nil(t, err)
+		assert.EqualValues(t, 1, user.Id)
+		assert.True(t, client.breaker.allow())
+	})
+}
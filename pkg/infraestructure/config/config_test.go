@@ -0,0 +1,134 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clearEnv unsets every setting for the test, so the environment running
+// the tests can't leak in
+func clearEnv(t *testing.T) {
+	c := Default()
+	for _, s := range append(c.settings(), setting{env: "CONFIG_FILE"}) {
+		if value, ok := os.LookupEnv(s.env); ok {
+			os.Unsetenv(s.env)
+			env, value := s.env, value
+			t.Cleanup(func() { os.Setenv(env, value) })
+		}
+	}
+}
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.Nil(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	clearEnv(t)
+
+	c, args, err := Load([]string{"migrate", "up"})
+
+	require.Nil(t, err)
+	assert.EqualValues(t, Default().HTTP, c.HTTP)
+	assert.EqualValues(t, "mysql", c.Storage.Backend)
+	assert.EqualValues(t, []string{"migrate", "up"}, args)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, `
+http:
+  addr: ":9000"
+  issuer: https://auth.bookstore.com
+grpc:
+  addr: ":9001"
+rabbitmq:
+  retry_delays: [2s, 1m]
+tokens:
+  role_scopes:
+    user: [books:read]
+cache:
+  ttl: 1m
+`)
+	t.Setenv("GRPC_SERVER", ":9002")
+	t.Setenv("OAUTH_TOKEN_CACHE_TTL", "2m")
+	// empty variables, as keys with no value in .env, are ignored
+	t.Setenv("PORT", "")
+
+	c, _, err := Load([]string{"-config", path, "-cache.ttl", "3m"})
+
+	require.Nil(t, err)
+	// the file wins over the defaults
+	assert.EqualValues(t, ":9000", c.HTTP.Addr)
+	assert.EqualValues(t, "https://auth.bookstore.com", c.HTTP.Issuer)
+	assert.EqualValues(t, []time.Duration{2 * time.Second, time.Minute}, c.RabbitMQ.RetryDelays)
+	assert.EqualValues(t, map[string][]string{"user": {"books:read"}}, c.Tokens.RoleScopes)
+	// the env wins over the file
+	assert.EqualValues(t, ":9002", c.GRPC.Addr)
+	// and the flags over the env
+	assert.EqualValues(t, 3*time.Minute, c.Cache.TTL)
+}
+
+func TestLoadEnv(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("RMQ_RETRY_DELAYS", "1s, 10s")
+	t.Setenv("OAUTH_ROLE_SCOPES", "user=books:read orders:write;admin=books:write")
+	t.Setenv("MIGRATE_ON_START", "true")
+
+	c, _, err := Load(nil)
+
+	require.Nil(t, err)
+	assert.EqualValues(t, []time.Duration{time.Second, 10 * time.Second}, c.RabbitMQ.RetryDelays)
+	assert.EqualValues(t, []string{"books:read", "orders:write"}, c.Tokens.RoleScopes["user"])
+	assert.True(t, c.Migrate.OnStart)
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Run("InvalidValues", func(t *testing.T) {
+		clearEnv(t)
+		t.Setenv("OAUTH_SESSION_LIMIT", "five")
+		t.Setenv("JANITOR_INTERVAL", "often")
+
+		_, _, err := Load(nil)
+
+		require.NotNil(t, err)
+		assert.Contains(t, err.Error(), `tokens.session_limit (env OAUTH_SESSION_LIMIT): "five" isn't a number`)
+		assert.Contains(t, err.Error(), `janitor.interval (env JANITOR_INTERVAL): "often" isn't a duration`)
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		clearEnv(t)
+
+		_, _, err := Load([]string{"-storage.backend", "postgres", "-tokens.format", "paseto", "-users_api.url", "users:8080", "-cache.ttl", "30s", "-cache.replicas", "3"})
+
+		require.NotNil(t, err)
+		assert.Contains(t, err.Error(), "storage.postgres_dsn (env POSTGRES_DSN): must be set when the storage backend is postgres")
+		assert.Contains(t, err.Error(), "tokens.format (env TOKEN_FORMAT): must be opaque or jwt")
+		assert.Contains(t, err.Error(), "users_api.url (env USERS_API_URL): must be an http or https url")
+		assert.Contains(t, err.Error(), "cache.redis_addr (env REDIS_ADDR): must be set when tokens are cached by more than one replica")
+	})
+
+	t.Run("UnknownFileKey", func(t *testing.T) {
+		clearEnv(t)
+		path := writeConfig(t, "http:\n  adr: \":9000\"\n")
+
+		_, _, err := Load([]string{"-config", path})
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("MissingFile", func(t *testing.T) {
+		clearEnv(t)
+
+		_, _, err := Load([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml")})
+
+		assert.NotNil(t, err)
+	})
+}
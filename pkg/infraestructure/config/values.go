@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+)
+
+// the values below parse settings given as text, in env variables and
+// flags, into the fields of Config. They are flag.Values so flags can use
+// them too.
+
+type stringValue struct{ p *string }
+
+func (v stringValue) Set(s string) error { *v.p = s; return nil }
+func (v stringValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return *v.p
+}
+
+type intValue struct{ p *int }
+
+func (v intValue) Set(s string) error {
+	i, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("%q isn't a number", s)
+	}
+	*v.p = i
+	return nil
+}
+func (v intValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return strconv.Itoa(*v.p)
+}
+
+type boolValue struct{ p *bool }
+
+func (v boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("%q isn't true or false", s)
+	}
+	*v.p = b
+	return nil
+}
+func (v boolValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return strconv.FormatBool(*v.p)
+}
+
+// IsBoolFlag lets the flag be given as -name alone
+func (v boolValue) IsBoolFlag() bool { return true }
+
+type durationValue struct{ p *time.Duration }
+
+func (v durationValue) Set(s string) error {
+	d, err := time.ParseDuration(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("%q isn't a duration such as 30s or 5m", s)
+	}
+	*v.p = d
+	return nil
+}
+func (v durationValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return v.p.String()
+}
+
+// durationsValue is a comma separated list of durations
+type durationsValue struct{ p *[]time.Duration }
+
+func (v durationsValue) Set(s string) error {
+	durations := []time.Duration{}
+	for _, part := range strings.Split(s, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil {
+			return fmt.Errorf("%q isn't a duration such as 30s or 5m", part)
+		}
+		durations = append(durations, d)
+	}
+	*v.p = durations
+	return nil
+}
+func (v durationsValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	parts := []string{}
+	for _, d := range *v.p {
+		parts = append(parts, d.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// roleScopesValue is the scopes allowed to each role, as in
+// "user=books:read;admin=books:read books:write"
+type roleScopesValue struct{ p *map[string][]string }
+
+func (v roleScopesValue) Set(s string) error {
+	roleScopes := map[string][]string{}
+	for _, entry := range strings.Split(s, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return fmt.Errorf("%q isn't role=scopes", entry)
+		}
+		roleScopes[strings.TrimSpace(parts[0])] = domain.ParseScopes(parts[1])
+	}
+	*v.p = roleScopes
+	return nil
+}
+func (v roleScopesValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	entries := []string{}
+	for role, scopes := range *v.p {
+		entries = append(entries, role+"="+domain.FormatScopes(scopes))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ";")
+}
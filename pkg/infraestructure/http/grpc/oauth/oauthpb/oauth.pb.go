@@ -24,6 +24,31 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
+type ValidateTokenResponse_SubjectType int32
+
+const (
+	ValidateTokenResponse_USER   ValidateTokenResponse_SubjectType = 0
+	ValidateTokenResponse_CLIENT ValidateTokenResponse_SubjectType = 1
+)
+
+var ValidateTokenResponse_SubjectType_name = map[int32]string{
+	0: "USER",
+	1: "CLIENT",
+}
+
+var ValidateTokenResponse_SubjectType_value = map[string]int32{
+	"USER":   0,
+	"CLIENT": 1,
+}
+
+func (x ValidateTokenResponse_SubjectType) String() string {
+	return proto.EnumName(ValidateTokenResponse_SubjectType_name, int32(x))
+}
+
+func (ValidateTokenResponse_SubjectType) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_d66fdbd4a55bbcce, []int{1, 0}
+}
+
 type ValidateTokenResponse_UserPayload_Role int32
 
 const (
@@ -54,6 +79,7 @@ func (ValidateTokenResponse_UserPayload_Role) EnumDescriptor() ([]byte, []int) {
 
 type ValidateTokenRequest struct {
 	AccessToken          string   `protobuf:"bytes,1,opt,name=access_token,json=accessToken,proto3" json:"access_token,omitempty"`
+	RequiredScopes       []string `protobuf:"bytes,2,rep,name=required_scopes,json=requiredScopes,proto3" json:"required_scopes,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -91,11 +117,21 @@ func (m *ValidateTokenRequest) GetAccessToken() string {
 	return ""
 }
 
+func (m *ValidateTokenRequest) GetRequiredScopes() []string {
+	if m != nil {
+		return m.RequiredScopes
+	}
+	return nil
+}
+
 type ValidateTokenResponse struct {
-	UserPayload          *ValidateTokenResponse_UserPayload `protobuf:"bytes,1,opt,name=user_payload,json=userPayload,proto3" json:"user_payload,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}                           `json:"-"`
-	XXX_unrecognized     []byte                             `json:"-"`
-	XXX_sizecache        int32                              `json:"-"`
+	UserPayload          *ValidateTokenResponse_UserPayload   `protobuf:"bytes,1,opt,name=user_payload,json=userPayload,proto3" json:"user_payload,omitempty"`
+	SubjectType          ValidateTokenResponse_SubjectType    `protobuf:"varint,2,opt,name=subject_type,json=subjectType,proto3,enum=oauth.ValidateTokenResponse_SubjectType" json:"subject_type,omitempty"`
+	ClientPayload        *ValidateTokenResponse_ClientPayload `protobuf:"bytes,3,opt,name=client_payload,json=clientPayload,proto3" json:"client_payload,omitempty"`
+	Scopes               []string                             `protobuf:"bytes,4,rep,name=scopes,proto3" json:"scopes,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                             `json:"-"`
+	XXX_unrecognized     []byte                               `json:"-"`
+	XXX_sizecache        int32                                `json:"-"`
 }
 
 func (m *ValidateTokenResponse) Reset()         { *m = ValidateTokenResponse{} }
@@ -130,6 +166,27 @@ func (m *ValidateTokenResponse) GetUserPayload() *ValidateTokenResponse_UserPayl
 	return nil
 }
 
+func (m *ValidateTokenResponse) GetSubjectType() ValidateTokenResponse_SubjectType {
+	if m != nil {
+		return m.SubjectType
+	}
+	return ValidateTokenResponse_USER
+}
+
+func (m *ValidateTokenResponse) GetClientPayload() *ValidateTokenResponse_ClientPayload {
+	if m != nil {
+		return m.ClientPayload
+	}
+	return nil
+}
+
+func (m *ValidateTokenResponse) GetScopes() []string {
+	if m != nil {
+		return m.Scopes
+	}
+	return nil
+}
+
 type ValidateTokenResponse_UserPayload struct {
 	UserId               int64                                  `protobuf:"varint,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
 	Role                 ValidateTokenResponse_UserPayload_Role `protobuf:"varint,2,opt,name=role,proto3,enum=oauth.ValidateTokenResponse_UserPayload_Role" json:"role,omitempty"`
@@ -177,11 +234,148 @@ func (m *ValidateTokenResponse_UserPayload) GetRole() ValidateTokenResponse_User
 	return ValidateTokenResponse_UserPayload_UNKNOWN
 }
 
+type ValidateTokenResponse_ClientPayload struct {
+	ClientId             string   `protobuf:"bytes,1,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ValidateTokenResponse_ClientPayload) Reset()         { *m = ValidateTokenResponse_ClientPayload{} }
+func (m *ValidateTokenResponse_ClientPayload) String() string { return proto.CompactTextString(m) }
+func (*ValidateTokenResponse_ClientPayload) ProtoMessage()    {}
+func (*ValidateTokenResponse_ClientPayload) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d66fdbd4a55bbcce, []int{1, 1}
+}
+
+func (m *ValidateTokenResponse_ClientPayload) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ValidateTokenResponse_ClientPayload.Unmarshal(m, b)
+}
+func (m *ValidateTokenResponse_ClientPayload) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ValidateTokenResponse_ClientPayload.Marshal(b, m, deterministic)
+}
+func (m *ValidateTokenResponse_ClientPayload) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ValidateTokenResponse_ClientPayload.Merge(m, src)
+}
+func (m *ValidateTokenResponse_ClientPayload) XXX_Size() int {
+	return xxx_messageInfo_ValidateTokenResponse_ClientPayload.Size(m)
+}
+func (m *ValidateTokenResponse_ClientPayload) XXX_DiscardUnknown() {
+	xxx_messageInfo_ValidateTokenResponse_ClientPayload.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ValidateTokenResponse_ClientPayload proto.InternalMessageInfo
+
+func (m *ValidateTokenResponse_ClientPayload) GetClientId() string {
+	if m != nil {
+		return m.ClientId
+	}
+	return ""
+}
+
+type RevokeTokenRequest struct {
+	Token                string   `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	TokenTypeHint        string   `protobuf:"bytes,2,opt,name=token_type_hint,json=tokenTypeHint,proto3" json:"token_type_hint,omitempty"`
+	ClientId             string   `protobuf:"bytes,3,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	ClientSecret         string   `protobuf:"bytes,4,opt,name=client_secret,json=clientSecret,proto3" json:"client_secret,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RevokeTokenRequest) Reset()         { *m = RevokeTokenRequest{} }
+func (m *RevokeTokenRequest) String() string { return proto.CompactTextString(m) }
+func (*RevokeTokenRequest) ProtoMessage()    {}
+func (*RevokeTokenRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d66fdbd4a55bbcce, []int{2}
+}
+
+func (m *RevokeTokenRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RevokeTokenRequest.Unmarshal(m, b)
+}
+func (m *RevokeTokenRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RevokeTokenRequest.Marshal(b, m, deterministic)
+}
+func (m *RevokeTokenRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RevokeTokenRequest.Merge(m, src)
+}
+func (m *RevokeTokenRequest) XXX_Size() int {
+	return xxx_messageInfo_RevokeTokenRequest.Size(m)
+}
+func (m *RevokeTokenRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_RevokeTokenRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RevokeTokenRequest proto.InternalMessageInfo
+
+func (m *RevokeTokenRequest) GetToken() string {
+	if m != nil {
+		return m.Token
+	}
+	return ""
+}
+
+func (m *RevokeTokenRequest) GetTokenTypeHint() string {
+	if m != nil {
+		return m.TokenTypeHint
+	}
+	return ""
+}
+
+func (m *RevokeTokenRequest) GetClientId() string {
+	if m != nil {
+		return m.ClientId
+	}
+	return ""
+}
+
+func (m *RevokeTokenRequest) GetClientSecret() string {
+	if m != nil {
+		return m.ClientSecret
+	}
+	return ""
+}
+
+type RevokeTokenResponse struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RevokeTokenResponse) Reset()         { *m = RevokeTokenResponse{} }
+func (m *RevokeTokenResponse) String() string { return proto.CompactTextString(m) }
+func (*RevokeTokenResponse) ProtoMessage()    {}
+func (*RevokeTokenResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d66fdbd4a55bbcce, []int{3}
+}
+
+func (m *RevokeTokenResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RevokeTokenResponse.Unmarshal(m, b)
+}
+func (m *RevokeTokenResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RevokeTokenResponse.Marshal(b, m, deterministic)
+}
+func (m *RevokeTokenResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RevokeTokenResponse.Merge(m, src)
+}
+func (m *RevokeTokenResponse) XXX_Size() int {
+	return xxx_messageInfo_RevokeTokenResponse.Size(m)
+}
+func (m *RevokeTokenResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_RevokeTokenResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RevokeTokenResponse proto.InternalMessageInfo
+
 func init() {
+	proto.RegisterEnum("oauth.ValidateTokenResponse_SubjectType", ValidateTokenResponse_SubjectType_name, ValidateTokenResponse_SubjectType_value)
 	proto.RegisterEnum("oauth.ValidateTokenResponse_UserPayload_Role", ValidateTokenResponse_UserPayload_Role_name, ValidateTokenResponse_UserPayload_Role_value)
 	proto.RegisterType((*ValidateTokenRequest)(nil), "oauth.ValidateTokenRequest")
 	proto.RegisterType((*ValidateTokenResponse)(nil), "oauth.ValidateTokenResponse")
 	proto.RegisterType((*ValidateTokenResponse_UserPayload)(nil), "oauth.ValidateTokenResponse.UserPayload")
+	proto.RegisterType((*ValidateTokenResponse_ClientPayload)(nil), "oauth.ValidateTokenResponse.ClientPayload")
+	proto.RegisterType((*RevokeTokenRequest)(nil), "oauth.RevokeTokenRequest")
+	proto.RegisterType((*RevokeTokenResponse)(nil), "oauth.RevokeTokenResponse")
 }
 
 func init() {
@@ -189,27 +383,40 @@ func init() {
 }
 
 var fileDescriptor_d66fdbd4a55bbcce = []byte{
-	// 311 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x91, 0xcb, 0x4b, 0xc3, 0x40,
-	0x10, 0xc6, 0x9b, 0xda, 0x87, 0x9d, 0x54, 0x29, 0x8b, 0x62, 0xa9, 0x1e, 0x6a, 0x4e, 0xb9, 0x98,
-	0xd0, 0x7a, 0x12, 0x4f, 0x15, 0x3d, 0x94, 0x6a, 0x2a, 0x5b, 0xab, 0x20, 0x42, 0xd9, 0xa6, 0x63,
-	0x1b, 0x1a, 0xba, 0xeb, 0x3e, 0x04, 0xff, 0x0e, 0xff, 0x5b, 0x4f, 0x92, 0x8d, 0xe0, 0x83, 0x22,
-	0x3d, 0x0d, 0xdf, 0xec, 0x7c, 0xdf, 0x6f, 0x99, 0x81, 0x8e, 0x58, 0xce, 0xc3, 0x64, 0xf5, 0x2c,
-	0x19, 0x2a, 0x2d, 0x4d, 0xac, 0x8d, 0xc4, 0x70, 0xa1, 0xb5, 0x08, 0xe7, 0x52, 0xc4, 0x21, 0x67,
-	0x46, 0x2f, 0xc4, 0x34, 0xaf, 0x81, 0x90, 0x5c, 0x73, 0x52, 0xb6, 0xc2, 0x3b, 0x83, 0xbd, 0x7b,
-	0x96, 0x26, 0x33, 0xa6, 0xf1, 0x8e, 0x2f, 0x71, 0x45, 0xf1, 0xc5, 0xa0, 0xd2, 0xe4, 0x18, 0xea,
-	0x2c, 0x8e, 0x51, 0xa9, 0x89, 0xce, 0xda, 0x4d, 0xa7, 0xed, 0xf8, 0x35, 0xea, 0xe6, 0x3d, 0x3b,
-	0xe9, 0x7d, 0x38, 0xb0, 0xff, 0xc7, 0xab, 0x04, 0x5f, 0x29, 0x24, 0x03, 0xa8, 0x1b, 0x85, 0x72,
-	0x22, 0xd8, 0x5b, 0xca, 0xd9, 0xcc, 0x9a, 0xdd, 0xae, 0x1f, 0xe4, 0xfc, 0xb5, 0x9e, 0x60, 0xac,
-	0x50, 0xde, 0xe6, 0xf3, 0xd4, 0x35, 0xdf, 0xa2, 0xf5, 0xee, 0x80, 0xfb, 0xe3, 0x91, 0x1c, 0x40,
-	0xd5, 0x86, 0x27, 0x79, 0xee, 0x16, 0xad, 0x64, 0xb2, 0x3f, 0x23, 0x3d, 0x28, 0x49, 0x9e, 0x62,
-	0xb3, 0xd8, 0x76, 0xfc, 0xdd, 0xee, 0xc9, 0xa6, 0xb4, 0x80, 0xf2, 0x14, 0xa9, 0xb5, 0x7a, 0x3e,
-	0x94, 0x32, 0x45, 0x5c, 0xa8, 0x8e, 0xa3, 0x41, 0x34, 0x7c, 0x88, 0x1a, 0x05, 0xb2, 0x0d, 0xa5,
-	0xf1, 0xe8, 0x8a, 0x36, 0x1c, 0x52, 0x83, 0x72, 0xef, 0xf2, 0xa6, 0x1f, 0x35, 0x8a, 0xdd, 0x27,
-	0xa8, 0x0f, 0xb3, 0xfc, 0x11, 0xca, 0xd7, 0x24, 0x46, 0x72, 0x0d, 0x3b, 0xbf, 0x48, 0xe4, 0x70,
-	0x3d, 0xdf, 0x6e, 0xb7, 0x75, 0xf4, 0xdf, 0xe7, 0xbc, 0xc2, 0x45, 0xe7, 0x31, 0x0c, 0xc2, 0x8d,
-	0x6e, 0x7a, 0xfe, 0x55, 0xa7, 0x15, 0x7b, 0xd6, 0xd3, 0xcf, 0x00, 0x00, 0x00, 0xff, 0xff, 0xbe,
-	0xbe, 0xd0, 0x7f, 0x0b, 0x02, 0x00, 0x00,
+	// 528 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x54, 0xdd, 0x6e, 0x12, 0x41,
+	0x14, 0xee, 0xc2, 0x42, 0xbb, 0x67, 0x81, 0x92, 0x63, 0xab, 0x48, 0xbd, 0xc0, 0x6d, 0xa2, 0xc4,
+	0x28, 0xc4, 0x1a, 0xe3, 0x85, 0x57, 0xb5, 0xd6, 0x48, 0x5a, 0xa9, 0x0e, 0xa0, 0x89, 0x37, 0x9b,
+	0x65, 0x39, 0x96, 0x15, 0xb2, 0xbb, 0x9d, 0x99, 0x6d, 0xc2, 0x03, 0xf8, 0x04, 0xfa, 0x08, 0x3e,
+	0xa8, 0xd9, 0x99, 0xa5, 0x65, 0x95, 0xd4, 0x5e, 0x0d, 0xdf, 0xc7, 0xf9, 0xf9, 0xce, 0x77, 0x66,
+	0x07, 0x9e, 0xc7, 0xb3, 0xf3, 0x6e, 0x10, 0x7e, 0xe3, 0x1e, 0x09, 0xc9, 0x13, 0x5f, 0x26, 0x9c,
+	0xba, 0x53, 0x29, 0xe3, 0xee, 0x39, 0x8f, 0xfd, 0x6e, 0xe4, 0x25, 0x72, 0x1a, 0x8f, 0xf5, 0xd9,
+	0x89, 0x79, 0x24, 0x23, 0x2c, 0x29, 0xe0, 0x8c, 0x61, 0xe7, 0xb3, 0x37, 0x0f, 0x26, 0x9e, 0xa4,
+	0x61, 0x34, 0xa3, 0x90, 0xd1, 0x45, 0x42, 0x42, 0xe2, 0x43, 0xa8, 0x78, 0xbe, 0x4f, 0x42, 0xb8,
+	0x32, 0xa5, 0x1b, 0x46, 0xcb, 0x68, 0x5b, 0xcc, 0xd6, 0x9c, 0x8a, 0xc4, 0xc7, 0xb0, 0xcd, 0xe9,
+	0x22, 0x09, 0x38, 0x4d, 0x5c, 0xe1, 0x47, 0x31, 0x89, 0x46, 0xa1, 0x55, 0x6c, 0x5b, 0xac, 0xb6,
+	0xa4, 0x07, 0x8a, 0x75, 0x7e, 0x98, 0xb0, 0xfb, 0x57, 0x13, 0x11, 0x47, 0xa1, 0x20, 0x3c, 0x81,
+	0x4a, 0x22, 0x88, 0xbb, 0xb1, 0xb7, 0x98, 0x47, 0xde, 0x44, 0x75, 0xb1, 0x0f, 0xda, 0x1d, 0x2d,
+	0x74, 0x6d, 0x4e, 0x67, 0x24, 0x88, 0x7f, 0xd4, 0xf1, 0xcc, 0x4e, 0xae, 0x41, 0x5a, 0x4c, 0x24,
+	0xe3, 0xef, 0xe4, 0x4b, 0x57, 0x2e, 0x62, 0x6a, 0x14, 0x5a, 0x46, 0xbb, 0xf6, 0x9f, 0x62, 0x03,
+	0x9d, 0x30, 0x5c, 0xc4, 0xc4, 0x6c, 0x71, 0x0d, 0xf0, 0x13, 0xd4, 0xfc, 0x79, 0x40, 0xa1, 0xbc,
+	0xd2, 0x56, 0x54, 0xda, 0x9e, 0xdc, 0x58, 0xee, 0x48, 0xa5, 0x2c, 0xd5, 0x55, 0xfd, 0x55, 0x88,
+	0x77, 0xa1, 0x9c, 0xd9, 0x64, 0x2a, 0x9b, 0x32, 0xd4, 0xfc, 0x69, 0x80, 0xbd, 0x32, 0x14, 0xde,
+	0x83, 0x4d, 0x65, 0x4a, 0xa0, 0xfd, 0x28, 0xb2, 0x72, 0x0a, 0x7b, 0x13, 0x3c, 0x04, 0x93, 0x47,
+	0xf3, 0xe5, 0x60, 0xcf, 0x6e, 0xeb, 0x52, 0x87, 0x45, 0x73, 0x62, 0x2a, 0xd5, 0x69, 0x83, 0x99,
+	0x22, 0xb4, 0x61, 0x73, 0xd4, 0x3f, 0xe9, 0x9f, 0x7d, 0xe9, 0xd7, 0x37, 0x70, 0x0b, 0xcc, 0xd1,
+	0xe0, 0x98, 0xd5, 0x0d, 0xb4, 0xa0, 0x74, 0xf8, 0xf6, 0x43, 0xaf, 0x5f, 0x2f, 0x34, 0x9f, 0x42,
+	0x35, 0x37, 0x0d, 0xee, 0x81, 0x95, 0x39, 0x92, 0x09, 0xb3, 0xd8, 0x96, 0x26, 0x7a, 0x13, 0x67,
+	0x1f, 0xec, 0x15, 0x2b, 0xaf, 0x2a, 0x6e, 0x20, 0x40, 0xf9, 0xe8, 0xb4, 0x77, 0xdc, 0x1f, 0xd6,
+	0x0d, 0xe7, 0x97, 0x01, 0xc8, 0xe8, 0x32, 0x9a, 0xe5, 0xaf, 0xda, 0x0e, 0x94, 0x56, 0xef, 0x98,
+	0x06, 0xf8, 0x08, 0xb6, 0xd5, 0x0f, 0xb5, 0x4b, 0x77, 0x1a, 0x84, 0x52, 0xcd, 0x6d, 0xb1, 0xaa,
+	0xa2, 0xd3, 0x36, 0xef, 0x83, 0x50, 0xe6, 0x65, 0x15, 0xf3, 0xb2, 0x70, 0x1f, 0xb2, 0x1d, 0xb8,
+	0x82, 0x7c, 0x4e, 0xb2, 0x61, 0xaa, 0x80, 0x8a, 0x26, 0x07, 0x8a, 0x73, 0x76, 0xe1, 0x4e, 0x4e,
+	0x95, 0x76, 0xf0, 0xe0, 0xb7, 0x01, 0x95, 0xb3, 0xd4, 0xe1, 0x01, 0xf1, 0xcb, 0xc0, 0x27, 0x3c,
+	0x85, 0x6a, 0xce, 0x6b, 0xdc, 0x5b, 0xbf, 0x01, 0x35, 0x55, 0xf3, 0xc1, 0x4d, 0xeb, 0x71, 0x36,
+	0xf0, 0x1d, 0xd8, 0x2b, 0x5d, 0xf1, 0x7e, 0x16, 0xfe, 0xaf, 0x3f, 0xcd, 0xe6, 0xba, 0xbf, 0x96,
+	0x75, 0xde, 0xbc, 0xfa, 0xfa, 0xb2, 0xd3, 0xbd, 0xc5, 0xe7, 0xbf, 0x7c, 0x04, 0x5e, 0x67, 0xe7,
+	0xb8, 0xac, 0xde, 0x81, 0x17, 0x7f, 0x06, 0x00, 0xed, 0x26, 0x25, 0xbf, 0x3c, 0x04, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -225,6 +432,7 @@ const _ = grpc.SupportPackageIsVersion6
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
 type OauthServiceClient interface {
 	ValidateToken(ctx context.Context, in *ValidateTokenRequest, opts ...grpc.CallOption) (*ValidateTokenResponse, error)
+	RevokeToken(ctx context.Context, in *RevokeTokenRequest, opts ...grpc.CallOption) (*RevokeTokenResponse, error)
 }
 
 type oauthServiceClient struct {
@@ -244,9 +452,19 @@ func (c *oauthServiceClient) ValidateToken(ctx context.Context, in *ValidateToke
 	return out, nil
 }
 
+func (c *oauthServiceClient) RevokeToken(ctx context.Context, in *RevokeTokenRequest, opts ...grpc.CallOption) (*RevokeTokenResponse, error) {
+	out := new(RevokeTokenResponse)
+	err := c.cc.Invoke(ctx, "/oauth.OauthService/RevokeToken", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // OauthServiceServer is the server API for OauthService service.
 type OauthServiceServer interface {
 	ValidateToken(context.Context, *ValidateTokenRequest) (*ValidateTokenResponse, error)
+	RevokeToken(context.Context, *RevokeTokenRequest) (*RevokeTokenResponse, error)
 }
 
 // UnimplementedOauthServiceServer can be embedded to have forward compatible implementations.
@@ -256,6 +474,9 @@ type UnimplementedOauthServiceServer struct {
 func (*UnimplementedOauthServiceServer) ValidateToken(ctx context.Context, req *ValidateTokenRequest) (*ValidateTokenResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ValidateToken not implemented")
 }
+func (*UnimplementedOauthServiceServer) RevokeToken(ctx context.Context, req *RevokeTokenRequest) (*RevokeTokenResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeToken not implemented")
+}
 
 func RegisterOauthServiceServer(s *grpc.Server, srv OauthServiceServer) {
 	s.RegisterService(&_OauthService_serviceDesc, srv)
@@ -279,6 +500,24 @@ func _OauthService_ValidateToken_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _OauthService_RevokeToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OauthServiceServer).RevokeToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/oauth.OauthService/RevokeToken",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OauthServiceServer).RevokeToken(ctx, req.(*RevokeTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _OauthService_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "oauth.OauthService",
 	HandlerType: (*OauthServiceServer)(nil),
@@ -287,6 +526,10 @@ var _OauthService_serviceDesc = grpc.ServiceDesc{
 			MethodName: "ValidateToken",
 			Handler:    _OauthService_ValidateToken_Handler,
 		},
+		{
+			MethodName: "RevokeToken",
+			Handler:    _OauthService_RevokeToken_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "pkg/infraestructure/http/grpc/oauthpb/oauth.proto",
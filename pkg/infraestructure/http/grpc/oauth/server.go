@@ -7,6 +7,7 @@ import (
 
 	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
 	"github.com/FacuBar/bookstore_oauth-api/pkg/infraestructure/http/grpc/oauth/oauthpb"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -32,32 +33,51 @@ func (s *server) ValidateToken(
 
 	accessToken, err := s.as.GetById(at)
 	if err != nil {
-		switch err.Status() {
-		case http.StatusNotFound:
-			return nil, status.Error(codes.NotFound, err.Message())
-
-		case http.StatusBadRequest:
-			return nil, status.Error(codes.InvalidArgument, err.Message())
+		return nil, toStatus(err)
+	}
 
-		case http.StatusUnauthorized:
-			return nil, status.Error(codes.Unauthenticated, err.Message())
+	if !accessToken.HasScopes(req.GetRequiredScopes()...) {
+		return nil, status.Error(codes.PermissionDenied, "access token lacks required scopes")
+	}
 
-		default:
-			return nil, status.Error(codes.Internal, err.Message())
+	if accessToken.IsClientToken() {
+		res := &oauthpb.ValidateTokenResponse{
+			SubjectType: oauthpb.ValidateTokenResponse_CLIENT,
+			ClientPayload: &oauthpb.ValidateTokenResponse_ClientPayload{
+				ClientId: accessToken.ClientId,
+			},
+			Scopes: accessToken.Scopes,
 		}
 
+		return res, nil
 	}
 
 	res := &oauthpb.ValidateTokenResponse{
+		SubjectType: oauthpb.ValidateTokenResponse_USER,
 		UserPayload: &oauthpb.ValidateTokenResponse_UserPayload{
 			UserId: accessToken.UserId,
 			Role:   getRole(accessToken.UserRole),
 		},
+		Scopes: accessToken.Scopes,
 	}
 
 	return res, nil
 }
 
+// RevokeToken revokes the token for the client in the request, trusted
+// services revoking tokens of other clients register with the oauth:revoke
+// scope
+func (s *server) RevokeToken(
+	ctx context.Context,
+	req *oauthpb.RevokeTokenRequest,
+) (*oauthpb.RevokeTokenResponse, error) {
+	if err := s.as.Revoke(req.GetToken(), req.GetTokenTypeHint(), req.GetClientId(), req.GetClientSecret()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &oauthpb.RevokeTokenResponse{}, nil
+}
+
 func NewGRPCServer(address string, as ports.AcessTokenService) (*grpc.Server, error) {
 	lis, err := net.Listen("tcp", address)
 	if err != nil {
@@ -83,3 +103,25 @@ func getRole(role string) oauthpb.ValidateTokenResponse_UserPayload_Role {
 		return oauthpb.ValidateTokenResponse_UserPayload_UNKNOWN
 	}
 }
+
+func toStatus(err rest_errors.RestErr) error {
+	switch err.Status() {
+	case http.StatusNotFound:
+		return status.Error(codes.NotFound, err.Message())
+
+	case http.StatusBadRequest:
+		return status.Error(codes.InvalidArgument, err.Message())
+
+	case http.StatusUnauthorized:
+		return status.Error(codes.Unauthenticated, err.Message())
+
+	case http.StatusForbidden:
+		return status.Error(codes.PermissionDenied, err.Message())
+
+	case http.StatusServiceUnavailable:
+		return status.Error(codes.Unavailable, err.Message())
+
+	default:
+		return status.Error(codes.Internal, err.Message())
+	}
+}
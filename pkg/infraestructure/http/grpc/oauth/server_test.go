@@ -2,6 +2,7 @@ package oauth_grpc
 
 import (
 	"context"
+	"net/http"
 	"testing"
 
 	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
@@ -16,16 +17,56 @@ type atServiceMock struct{}
 
 var (
 	funcGetById func(string) (*domain.AccessToken, rest_errors.RestErr)
+	funcRevoke  func(string, string, string, string) rest_errors.RestErr
 )
 
 var serviceMock ports.AcessTokenService = &atServiceMock{}
 
-func (*atServiceMock) Create(email string, password string) (*domain.AccessToken, rest_errors.RestErr) {
+func (*atServiceMock) Create(email string, password string, scope string, device domain.Device) (*domain.AccessToken, rest_errors.RestErr) {
+	return nil, nil
+}
+func (*atServiceMock) Refresh(refreshToken string, clientId string, clientSecret string) (*domain.AccessToken, rest_errors.RestErr) {
+	return nil, nil
+}
+func (*atServiceMock) CreateForClient(clientId string, clientSecret string, scope string) (*domain.AccessToken, rest_errors.RestErr) {
+	return nil, nil
+}
+func (*atServiceMock) CreateFromAuthorizationCode(code string, redirectUri string, clientId string, clientSecret string, codeVerifier string, device domain.Device) (*domain.AccessToken, rest_errors.RestErr) {
+	return nil, nil
+}
+func (*atServiceMock) ValidateAuthorizationRequest(req domain.AuthorizationRequest) (*domain.Client, rest_errors.RestErr) {
+	return nil, nil
+}
+func (*atServiceMock) Authorize(req domain.AuthorizationRequest, email string, password string) (*domain.AuthorizationCode, rest_errors.RestErr) {
 	return nil, nil
 }
 func (*atServiceMock) GetById(id string) (*domain.AccessToken, rest_errors.RestErr) {
 	return funcGetById(id)
 }
+func (*atServiceMock) Introspect(token string, clientId string, clientSecret string) (*domain.TokenIntrospection, rest_errors.RestErr) {
+	return nil, nil
+}
+func (*atServiceMock) UserInfo(token string) (*domain.UserInfo, rest_errors.RestErr) {
+	return nil, nil
+}
+func (*atServiceMock) RevokeUserTokens(userId int64) rest_errors.RestErr {
+	return nil
+}
+func (*atServiceMock) UpdateExpirationTime(at *domain.AccessToken) rest_errors.RestErr {
+	return nil
+}
+func (*atServiceMock) GetSessions(token string) ([]domain.Session, rest_errors.RestErr) {
+	return nil, nil
+}
+func (*atServiceMock) EndSession(token string, sessionId string) rest_errors.RestErr {
+	return nil
+}
+func (*atServiceMock) JWKS() domain.JSONWebKeySet {
+	return domain.JSONWebKeySet{}
+}
+func (*atServiceMock) Revoke(token string, tokenTypeHint string, clientId string, clientSecret string) rest_errors.RestErr {
+	return funcRevoke(token, tokenTypeHint, clientId, clientSecret)
+}
 
 func TestValidateToken(t *testing.T) {
 	t.Run("NoError", func(t *testing.T) {
@@ -48,6 +89,73 @@ func TestValidateToken(t *testing.T) {
 
 		assert.EqualValues(t, 1, res.GetUserPayload().GetUserId())
 		assert.EqualValues(t, oauthpb.ValidateTokenResponse_UserPayload_ADMIN, res.GetUserPayload().GetRole())
+		assert.EqualValues(t, oauthpb.ValidateTokenResponse_USER, res.GetSubjectType())
+	})
+
+	t.Run("NoErrorClientToken", func(t *testing.T) {
+		funcGetById = func(s string) (*domain.AccessToken, rest_errors.RestErr) {
+			return &domain.AccessToken{
+				ClientId: "catalog",
+			}, nil
+		}
+
+		s := server{as: serviceMock}
+
+		req := &oauthpb.ValidateTokenRequest{
+			AccessToken: "b255ce76-4a87-4293-ae19-08768c96ea05",
+		}
+
+		res, err := s.ValidateToken(context.Background(), req)
+
+		assert.Nil(t, err)
+		assert.Nil(t, res.GetUserPayload())
+		assert.EqualValues(t, oauthpb.ValidateTokenResponse_CLIENT, res.GetSubjectType())
+		assert.EqualValues(t, "catalog", res.GetClientPayload().GetClientId())
+	})
+
+	t.Run("NoErrorRequiredScopes", func(t *testing.T) {
+		funcGetById = func(s string) (*domain.AccessToken, rest_errors.RestErr) {
+			return &domain.AccessToken{
+				UserId:   1,
+				UserRole: "user",
+				Scopes:   []string{"books:read", "orders:write"},
+			}, nil
+		}
+
+		s := server{as: serviceMock}
+
+		req := &oauthpb.ValidateTokenRequest{
+			AccessToken:    "b255ce76-4a87-4293-ae19-08768c96ea05",
+			RequiredScopes: []string{"orders:write"},
+		}
+
+		res, err := s.ValidateToken(context.Background(), req)
+
+		assert.Nil(t, err)
+		assert.EqualValues(t, []string{"books:read", "orders:write"}, res.GetScopes())
+	})
+
+	t.Run("PermissionDenied", func(t *testing.T) {
+		funcGetById = func(s string) (*domain.AccessToken, rest_errors.RestErr) {
+			return &domain.AccessToken{
+				UserId:   1,
+				UserRole: "user",
+				Scopes:   []string{"books:read"},
+			}, nil
+		}
+
+		s := server{as: serviceMock}
+
+		req := &oauthpb.ValidateTokenRequest{
+			AccessToken:    "b255ce76-4a87-4293-ae19-08768c96ea05",
+			RequiredScopes: []string{"books:read", "orders:write"},
+		}
+
+		res, err := s.ValidateToken(context.Background(), req)
+
+		assert.Nil(t, res)
+		assert.NotNil(t, err)
+		assert.EqualValues(t, "rpc error: code = PermissionDenied desc = access token lacks required scopes", err.Error())
 	})
 
 	t.Run("BadRequest", func(t *testing.T) {
@@ -123,6 +231,61 @@ func TestValidateToken(t *testing.T) {
 	})
 }
 
+func TestRevokeToken(t *testing.T) {
+	t.Run("NoError", func(t *testing.T) {
+		funcRevoke = func(token string, tokenTypeHint string, clientId string, clientSecret string) rest_errors.RestErr {
+			assert.EqualValues(t, "catalog", clientId)
+			assert.EqualValues(t, "secret", clientSecret)
+			return nil
+		}
+
+		s := server{as: serviceMock}
+
+		req := &oauthpb.RevokeTokenRequest{
+			Token:         "b255ce76-4a87-4293-ae19-08768c96ea05",
+			TokenTypeHint: "refresh_token",
+			ClientId:      "catalog",
+			ClientSecret:  "secret",
+		}
+
+		res, err := s.RevokeToken(context.Background(), req)
+
+		assert.Nil(t, err)
+		assert.NotNil(t, res)
+	})
+
+	t.Run("InternalServerError", func(t *testing.T) {
+		funcRevoke = func(token string, tokenTypeHint string, clientId string, clientSecret string) rest_errors.RestErr {
+			return rest_errors.NewInternalServerError("db error")
+		}
+
+		s := server{as: serviceMock}
+
+		req := &oauthpb.RevokeTokenRequest{
+			Token: "b255ce76-4a87-4293-ae19-08768c96ea05",
+		}
+
+		res, err := s.RevokeToken(context.Background(), req)
+
+		assert.Nil(t, res)
+		assert.NotNil(t, err)
+		assert.EqualValues(t, "rpc error: code = Internal desc = db error", err.Error())
+	})
+
+	t.Run("ErrorTokenOfAnotherClient", func(t *testing.T) {
+		funcRevoke = func(token string, tokenTypeHint string, clientId string, clientSecret string) rest_errors.RestErr {
+			return rest_errors.NewRestError("token was issued to another client", http.StatusForbidden, "unauthorized_client")
+		}
+
+		s := server{as: serviceMock}
+
+		res, err := s.RevokeToken(context.Background(), &oauthpb.RevokeTokenRequest{Token: "b255ce76-4a87-4293-ae19-08768c96ea05"})
+
+		assert.Nil(t, res)
+		assert.EqualValues(t, "rpc error: code = PermissionDenied desc = token was issued to another client", err.Error())
+	})
+}
+
 func TestServer(t *testing.T) {
 	funcGetById = func(s string) (*domain.AccessToken, rest_errors.RestErr) {
 		return &domain.AccessToken{
@@ -0,0 +1,35 @@
+package rest
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// metrics are the expvar maps served on /debug/vars. expvar.Handler would
+// also serve cmdline and memstats, and the command line may carry secrets.
+var metrics = []string{"janitor", "users_api"}
+
+// AdminHandler serves the metrics, it's meant for a listener that isn't
+// reachable from outside
+func AdminHandler() *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery())
+
+	router.GET("/debug/vars", getMetrics)
+
+	return router
+}
+
+func getMetrics(c *gin.Context) {
+	vars := map[string]json.RawMessage{}
+	for _, name := range metrics {
+		if v := expvar.Get(name); v != nil {
+			// every expvar.Var is valid json
+			vars[name] = json.RawMessage(v.String())
+		}
+	}
+	c.JSON(http.StatusOK, vars)
+}
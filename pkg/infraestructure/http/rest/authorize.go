@@ -0,0 +1,150 @@
+package rest
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
+	"github.com/gin-gonic/gin"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	authorizeTemplateName = "authorize"
+
+	// csrfCookieName holds the token the form has to send back, a page of
+	// another site can post the form but can't read the cookie
+	csrfCookieName = "authorize_csrf"
+)
+
+// authorizeTemplate is the login and consent form of the authorization
+// code flow, the parameters of the authorization request travel as hidden
+// fields
+const authorizeTemplate = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Sign in</title>
+</head>
+<body>
+  {{if .Error}}<p>{{.Error}}</p>{{else}}
+  <h1>Sign in to {{.Request.ClientId}}</h1>
+  {{if .LoginError}}<p>{{.LoginError}}</p>{{end}}
+  {{if .Scopes}}
+  <p>{{.Request.ClientId}} will be allowed to:</p>
+  <ul>
+    {{range .Scopes}}<li>{{.}}</li>{{end}}
+  </ul>
+  {{end}}
+  <form method="post" action="/oauth/authorize">
+    <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+    <input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+    <input type="hidden" name="client_id" value="{{.Request.ClientId}}">
+    <input type="hidden" name="redirect_uri" value="{{.Request.RedirectUri}}">
+    <input type="hidden" name="state" value="{{.Request.State}}">
+    <input type="hidden" name="scope" value="{{.Request.Scope}}">
+    <input type="hidden" name="nonce" value="{{.Request.Nonce}}">
+    <input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+    <input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+    <label>Email <input type="email" name="email" required></label>
+    <label>Password <input type="password" name="password" required></label>
+    <button type="submit">Sign in and allow</button>
+  </form>
+  {{end}}
+</body>
+</html>`
+
+func authorizeForm(s ports.AcessTokenService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req domain.AuthorizationRequest
+		if err := c.ShouldBindQuery(&req); err != nil {
+			c.HTML(http.StatusBadRequest, authorizeTemplateName, gin.H{"Error": "invalid request"})
+			return
+		}
+
+		// nothing is redirected until the client and its redirect uri are
+		// known to be valid, errors are shown to the user instead
+		if _, err := s.ValidateAuthorizationRequest(req); err != nil {
+			c.HTML(err.Status(), authorizeTemplateName, gin.H{"Error": err.Message()})
+			return
+		}
+
+		c.HTML(http.StatusOK, authorizeTemplateName, gin.H{"Request": req, "Scopes": domain.ParseScopes(req.Scope), "CSRFToken": setCSRFCookie(c)})
+	}
+}
+
+func authorize(s ports.AcessTokenService) gin.HandlerFunc {
+	type request struct {
+		domain.AuthorizationRequest
+
+		Email     string `form:"email"`
+		Password  string `form:"password"`
+		CSRFToken string `form:"csrf_token"`
+	}
+
+	return func(c *gin.Context) {
+		var loginRequest request
+		if err := c.ShouldBind(&loginRequest); err != nil {
+			c.HTML(http.StatusBadRequest, authorizeTemplateName, gin.H{"Error": "invalid request"})
+			return
+		}
+		req := loginRequest.AuthorizationRequest
+
+		csrfToken, cookieErr := c.Cookie(csrfCookieName)
+		if cookieErr != nil || subtle.ConstantTimeCompare([]byte(csrfToken), []byte(loginRequest.CSRFToken)) != 1 {
+			c.HTML(http.StatusForbidden, authorizeTemplateName, gin.H{"Error": "invalid request"})
+			return
+		}
+
+		if _, err := s.ValidateAuthorizationRequest(req); err != nil {
+			c.HTML(err.Status(), authorizeTemplateName, gin.H{"Error": err.Message()})
+			return
+		}
+
+		// a registered uri can still be one that doesn't parse, it's found
+		// out before any code is issued for it
+		redirect, parseErr := url.Parse(req.RedirectUri)
+		if parseErr != nil {
+			c.HTML(http.StatusBadRequest, authorizeTemplateName, gin.H{"Error": "invalid redirect_uri"})
+			return
+		}
+
+		code, err := s.Authorize(req, loginRequest.Email, loginRequest.Password)
+		if err != nil {
+			// only a failed login gets the form back, anything else is
+			// shown as is
+			if err.Status() == http.StatusUnauthorized {
+				c.HTML(http.StatusUnauthorized, authorizeTemplateName, gin.H{"Request": req, "Scopes": domain.ParseScopes(req.Scope), "CSRFToken": csrfToken, "LoginError": err.Message()})
+				return
+			}
+			c.HTML(err.Status(), authorizeTemplateName, gin.H{"Error": err.Message()})
+			return
+		}
+
+		query := redirect.Query()
+		query.Set("code", code.Code)
+		if req.State != "" {
+			query.Set("state", req.State)
+		}
+		redirect.RawQuery = query.Encode()
+
+		c.Redirect(http.StatusFound, redirect.String())
+	}
+}
+
+// setCSRFCookie hands a new csrf token to the browser and returns it for
+// the form
+func setCSRFCookie(c *gin.Context) string {
+	token := uuid.NewV4().String()
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     "/oauth/authorize",
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token
+}
@@ -1,49 +1,95 @@
 package rest
 
 import (
+	"html/template"
 	"net/http"
+	"strings"
 
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
 	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
 	"github.com/FacuBar/bookstore_utils-go/rest_errors"
 	"github.com/gin-gonic/gin"
 )
 
-func Handler(ats ports.AcessTokenService) *gin.Engine {
+// Handler builds the REST api, issuer is the public base url of the service
+// and the one every endpoint in the discovery document is relative to.
+// checks are reported by name on /health, metrics are served apart by
+// AdminHandler.
+func Handler(ats ports.AcessTokenService, issuer string, checks map[string]func() bool) *gin.Engine {
 	router := gin.Default()
+	router.SetHTMLTemplate(template.Must(template.New(authorizeTemplateName).Parse(authorizeTemplate)))
 
 	router.POST("/oauth/access_token", createAccessToken(ats))
 	router.GET("/oauth/access_token/:access_token_id", getAccessToken(ats))
+	router.POST("/oauth/revoke", revokeToken(ats))
+	router.POST("/oauth/introspect", introspectToken(ats))
+	router.GET("/.well-known/jwks.json", getJWKS(ats))
+	router.GET("/.well-known/openid-configuration", getOpenIDConfiguration(ats, issuer))
+
+	router.GET("/userinfo", getUserInfo(ats))
+	router.POST("/userinfo", getUserInfo(ats))
+
+	router.GET("/oauth/sessions", getSessions(ats))
+	router.DELETE("/oauth/sessions/:session_id", endSession(ats))
+
+	router.GET("/health", health(checks))
+
+	router.GET("/oauth/authorize", authorizeForm(ats))
+	router.POST("/oauth/authorize", authorize(ats))
 
 	return router
 }
 
-const (
-	grantTypePassword = "password"
-)
-
 func createAccessToken(s ports.AcessTokenService) gin.HandlerFunc {
+	// browser clients send the token request form encoded, so both json
+	// and form bodies are accepted
 	type request struct {
-		GrantType string `json:"grant_type"`
+		GrantType string `json:"grant_type" form:"grant_type"`
+		Scope     string `json:"scope" form:"scope"`
+
+		Email    string `json:"email" form:"email"`
+		Password string `json:"password" form:"password"`
 
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		RefreshToken string `json:"refresh_token" form:"refresh_token"`
+
+		ClientId     string `json:"client_id" form:"client_id"`
+		ClientSecret string `json:"client_secret" form:"client_secret"`
+
+		Code         string `json:"code" form:"code"`
+		RedirectUri  string `json:"redirect_uri" form:"redirect_uri"`
+		CodeVerifier string `json:"code_verifier" form:"code_verifier"`
 	}
 
 	return func(c *gin.Context) {
 		var loginRequest request
-		if err := c.ShouldBindJSON(&loginRequest); err != nil {
+		if err := c.ShouldBind(&loginRequest); err != nil {
 			restErr := rest_errors.NewBadRequestError("invalid request")
 			c.JSON(restErr.Status(), restErr)
 			return
 		}
 
-		if loginRequest.GrantType != grantTypePassword {
-			restErr := rest_errors.NewBadRequestError("grant_type not supported")
-			c.JSON(restErr.Status(), restErr)
-			return
+		var token *domain.AccessToken
+		var err rest_errors.RestErr
+
+		device := domain.Device{UserAgent: c.Request.UserAgent(), Ip: c.ClientIP()}
+
+		// clients may authenticate either with basic auth or in the body
+		if id, secret, ok := c.Request.BasicAuth(); ok {
+			loginRequest.ClientId, loginRequest.ClientSecret = id, secret
 		}
 
-		token, err := s.Create(loginRequest.Email, loginRequest.Password)
+		switch loginRequest.GrantType {
+		case domain.GrantTypePassword:
+			token, err = s.Create(loginRequest.Email, loginRequest.Password, loginRequest.Scope, device)
+		case domain.GrantTypeRefreshToken:
+			token, err = s.Refresh(loginRequest.RefreshToken, loginRequest.ClientId, loginRequest.ClientSecret)
+		case domain.GrantTypeClientCredentials:
+			token, err = s.CreateForClient(loginRequest.ClientId, loginRequest.ClientSecret, loginRequest.Scope)
+		case domain.GrantTypeAuthorizationCode:
+			token, err = s.CreateFromAuthorizationCode(loginRequest.Code, loginRequest.RedirectUri, loginRequest.ClientId, loginRequest.ClientSecret, loginRequest.CodeVerifier, device)
+		default:
+			err = rest_errors.NewBadRequestError("grant_type not supported")
+		}
 		if err != nil {
 			c.JSON(err.Status(), err)
 			return
@@ -66,3 +112,199 @@ func getAccessToken(s ports.AcessTokenService) gin.HandlerFunc {
 		c.JSON(http.StatusOK, at)
 	}
 }
+
+func revokeToken(s ports.AcessTokenService) gin.HandlerFunc {
+	type request struct {
+		Token         string `json:"token" form:"token"`
+		TokenTypeHint string `json:"token_type_hint" form:"token_type_hint"`
+
+		ClientId     string `json:"client_id" form:"client_id"`
+		ClientSecret string `json:"client_secret" form:"client_secret"`
+	}
+
+	return func(c *gin.Context) {
+		var revokeRequest request
+		if err := c.ShouldBind(&revokeRequest); err != nil {
+			restErr := rest_errors.NewBadRequestError("invalid request")
+			c.JSON(restErr.Status(), restErr)
+			return
+		}
+
+		if id, secret, ok := c.Request.BasicAuth(); ok {
+			revokeRequest.ClientId, revokeRequest.ClientSecret = id, secret
+		}
+
+		if err := s.Revoke(revokeRequest.Token, revokeRequest.TokenTypeHint, revokeRequest.ClientId, revokeRequest.ClientSecret); err != nil {
+			c.JSON(err.Status(), err)
+			return
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func introspectToken(s ports.AcessTokenService) gin.HandlerFunc {
+	type request struct {
+		Token string `json:"token" form:"token"`
+
+		ClientId     string `json:"client_id" form:"client_id"`
+		ClientSecret string `json:"client_secret" form:"client_secret"`
+	}
+
+	return func(c *gin.Context) {
+		var introspectRequest request
+		if err := c.ShouldBind(&introspectRequest); err != nil {
+			restErr := rest_errors.NewBadRequestError("invalid request")
+			c.JSON(restErr.Status(), restErr)
+			return
+		}
+
+		if id, secret, ok := c.Request.BasicAuth(); ok {
+			introspectRequest.ClientId, introspectRequest.ClientSecret = id, secret
+		}
+
+		introspection, err := s.Introspect(introspectRequest.Token, introspectRequest.ClientId, introspectRequest.ClientSecret)
+		if err != nil {
+			c.JSON(err.Status(), err)
+			return
+		}
+
+		c.JSON(http.StatusOK, introspection)
+	}
+}
+
+func getJWKS(s ports.AcessTokenService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, s.JWKS())
+	}
+}
+
+func getOpenIDConfiguration(s ports.AcessTokenService, issuer string) gin.HandlerFunc {
+	issuer = strings.TrimSuffix(issuer, "/")
+
+	return func(c *gin.Context) {
+		// the algorithms follow the keys currently published, they change
+		// as keys are rotated
+		algs := []string{}
+		seen := map[string]bool{}
+		for _, key := range s.JWKS().Keys {
+			if !seen[key.Alg] {
+				seen[key.Alg] = true
+				algs = append(algs, key.Alg)
+			}
+		}
+
+		c.JSON(http.StatusOK, domain.OpenIDConfiguration{
+			Issuer:                issuer,
+			AuthorizationEndpoint: issuer + "/oauth/authorize",
+			TokenEndpoint:         issuer + "/oauth/access_token",
+			UserinfoEndpoint:      issuer + "/userinfo",
+			JwksUri:               issuer + "/.well-known/jwks.json",
+			RevocationEndpoint:    issuer + "/oauth/revoke",
+			IntrospectionEndpoint: issuer + "/oauth/introspect",
+
+			ResponseTypesSupported: []string{"code"},
+			GrantTypesSupported: []string{
+				domain.GrantTypePassword,
+				domain.GrantTypeRefreshToken,
+				domain.GrantTypeClientCredentials,
+				domain.GrantTypeAuthorizationCode,
+			},
+			SubjectTypesSupported:             []string{"public"},
+			IdTokenSigningAlgValuesSupported:  algs,
+			ScopesSupported:                   []string{domain.ScopeOpenId},
+			ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "nonce", "email", "role"},
+			TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+			CodeChallengeMethodsSupported:     []string{domain.CodeChallengeMethodS256},
+		})
+	}
+}
+
+func getUserInfo(s ports.AcessTokenService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := bearerToken(c)
+		if !ok {
+			return
+		}
+
+		userInfo, err := s.UserInfo(token)
+		if err != nil {
+			abortWithBearerError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, userInfo)
+	}
+}
+
+func getSessions(s ports.AcessTokenService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := bearerToken(c)
+		if !ok {
+			return
+		}
+
+		sessions, err := s.GetSessions(token)
+		if err != nil {
+			abortWithBearerError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, sessions)
+	}
+}
+
+func endSession(s ports.AcessTokenService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := bearerToken(c)
+		if !ok {
+			return
+		}
+
+		if err := s.EndSession(token, c.Param("session_id")); err != nil {
+			abortWithBearerError(c, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// bearerToken reads the access token from the Authorization header, when
+// there is none the request is answered with a 401 and false is returned
+func bearerToken(c *gin.Context) (string, bool) {
+	header := c.GetHeader("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		c.Header("WWW-Authenticate", "Bearer")
+		restErr := rest_errors.NewUnauthorizedError("missing bearer token")
+		c.JSON(restErr.Status(), restErr)
+		return "", false
+	}
+	return strings.TrimSpace(header[7:]), true
+}
+
+func abortWithBearerError(c *gin.Context, err rest_errors.RestErr) {
+	if err.Status() == http.StatusUnauthorized {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+	c.JSON(err.Status(), err)
+}
+
+// health answers 503 when any of the checks fails, so the instance can be
+// taken out of rotation while a dependency is down
+func health(checks map[string]func() bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status := http.StatusOK
+		report := gin.H{}
+		for name, check := range checks {
+			if check() {
+				report[name] = "up"
+			} else {
+				report[name] = "down"
+				status = http.StatusServiceUnavailable
+			}
+		}
+
+		c.JSON(status, report)
+	}
+}
@@ -0,0 +1,326 @@
+package jwt
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// KeyManager signs with the active key of a rotating set of keys stored in
+// the db, and verifies with any key that may still have live tokens. Every
+// replica reloads the set periodically so they all agree on the active key.
+type KeyManager struct {
+	repo ports.SigningKeyRepository
+	alg  string
+
+	// retireAfter is how long a key is kept after it stops signing, it must
+	// be at least the longest lifetime of a token
+	retireAfter time.Duration
+
+	mu        sync.RWMutex
+	active    *signingKey
+	activated time.Time
+	verifying map[string]*signingKey
+	published []*signingKey
+}
+
+func NewKeyManager(repo ports.SigningKeyRepository, alg string, retireAfter time.Duration) *KeyManager {
+	return &KeyManager{
+		repo:        repo,
+		alg:         alg,
+		retireAfter: retireAfter,
+		verifying:   make(map[string]*signingKey),
+	}
+}
+
+// Load replaces the cached keys with the ones in the db
+func (m *KeyManager) Load() rest_errors.RestErr {
+	keys, err := m.repo.GetAll()
+	if err != nil {
+		return err
+	}
+
+	var active *signingKey
+	var activated time.Time
+	verifying := make(map[string]*signingKey)
+	published := make([]*signingKey, 0, len(keys))
+
+	for _, k := range keys {
+		sk, err := newSigningKey(k)
+		if err != nil {
+			log.Printf("skipping signing key %s: %v", k.Kid, err)
+			continue
+		}
+
+		published = append(published, sk)
+		switch k.State {
+		case domain.SigningKeyActive:
+			if active == nil || time.Unix(k.StateChangedAt, 0).After(activated) {
+				active, activated = sk, time.Unix(k.StateChangedAt, 0)
+			}
+			verifying[sk.kid] = sk
+		case domain.SigningKeyPending, domain.SigningKeyRetiring:
+			// pending keys verify too, another replica may rotate and sign
+			// with one before this replica reloads
+			verifying[sk.kid] = sk
+		}
+	}
+
+	m.mu.Lock()
+	m.active, m.activated = active, activated
+	m.verifying = verifying
+	m.published = published
+	m.mu.Unlock()
+
+	return nil
+}
+
+// Rotate retires the active key, activates the oldest pending one and
+// publishes a new pending key to take its place next time. When another
+// replica rotates at the same time only one of them wins.
+func (m *KeyManager) Rotate() rest_errors.RestErr {
+	keys, err := m.repo.GetAll()
+	if err != nil {
+		return err
+	}
+
+	var active, pending *domain.SigningKey
+	for i := range keys {
+		switch keys[i].State {
+		case domain.SigningKeyActive:
+			active = &keys[i]
+		case domain.SigningKeyPending:
+			if pending == nil {
+				pending = &keys[i]
+			}
+		}
+	}
+
+	if pending == nil {
+		if pending, err = m.create(domain.SigningKeyPending); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now().UTC().Unix()
+	if active != nil {
+		if err := m.repo.UpdateState(active.Kid, domain.SigningKeyActive, domain.SigningKeyRetiring, now); err != nil {
+			if err.Status() == http.StatusConflict {
+				return m.Load()
+			}
+			return err
+		}
+	}
+
+	if err := m.repo.UpdateState(pending.Kid, domain.SigningKeyPending, domain.SigningKeyActive, now); err != nil {
+		if err.Status() == http.StatusConflict {
+			return m.Load()
+		}
+		return err
+	}
+
+	// the next key is published right away so that verifiers have it long
+	// before it signs anything
+	if _, err := m.create(domain.SigningKeyPending); err != nil {
+		return err
+	}
+
+	return m.Load()
+}
+
+// Retire drops the keys that stopped signing long enough ago that every
+// token they signed has expired
+func (m *KeyManager) Retire() rest_errors.RestErr {
+	keys, err := m.repo.GetAll()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, k := range keys {
+		if k.State != domain.SigningKeyRetiring || now.Before(time.Unix(k.StateChangedAt, 0).Add(m.retireAfter)) {
+			continue
+		}
+		if err := m.repo.UpdateState(k.Kid, domain.SigningKeyRetiring, domain.SigningKeyRetired, now.Unix()); err != nil && err.Status() != http.StatusConflict {
+			return err
+		}
+	}
+
+	return m.Load()
+}
+
+// Import stores a PEM encoded key as the active one, only if there are no
+// keys yet. It lets a key that was read from a file keep verifying the
+// tokens it already signed.
+func (m *KeyManager) Import(path string) rest_errors.RestErr {
+	keys, restErr := m.repo.GetAll()
+	if restErr != nil {
+		return restErr
+	}
+	if len(keys) > 0 {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rest_errors.NewInternalServerError(err.Error())
+	}
+	key, err := ParsePrivateKey(data)
+	if err != nil {
+		return rest_errors.NewInternalServerError(err.Error())
+	}
+	alg, err := algorithm(key.Public())
+	if err != nil {
+		return rest_errors.NewInternalServerError(err.Error())
+	}
+	encoded, err := encodePrivateKey(key)
+	if err != nil {
+		return rest_errors.NewInternalServerError(err.Error())
+	}
+
+	now := time.Now().UTC().Unix()
+	return m.repo.Create(domain.SigningKey{
+		Kid:            uuid.NewV4().String(),
+		Algorithm:      alg,
+		PrivateKey:     encoded,
+		State:          domain.SigningKeyActive,
+		CreatedAt:      now,
+		StateChangedAt: now,
+	})
+}
+
+// Start reloads the keys every reloadEvery and rotates them once the active
+// key is older than rotateEvery. A zero rotateEvery leaves rotation to the
+// admin command. The returned func stops the loop.
+func (m *KeyManager) Start(rotateEvery time.Duration, reloadEvery time.Duration) func() {
+	m.tick(rotateEvery)
+
+	done := make(chan struct{})
+	ticker := time.NewTicker(reloadEvery)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				m.tick(rotateEvery)
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+func (m *KeyManager) tick(rotateEvery time.Duration) {
+	if err := m.Load(); err != nil {
+		log.Printf("error while loading signing keys: %v", err.Message())
+		return
+	}
+
+	m.mu.RLock()
+	due := m.active == nil || (rotateEvery > 0 && time.Since(m.activated) >= rotateEvery)
+	m.mu.RUnlock()
+
+	if due {
+		if err := m.Rotate(); err != nil {
+			log.Printf("error while rotating signing keys: %v", err.Message())
+		}
+	}
+
+	if err := m.Retire(); err != nil {
+		log.Printf("error while retiring signing keys: %v", err.Message())
+	}
+}
+
+func (m *KeyManager) Sign(claims domain.TokenClaims) (string, rest_errors.RestErr) {
+	m.mu.RLock()
+	active := m.active
+	m.mu.RUnlock()
+
+	if active == nil {
+		return "", rest_errors.NewInternalServerError("no active signing key")
+	}
+	return active.sign(claims)
+}
+
+func (m *KeyManager) Verify(token string) (*domain.TokenClaims, rest_errors.RestErr) {
+	h, signingInput, signature, ok := parse(token)
+	if !ok {
+		return nil, rest_errors.NewUnauthorizedError("invalid token")
+	}
+
+	m.mu.RLock()
+	candidates := make([]*signingKey, 0, 1)
+	if h.Kid != "" {
+		if k, ok := m.verifying[h.Kid]; ok {
+			candidates = append(candidates, k)
+		}
+	} else {
+		// tokens signed before keys had ids
+		for _, k := range m.verifying {
+			candidates = append(candidates, k)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, k := range candidates {
+		if k.alg != h.Alg || !k.verify(signingInput, signature) {
+			continue
+		}
+
+		var claims domain.TokenClaims
+		if err := decodeJSON(strings.Split(signingInput, ".")[1], &claims); err != nil {
+			return nil, rest_errors.NewUnauthorizedError("invalid token")
+		}
+		return &claims, nil
+	}
+
+	return nil, rest_errors.NewUnauthorizedError("invalid token")
+}
+
+// JWKS publishes pending, active and retiring keys
+func (m *KeyManager) JWKS() domain.JSONWebKeySet {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	set := domain.JSONWebKeySet{Keys: make([]domain.JSONWebKey, 0, len(m.published))}
+	for _, k := range m.published {
+		set.Keys = append(set.Keys, k.jwk())
+	}
+	return set
+}
+
+func (m *KeyManager) create(state string) (*domain.SigningKey, rest_errors.RestErr) {
+	key, err := generateKey(m.alg)
+	if err != nil {
+		return nil, rest_errors.NewInternalServerError(err.Error())
+	}
+	encoded, err := encodePrivateKey(key)
+	if err != nil {
+		return nil, rest_errors.NewInternalServerError(err.Error())
+	}
+
+	now := time.Now().UTC().Unix()
+	sk := domain.SigningKey{
+		Kid:            uuid.NewV4().String(),
+		Algorithm:      m.alg,
+		PrivateKey:     encoded,
+		State:          state,
+		CreatedAt:      now,
+		StateChangedAt: now,
+	}
+
+	if err := m.repo.Create(sk); err != nil {
+		return nil, err
+	}
+	return &sk, nil
+}
@@ -0,0 +1,186 @@
+package jwt
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type keyRepoMock struct {
+	keys []domain.SigningKey
+}
+
+func (r *keyRepoMock) Create(k domain.SigningKey) rest_errors.RestErr {
+	r.keys = append(r.keys, k)
+	return nil
+}
+
+func (r *keyRepoMock) GetAll() ([]domain.SigningKey, rest_errors.RestErr) {
+	keys := make([]domain.SigningKey, 0, len(r.keys))
+	for _, k := range r.keys {
+		if k.State != domain.SigningKeyRetired {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func (r *keyRepoMock) UpdateState(kid string, from string, to string, at int64) rest_errors.RestErr {
+	for i := range r.keys {
+		if r.keys[i].Kid == kid && r.keys[i].State == from {
+			r.keys[i].State = to
+			r.keys[i].StateChangedAt = at
+			return nil
+		}
+	}
+	return rest_errors.NewRestError("signing key state changed", http.StatusConflict, "conflict")
+}
+
+func (r *keyRepoMock) states() map[string]int {
+	states := make(map[string]int)
+	for _, k := range r.keys {
+		states[k.State]++
+	}
+	return states
+}
+
+var (
+	claimsTest = domain.TokenClaims{
+		Subject:  "1",
+		UserId:   1,
+		UserRole: "user",
+		Expires:  1637510344,
+		IssuedAt: 1637337544,
+		Id:       "084a4a0f-92cc-46e6-9b57-1d2aed3c389e",
+	}
+)
+
+func TestSignAndVerify(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgES256} {
+		t.Run(alg, func(t *testing.T) {
+			m := NewKeyManager(&keyRepoMock{}, alg, time.Hour)
+			assert.Nil(t, m.Rotate())
+
+			token, signErr := m.Sign(claimsTest)
+			assert.Nil(t, signErr)
+			assert.EqualValues(t, 2, strings.Count(token, "."))
+
+			claims, verifyErr := m.Verify(token)
+			assert.Nil(t, verifyErr)
+			assert.EqualValues(t, claimsTest, *claims)
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	m := NewKeyManager(&keyRepoMock{}, AlgES256, time.Hour)
+	assert.Nil(t, m.Rotate())
+	token, _ := m.Sign(claimsTest)
+
+	t.Run("ErrorTamperedClaims", func(t *testing.T) {
+		parts := strings.Split(token, ".")
+		other, _ := m.Sign(domain.TokenClaims{UserId: 2, UserRole: "admin"})
+		parts[1] = strings.Split(other, ".")[1]
+
+		claims, err := m.Verify(strings.Join(parts, "."))
+
+		assert.Nil(t, claims)
+		assert.NotNil(t, err)
+		assert.EqualValues(t, http.StatusUnauthorized, err.Status())
+	})
+
+	t.Run("ErrorOtherKeys", func(t *testing.T) {
+		other := NewKeyManager(&keyRepoMock{}, AlgES256, time.Hour)
+		assert.Nil(t, other.Rotate())
+
+		claims, err := other.Verify(token)
+
+		assert.Nil(t, claims)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ErrorMalformed", func(t *testing.T) {
+		claims, err := m.Verify("084a4a0f-92cc-46e6-9b57-1d2aed3c389e")
+
+		assert.Nil(t, claims)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestRotate(t *testing.T) {
+	repo := &keyRepoMock{}
+	m := NewKeyManager(repo, AlgES256, time.Hour)
+
+	t.Run("FirstRotation", func(t *testing.T) {
+		assert.Nil(t, m.Rotate())
+
+		assert.EqualValues(t, map[string]int{domain.SigningKeyActive: 1, domain.SigningKeyPending: 1}, repo.states())
+		assert.Len(t, m.JWKS().Keys, 2)
+	})
+
+	t.Run("OldTokensStillVerify", func(t *testing.T) {
+		token, _ := m.Sign(claimsTest)
+		assert.Nil(t, m.Rotate())
+
+		claims, err := m.Verify(token)
+
+		assert.Nil(t, err)
+		assert.NotNil(t, claims)
+		assert.EqualValues(t, map[string]int{domain.SigningKeyRetiring: 1, domain.SigningKeyActive: 1, domain.SigningKeyPending: 1}, repo.states())
+		assert.Len(t, m.JWKS().Keys, 3)
+	})
+
+	t.Run("RetiredKeysStopVerifying", func(t *testing.T) {
+		token, _ := m.Sign(claimsTest)
+		assert.Nil(t, m.Rotate())
+		for i := range repo.keys {
+			if repo.keys[i].State == domain.SigningKeyRetiring {
+				repo.keys[i].StateChangedAt = time.Now().Add(-2 * time.Hour).Unix()
+			}
+		}
+
+		assert.Nil(t, m.Retire())
+		claims, err := m.Verify(token)
+
+		assert.Nil(t, claims)
+		assert.NotNil(t, err)
+		assert.EqualValues(t, 2, repo.states()[domain.SigningKeyRetired])
+		assert.Len(t, m.JWKS().Keys, 2)
+	})
+}
+
+// replicas reload the keys on their own schedule, a replica that hasn't
+// reloaded since another one rotated must verify the tokens it signs
+func TestRotateOnAnotherReplica(t *testing.T) {
+	repo := &keyRepoMock{}
+	rotating := NewKeyManager(repo, AlgES256, time.Hour)
+	verifying := NewKeyManager(repo, AlgES256, time.Hour)
+	assert.Nil(t, rotating.Rotate())
+	assert.Nil(t, verifying.Load())
+
+	assert.Nil(t, rotating.Rotate())
+	token, signErr := rotating.Sign(claimsTest)
+	assert.Nil(t, signErr)
+
+	claims, err := verifying.Verify(token)
+
+	assert.Nil(t, err)
+	if assert.NotNil(t, claims) {
+		assert.EqualValues(t, claimsTest, *claims)
+	}
+}
+
+func TestSignWithoutKeys(t *testing.T) {
+	m := NewKeyManager(&keyRepoMock{}, AlgES256, time.Hour)
+	assert.Nil(t, m.Load())
+
+	token, err := m.Sign(claimsTest)
+
+	assert.Empty(t, token)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,215 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+)
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid,omitempty"`
+}
+
+type signingKey struct {
+	kid string
+	alg string
+	key crypto.Signer
+}
+
+func newSigningKey(k domain.SigningKey) (*signingKey, error) {
+	key, err := ParsePrivateKey([]byte(k.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	alg, err := algorithm(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	if alg != k.Algorithm {
+		return nil, fmt.Errorf("key %s is not a %s key", k.Kid, k.Algorithm)
+	}
+
+	return &signingKey{kid: k.Kid, alg: alg, key: key}, nil
+}
+
+// ParsePrivateKey reads a PEM encoded private key, in PKCS#8, PKCS#1 or
+// SEC 1 form
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if s, ok := key.(crypto.Signer); ok {
+			return s, nil
+		}
+		return nil, errors.New("unsupported private key type")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	return nil, errors.New("unsupported private key format")
+}
+
+func generateKey(alg string) (crypto.Signer, error) {
+	switch alg {
+	case AlgRS256:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case AlgES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %s", alg)
+	}
+}
+
+func encodePrivateKey(key crypto.Signer) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+func (k *signingKey) sign(claims domain.TokenClaims) (string, rest_errors.RestErr) {
+	h, _ := json.Marshal(header{Alg: k.alg, Typ: "JWT", Kid: k.kid})
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", rest_errors.NewInternalServerError("error when trying to sign token")
+	}
+
+	signingInput := encode(h) + "." + encode(c)
+	sum := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch key := k.key.(type) {
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, sum[:])
+		if err != nil {
+			return "", rest_errors.NewInternalServerError("error when trying to sign token")
+		}
+		// JWS wants r and s as fixed size big endian integers, not ASN.1
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	default:
+		signature, err = k.key.Sign(rand.Reader, sum[:], crypto.SHA256)
+		if err != nil {
+			return "", rest_errors.NewInternalServerError("error when trying to sign token")
+		}
+	}
+
+	return signingInput + "." + encode(signature), nil
+}
+
+func (k *signingKey) verify(signingInput string, signature []byte) bool {
+	sum := sha256.Sum256([]byte(signingInput))
+
+	switch pub := k.key.Public().(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], signature) == nil
+	case *ecdsa.PublicKey:
+		if len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(pub, sum[:], r, s)
+	default:
+		return false
+	}
+}
+
+func (k *signingKey) jwk() domain.JSONWebKey {
+	jwk := domain.JSONWebKey{Use: "sig", Alg: k.alg, Kid: k.kid}
+
+	switch pub := k.key.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encode(pub.N.Bytes())
+		jwk.E = encode(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		x := make([]byte, 32)
+		y := make([]byte, 32)
+		pub.X.FillBytes(x)
+		pub.Y.FillBytes(y)
+		jwk.Kty = "EC"
+		jwk.Crv = "P-256"
+		jwk.X = encode(x)
+		jwk.Y = encode(y)
+	}
+
+	return jwk
+}
+
+// parse splits a compact JWS and decodes its header and signature
+func parse(token string) (*header, string, []byte, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, "", nil, false
+	}
+
+	var h header
+	if err := decodeJSON(parts[0], &h); err != nil {
+		return nil, "", nil, false
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, "", nil, false
+	}
+
+	return &h, parts[0] + "." + parts[1], signature, true
+}
+
+func algorithm(pub crypto.PublicKey) (string, error) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return AlgRS256, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return "", errors.New("only P-256 ecdsa keys are supported")
+		}
+		return AlgES256, nil
+	default:
+		return "", fmt.Errorf("unsupported key type %T", pub)
+	}
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeJSON(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
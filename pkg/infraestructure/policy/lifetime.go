@@ -0,0 +1,165 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+)
+
+// LifetimePolicy resolves the lifetime of new access tokens from rules kept
+// in a json file, the file is reloaded whenever it changes so lifetimes can
+// be tuned without a restart.
+//
+// A rule matches when every field it sets matches the token, and the rule
+// that sets the most specific fields wins: client_id over role over
+// grant_type. Among equally specific rules the first one wins. Clients
+// with a ttl of their own aren't subject to the policy.
+//
+//	{"rules": [
+//	  {"role": "admin", "lifetime": "1h"},
+//	  {"client_id": "catalog", "lifetime": "15m"}
+//	]}
+type LifetimePolicy struct {
+	path string
+	max  time.Duration
+
+	mu      sync.RWMutex
+	rules   []lifetimeRule
+	modTime time.Time
+}
+
+type lifetimeRule struct {
+	GrantType string `json:"grant_type"`
+	ClientId  string `json:"client_id"`
+	Role      string `json:"role"`
+	Lifetime  string `json:"lifetime"`
+
+	lifetime time.Duration
+}
+
+// NewLifetimePolicy reads its rules from path, a policy without a path has
+// no rules. Files with a lifetime over max are rejected, zero means there's
+// no limit.
+func NewLifetimePolicy(path string, max time.Duration) *LifetimePolicy {
+	return &LifetimePolicy{path: path, max: max}
+}
+
+// Load replaces the rules with the ones in the file, the current rules are
+// kept if the file is not valid
+func (p *LifetimePolicy) Load() rest_errors.RestErr {
+	if p.path == "" {
+		return nil
+	}
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return rest_errors.NewInternalServerError(err.Error())
+	}
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return rest_errors.NewInternalServerError(err.Error())
+	}
+
+	var file struct {
+		Rules []lifetimeRule `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return rest_errors.NewInternalServerError(err.Error())
+	}
+	for i := range file.Rules {
+		lifetime, err := time.ParseDuration(file.Rules[i].Lifetime)
+		if err != nil || lifetime <= 0 {
+			return rest_errors.NewInternalServerError(fmt.Sprintf("invalid lifetime %q in rule %d", file.Rules[i].Lifetime, i))
+		}
+		if p.max > 0 && lifetime > p.max {
+			return rest_errors.NewInternalServerError(fmt.Sprintf("lifetime %q in rule %d is over the maximum of %v", file.Rules[i].Lifetime, i, p.max))
+		}
+		file.Rules[i].lifetime = lifetime
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rules = file.Rules
+	p.modTime = info.ModTime()
+	return nil
+}
+
+// Start checks the file every reloadEvery and loads it again when it has
+// changed. The returned func stops the loop.
+func (p *LifetimePolicy) Start(reloadEvery time.Duration) func() {
+	done := make(chan struct{})
+	if p.path == "" {
+		return func() { close(done) }
+	}
+
+	ticker := time.NewTicker(reloadEvery)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				p.reload()
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+func (p *LifetimePolicy) reload() {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		log.Printf("error while checking token lifetimes: %v", err)
+		return
+	}
+
+	p.mu.RLock()
+	changed := !info.ModTime().Equal(p.modTime)
+	p.mu.RUnlock()
+
+	if changed {
+		if err := p.Load(); err != nil {
+			log.Printf("error while loading token lifetimes: %v", err.Message())
+		}
+	}
+}
+
+func (p *LifetimePolicy) AccessTokenLifetime(grantType string, clientId string, role string) (time.Duration, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	best, bestScore := -1, -1
+	for i, r := range p.rules {
+		if (r.GrantType != "" && r.GrantType != grantType) ||
+			(r.ClientId != "" && r.ClientId != clientId) ||
+			(r.Role != "" && r.Role != role) {
+			continue
+		}
+
+		score := 0
+		if r.ClientId != "" {
+			score += 4
+		}
+		if r.Role != "" {
+			score += 2
+		}
+		if r.GrantType != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+
+	if best < 0 {
+		return 0, false
+	}
+	return p.rules[best].lifetime, true
+}
@@ -0,0 +1,107 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeRules(t *testing.T, path string, rules string) {
+	if err := os.WriteFile(path, []byte(rules), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAccessTokenLifetime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lifetimes.json")
+	writeRules(t, path, `{"rules": [
+		{"grant_type": "client_credentials", "lifetime": "1h"},
+		{"role": "admin", "lifetime": "1h"},
+		{"role": "admin", "grant_type": "refresh_token", "lifetime": "30m"},
+		{"client_id": "catalog", "lifetime": "15m"}
+	]}`)
+
+	p := NewLifetimePolicy(path, 0)
+	assert.Nil(t, p.Load())
+
+	t.Run("NoRule", func(t *testing.T) {
+		_, ok := p.AccessTokenLifetime("password", "", "user")
+		assert.False(t, ok)
+	})
+
+	t.Run("Role", func(t *testing.T) {
+		lifetime, ok := p.AccessTokenLifetime("password", "", "admin")
+		assert.True(t, ok)
+		assert.EqualValues(t, time.Hour, lifetime)
+	})
+
+	t.Run("RoleAndGrant", func(t *testing.T) {
+		lifetime, ok := p.AccessTokenLifetime("refresh_token", "", "admin")
+		assert.True(t, ok)
+		assert.EqualValues(t, 30*time.Minute, lifetime)
+	})
+
+	t.Run("ClientOverGrant", func(t *testing.T) {
+		lifetime, ok := p.AccessTokenLifetime("client_credentials", "catalog", "")
+		assert.True(t, ok)
+		assert.EqualValues(t, 15*time.Minute, lifetime)
+	})
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("NoPath", func(t *testing.T) {
+		p := NewLifetimePolicy("", 0)
+		assert.Nil(t, p.Load())
+
+		_, ok := p.AccessTokenLifetime("password", "", "admin")
+		assert.False(t, ok)
+	})
+
+	t.Run("InvalidLifetimeKeepsRules", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "lifetimes.json")
+		writeRules(t, path, `{"rules": [{"role": "admin", "lifetime": "1h"}]}`)
+
+		p := NewLifetimePolicy(path, 0)
+		assert.Nil(t, p.Load())
+
+		writeRules(t, path, `{"rules": [{"role": "admin", "lifetime": "soon"}]}`)
+		assert.NotNil(t, p.Load())
+
+		lifetime, ok := p.AccessTokenLifetime("password", "", "admin")
+		assert.True(t, ok)
+		assert.EqualValues(t, time.Hour, lifetime)
+	})
+
+	t.Run("ErrorLifetimeOverMax", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "lifetimes.json")
+		writeRules(t, path, `{"rules": [{"role": "user", "lifetime": "72h"}]}`)
+
+		p := NewLifetimePolicy(path, 48*time.Hour)
+		err := p.Load()
+
+		if assert.NotNil(t, err) {
+			assert.EqualValues(t, `lifetime "72h" in rule 0 is over the maximum of 48h0m0s`, err.Message())
+		}
+		_, ok := p.AccessTokenLifetime("password", "", "user")
+		assert.False(t, ok)
+	})
+
+	t.Run("ReloadOnChange", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "lifetimes.json")
+		writeRules(t, path, `{"rules": [{"role": "admin", "lifetime": "1h"}]}`)
+
+		p := NewLifetimePolicy(path, 0)
+		assert.Nil(t, p.Load())
+
+		writeRules(t, path, `{"rules": [{"role": "admin", "lifetime": "10m"}]}`)
+		later := time.Now().Add(time.Minute)
+		assert.Nil(t, os.Chtimes(path, later, later))
+		p.reload()
+
+		lifetime, _ := p.AccessTokenLifetime("password", "", "admin")
+		assert.EqualValues(t, 10*time.Minute, lifetime)
+	})
+}
@@ -1,10 +1,7 @@
 package repositories
 
 import (
-	"bytes"
 	"database/sql"
-	"encoding/json"
-	"io"
 	"net/http"
 	"strings"
 	"sync"
@@ -15,8 +12,7 @@ import (
 )
 
 type accessTokenRepository struct {
-	db   *sql.DB
-	rest *http.Client
+	db *sql.DB
 }
 
 var (
@@ -24,11 +20,10 @@ var (
 	instanceTokenRepo *accessTokenRepository
 )
 
-func NewAccessTokenRepository(db *sql.DB, rest *http.Client) ports.AccessTokenRepository {
+func NewAccessTokenRepository(db *sql.DB) ports.AccessTokenRepository {
 	onceTokenRepo.Do(func() {
 		instanceTokenRepo = &accessTokenRepository{
-			db:   db,
-			rest: rest,
+			db: db,
 		}
 	})
 
@@ -36,96 +31,234 @@ func NewAccessTokenRepository(db *sql.DB, rest *http.Client) ports.AccessTokenRe
 }
 
 const (
-	queryGetAccessToken = "SELECT access_token, user_id, user_role, expires FROM access_tokens WHERE access_token=?;"
+	queryGetAccessToken = "SELECT access_token, user_id, user_role, client_id, scopes, expires, issued_at FROM access_tokens WHERE access_token=?;"
 
-	queryCreateAccessToken = "INSERT INTO access_tokens(access_token, user_id, user_role, expires) VALUES (?, ?, ?, ?)"
+	queryCreateAccessToken = "INSERT INTO access_tokens(access_token, user_id, user_role, client_id, scopes, expires, issued_at) VALUES (?, ?, ?, ?, ?, ?, ?)"
 
-	queryDeleteAccessTokenByUser = "DELETE FROM access_tokens WHERE user_id=?"
+	queryDeleteAccessToken               = "DELETE FROM access_tokens WHERE access_token=?"
+	queryDeleteRefreshTokenByAccessToken = "DELETE FROM refresh_tokens WHERE access_token=?"
 
-	// queryDeleteAccessToken = "DELETE FROM access_tokens WHERE access_token=?"
-	// queryUpdateExpires     = "UPDATE access_tokens SET expires=? WHERE access_token=?;"
+	queryDeleteAccessTokensByUser       = "DELETE FROM access_tokens WHERE user_id=?;"
+	queryDeleteRefreshTokensByUser      = "DELETE FROM refresh_tokens WHERE user_id=?;"
+	queryDeleteAuthorizationCodesByUser = "DELETE FROM authorization_codes WHERE user_id=?;"
+
+	queryCreateRefreshToken = "INSERT INTO refresh_tokens(refresh_token, family_id, access_token, user_id, user_role, client_id, scopes, expires) VALUES (?, ?, ?, ?, ?, ?, ?, ?);"
+
+	queryGetRefreshToken = "SELECT refresh_token, family_id, access_token, user_id, user_role, client_id, scopes, expires, used FROM refresh_tokens WHERE refresh_token=?;"
+
+	queryUseRefreshToken = "UPDATE refresh_tokens SET used=1 WHERE refresh_token=? AND used=0;"
+
+	queryDeleteAccessTokenByFamily  = "DELETE FROM access_tokens WHERE access_token IN (SELECT access_token FROM refresh_tokens WHERE family_id=?);"
+	queryDeleteRefreshTokenByFamily = "DELETE FROM refresh_tokens WHERE family_id=?;"
+
+	queryCreateAuthorizationCode = "INSERT INTO authorization_codes(code, family_id, client_id, redirect_uri, scope, nonce, code_challenge, code_challenge_method, user_id, user_role, expires) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);"
+
+	queryGetAuthorizationCode = "SELECT code, family_id, client_id, redirect_uri, scope, nonce, code_challenge, code_challenge_method, user_id, user_role, expires, used FROM authorization_codes WHERE code=?;"
+
+	queryUseAuthorizationCode = "UPDATE authorization_codes SET used=1 WHERE code=? AND used=0;"
+
+	queryUpdateExpires = "UPDATE access_tokens SET expires=? WHERE access_token=? AND expires<?;"
 )
 
-func (r *accessTokenRepository) Create(at domain.AccessToken) rest_errors.RestErr {
-	if _, err := r.db.Exec(queryDeleteAccessTokenByUser, at.UserId); err != nil {
-		return rest_errors.NewInternalServerError(err.Error())
-	}
+func (r *accessTokenRepository) Create(at domain.AccessToken, events ...domain.OAuthEvent) rest_errors.RestErr {
+	return withEvents(r.db, events, func(db execer) rest_errors.RestErr {
+		stmt, err := db.Prepare(queryCreateAccessToken)
+		if err != nil {
+			return rest_errors.NewInternalServerError(err.Error())
+		}
+		defer stmt.Close()
 
-	stmt, err := r.db.Prepare(queryCreateAccessToken)
-	if err != nil {
-		return rest_errors.NewInternalServerError(err.Error())
+		if _, err := stmt.Exec(domain.HashAccessToken(at.AccessToken), at.UserId, at.UserRole, at.ClientId, domain.FormatScopes(at.Scopes), at.Expires, at.IssuedAt); err != nil {
+			return rest_errors.NewInternalServerError(err.Error())
+		}
+
+		return nil
+	})
+}
+
+// GetById is on the path of every request that validates a token, so the
+// query isn't prepared on every call. Only the hash of the token is stored,
+// the token returned carries the id it was looked up with.
+func (r *accessTokenRepository) GetById(Id string) (*domain.AccessToken, rest_errors.RestErr) {
+	var at domain.AccessToken
+
+	var scopes string
+	result := r.db.QueryRow(queryGetAccessToken, domain.HashAccessToken(Id))
+	if err := result.Scan(&at.AccessToken, &at.UserId, &at.UserRole, &at.ClientId, &scopes, &at.Expires, &at.IssuedAt); err != nil {
+		if strings.Contains(err.Error(), "no rows") {
+			return nil, rest_errors.NewNotFoundError("access_token not found")
+		}
+		return nil, rest_errors.NewInternalServerError(err.Error())
 	}
-	defer stmt.Close()
+	at.AccessToken = Id
+	at.Scopes = domain.ParseScopes(scopes)
+
+	return &at, nil
+}
+
+// DeleteById deletes the access token along with the refresh token issued
+// with it, deleting a token that doesn't exist is not an error
+func (r *accessTokenRepository) DeleteById(id string, events ...domain.OAuthEvent) rest_errors.RestErr {
+	return withEvents(r.db, events, func(db execer) rest_errors.RestErr {
+		stmt, err := db.Prepare(queryDeleteAccessToken)
+		if err != nil {
+			return rest_errors.NewInternalServerError(err.Error())
+		}
+		defer stmt.Close()
+
+		hash := domain.HashAccessToken(id)
+		if _, err := stmt.Exec(hash); err != nil {
+			return rest_errors.NewInternalServerError(err.Error())
+		}
+
+		if _, err := db.Exec(queryDeleteRefreshTokenByAccessToken, hash); err != nil {
+			return rest_errors.NewInternalServerError(err.Error())
+		}
 
-	if _, err := stmt.Exec(at.AccessToken, at.UserId, at.UserRole, at.Expires); err != nil {
+		return nil
+	})
+}
+
+func (r *accessTokenRepository) DeleteByUser(userId int64, events ...domain.OAuthEvent) rest_errors.RestErr {
+	return withEvents(r.db, events, func(db execer) rest_errors.RestErr {
+		// codes go first so none can be exchanged for new tokens in between
+		for _, query := range []string{queryDeleteAuthorizationCodesByUser, queryDeleteAccessTokensByUser, queryDeleteRefreshTokensByUser} {
+			if _, err := db.Exec(query, userId); err != nil {
+				return rest_errors.NewInternalServerError(err.Error())
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateExpirationTime extends the token, when another replica already
+// extended it further or it was deleted nothing is updated
+func (r *accessTokenRepository) UpdateExpirationTime(id string, expires int64) rest_errors.RestErr {
+	if _, err := r.db.Exec(queryUpdateExpires, expires, domain.HashAccessToken(id), expires); err != nil {
 		return rest_errors.NewInternalServerError(err.Error())
 	}
-
 	return nil
 }
 
-func (r *accessTokenRepository) GetById(Id string) (*domain.AccessToken, rest_errors.RestErr) {
-	var at domain.AccessToken
-	stmt, err := r.db.Prepare(queryGetAccessToken)
+// CreateWithRefreshToken stores an access token and the refresh token issued
+// with it, either both are stored or neither is
+func (r *accessTokenRepository) CreateWithRefreshToken(at domain.AccessToken, rt domain.RefreshToken, events ...domain.OAuthEvent) rest_errors.RestErr {
+	return inTransaction(r.db, events, func(db execer) rest_errors.RestErr {
+		if _, err := db.Exec(queryCreateAccessToken, domain.HashAccessToken(at.AccessToken), at.UserId, at.UserRole, at.ClientId, domain.FormatScopes(at.Scopes), at.Expires, at.IssuedAt); err != nil {
+			return rest_errors.NewInternalServerError(err.Error())
+		}
+
+		if _, err := db.Exec(queryCreateRefreshToken, domain.HashAccessToken(rt.RefreshToken), rt.FamilyId, domain.HashAccessToken(rt.AccessToken), rt.UserId, rt.UserRole, rt.ClientId, domain.FormatScopes(rt.Scopes), rt.Expires); err != nil {
+			return rest_errors.NewInternalServerError(err.Error())
+		}
+
+		return nil
+	})
+}
+
+// GetRefreshToken looks the token up by its hash like GetById does
+func (r *accessTokenRepository) GetRefreshToken(token string) (*domain.RefreshToken, rest_errors.RestErr) {
+	var rt domain.RefreshToken
+	stmt, err := r.db.Prepare(queryGetRefreshToken)
 	if err != nil {
 		return nil, rest_errors.NewInternalServerError(err.Error())
 	}
+	defer stmt.Close()
 
-	result := stmt.QueryRow(Id)
-	if err := result.Scan(&at.AccessToken, &at.UserId, &at.UserRole, &at.Expires); err != nil {
+	var scopes string
+	result := stmt.QueryRow(domain.HashAccessToken(token))
+	if err := result.Scan(&rt.RefreshToken, &rt.FamilyId, &rt.AccessToken, &rt.UserId, &rt.UserRole, &rt.ClientId, &scopes, &rt.Expires, &rt.Used); err != nil {
 		if strings.Contains(err.Error(), "no rows") {
-			return nil, rest_errors.NewNotFoundError("access_token not found")
+			return nil, rest_errors.NewNotFoundError("refresh_token not found")
 		}
 		return nil, rest_errors.NewInternalServerError(err.Error())
 	}
+	rt.RefreshToken = token
+	rt.Scopes = domain.ParseScopes(scopes)
 
-	return &at, nil
+	return &rt, nil
 }
 
-func (r *accessTokenRepository) LoginUser(email, password string) (*domain.User, rest_errors.RestErr) {
-	request := struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}{
-		Email:    email,
-		Password: password,
+// UseRefreshToken marks the token as used, only one caller can succeed so
+// two concurrent refreshes with the same token end up as a conflict
+func (r *accessTokenRepository) UseRefreshToken(token string) rest_errors.RestErr {
+	result, err := r.db.Exec(queryUseRefreshToken, domain.HashAccessToken(token))
+	if err != nil {
+		return rest_errors.NewInternalServerError(err.Error())
 	}
 
-	jsonReq, _ := json.Marshal(request)
-	b := bytes.NewBuffer(jsonReq)
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return rest_errors.NewInternalServerError(err.Error())
+	}
+	if rows == 0 {
+		return rest_errors.NewRestError("refresh_token already used", http.StatusConflict, "conflict")
+	}
+
+	return nil
+}
+
+func (r *accessTokenRepository) RevokeRefreshTokenFamily(familyId string, events ...domain.OAuthEvent) rest_errors.RestErr {
+	return withEvents(r.db, events, func(db execer) rest_errors.RestErr {
+		if _, err := db.Exec(queryDeleteAccessTokenByFamily, familyId); err != nil {
+			return rest_errors.NewInternalServerError(err.Error())
+		}
 
-	response, err := r.rest.Post("http://localhost:8080/users/login", "application/json", b)
+		if _, err := db.Exec(queryDeleteRefreshTokenByFamily, familyId); err != nil {
+			return rest_errors.NewInternalServerError(err.Error())
+		}
+
+		return nil
+	})
+}
+
+func (r *accessTokenRepository) CreateAuthorizationCode(ac domain.AuthorizationCode) rest_errors.RestErr {
+	stmt, err := r.db.Prepare(queryCreateAuthorizationCode)
+	if err != nil {
+		return rest_errors.NewInternalServerError(err.Error())
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.Exec(ac.Code, ac.FamilyId, ac.ClientId, ac.RedirectUri, ac.Scope, ac.Nonce, ac.CodeChallenge, ac.CodeChallengeMethod, ac.UserId, ac.UserRole, ac.Expires); err != nil {
+		return rest_errors.NewInternalServerError(err.Error())
+	}
+
+	return nil
+}
+
+func (r *accessTokenRepository) GetAuthorizationCode(code string) (*domain.AuthorizationCode, rest_errors.RestErr) {
+	var ac domain.AuthorizationCode
+	stmt, err := r.db.Prepare(queryGetAuthorizationCode)
 	if err != nil {
 		return nil, rest_errors.NewInternalServerError(err.Error())
 	}
-	defer response.Body.Close()
+	defer stmt.Close()
 
-	if response.StatusCode > 299 {
-		bodyBytes, _ := io.ReadAll(response.Body)
-		restErr, err := rest_errors.NewRestErrorFromBytes(bodyBytes)
-		if err != nil {
-			return nil, rest_errors.NewInternalServerError("invalid restclient response")
+	result := stmt.QueryRow(code)
+	if err := result.Scan(&ac.Code, &ac.FamilyId, &ac.ClientId, &ac.RedirectUri, &ac.Scope, &ac.Nonce, &ac.CodeChallenge, &ac.CodeChallengeMethod, &ac.UserId, &ac.UserRole, &ac.Expires, &ac.Used); err != nil {
+		if strings.Contains(err.Error(), "no rows") {
+			return nil, rest_errors.NewNotFoundError("authorization_code not found")
 		}
-		return nil, restErr
+		return nil, rest_errors.NewInternalServerError(err.Error())
 	}
 
-	var user domain.User
-	if err := json.NewDecoder(response.Body).Decode(&user); err != nil {
-		return nil, rest_errors.NewInternalServerError("error when trying to unmarshal users response")
-	}
-	return &user, nil
+	return &ac, nil
 }
 
-// func (r *accessTokenRepository) DeleteById(id string) rest_errors.RestErr {
-// 	stmt, err := r.db.Prepare(queryDeleteAccessToken)
-// 	if err != nil {
-// 		return rest_errors.NewNotFoundError(err.Error())
-// 	}
-// 	defer stmt.Close()
+// UseAuthorizationCode works the same way as UseRefreshToken
+func (r *accessTokenRepository) UseAuthorizationCode(code string) rest_errors.RestErr {
+	result, err := r.db.Exec(queryUseAuthorizationCode, code)
+	if err != nil {
+		return rest_errors.NewInternalServerError(err.Error())
+	}
 
-// 	if _, err := stmt.Exec(id); err != nil {
-// 		return rest_errors.NewInternalServerError(err.Error())
-// 	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return rest_errors.NewInternalServerError(err.Error())
+	}
+	if rows == 0 {
+		return rest_errors.NewRestError("authorization_code already used", http.StatusConflict, "conflict")
+	}
 
-// 	return nil
-// }
+	return nil
+}
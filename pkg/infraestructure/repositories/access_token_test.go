@@ -4,9 +4,8 @@ import (
 	"database/sql"
 	"errors"
 	"log"
-	"net"
 	"net/http"
-	"net/http/httptest"
+	"regexp"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -28,40 +27,49 @@ var (
 		AccessToken: "084a4a0f-92cc-46e6-9b57-1d2aed3c389e",
 		UserId:      1,
 		UserRole:    "user",
+		Scopes:      []string{"books:read", "orders:write"},
+	}
+
+	rtTest = domain.RefreshToken{
+		RefreshToken: "6f1c1f4e-5d0a-4c8e-9d7a-2b8e0f3c1a11",
+		FamilyId:     "c3e9d6b2-8f4a-4e1b-a7c5-0d2f9b6e4a33",
+		AccessToken:  "084a4a0f-92cc-46e6-9b57-1d2aed3c389e",
+		UserId:       1,
+		UserRole:     "user",
+		Scopes:       []string{"books:read", "orders:write"},
 	}
 )
 
 func TestCreate(t *testing.T) {
-	queryCreate := "INSERT INTO access_tokens\\(access_token, user_id, user_role, expires\\) VALUES \\(\\?, \\?, \\?, \\?\\)"
-	queryDelete := "DELETE FROM access_tokens WHERE user_id\\=?"
+	queryCreate := "INSERT INTO access_tokens\\(access_token, user_id, user_role, client_id, scopes, expires, issued_at\\) VALUES \\(\\?, \\?, \\?, \\?, \\?, \\?, \\?\\)"
 
 	t.Run("NoError", func(t *testing.T) {
 		db, mock := NewMock()
-		mock.ExpectExec(queryDelete).WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
-		mock.ExpectPrepare(queryCreate).ExpectExec().WithArgs(atTest.AccessToken, atTest.UserId, atTest.UserRole, atTest.Expires).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectPrepare(queryCreate).ExpectExec().WithArgs(domain.HashAccessToken(atTest.AccessToken), atTest.UserId, atTest.UserRole, atTest.ClientId, "books:read orders:write", atTest.Expires, atTest.IssuedAt).WillReturnResult(sqlmock.NewResult(1, 1))
 
-		atRepo := accessTokenRepository{db: db, rest: nil}
+		atRepo := accessTokenRepository{db: db}
 		err := atRepo.Create(atTest)
 
 		assert.Nil(t, err)
 	})
 
-	t.Run("ErrorDeletingTokens", func(t *testing.T) {
+	t.Run("NoErrorClientToken", func(t *testing.T) {
 		db, mock := NewMock()
-		mock.ExpectExec(queryDelete).WithArgs(1).WillReturnError(sql.ErrConnDone)
+		clientToken := domain.AccessToken{AccessToken: atTest.AccessToken, ClientId: "catalog"}
+		mock.ExpectPrepare(queryCreate).ExpectExec().WithArgs(domain.HashAccessToken(clientToken.AccessToken), 0, "", "catalog", "", clientToken.Expires, clientToken.IssuedAt).WillReturnResult(sqlmock.NewResult(1, 1))
 
-		atRepo := accessTokenRepository{db: db, rest: nil}
-		err := atRepo.Create(atTest)
+		atRepo := accessTokenRepository{db: db}
+		err := atRepo.Create(clientToken)
 
-		assert.NotNil(t, err)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
 	})
 
 	t.Run("ErrorPreparingInsert", func(t *testing.T) {
 		db, mock := NewMock()
-		mock.ExpectExec(queryDelete).WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
 		mock.ExpectPrepare(queryCreate).WillReturnError(sql.ErrConnDone)
 
-		atRepo := accessTokenRepository{db: db, rest: nil}
+		atRepo := accessTokenRepository{db: db}
 		err := atRepo.Create(atTest)
 
 		assert.NotNil(t, err)
@@ -69,10 +77,9 @@ func TestCreate(t *testing.T) {
 
 	t.Run("ErrorInserting", func(t *testing.T) {
 		db, mock := NewMock()
-		mock.ExpectExec(queryDelete).WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
 		mock.ExpectPrepare(queryCreate).ExpectExec().WillReturnError(sql.ErrConnDone)
 
-		atRepo := accessTokenRepository{db: db, rest: nil}
+		atRepo := accessTokenRepository{db: db}
 		err := atRepo.Create(atTest)
 
 		assert.NotNil(t, err)
@@ -80,168 +87,353 @@ func TestCreate(t *testing.T) {
 }
 
 func TestGetById(t *testing.T) {
-	query := "SELECT access_token, user_id, user_role, expires FROM access_tokens WHERE access_token=\\?;"
+	query := "SELECT access_token, user_id, user_role, client_id, scopes, expires, issued_at FROM access_tokens WHERE access_token=\\?;"
 
 	t.Run("NoError", func(t *testing.T) {
 		db, mock := NewMock()
-		row := mock.NewRows([]string{"access_token", "user_id", "user_role", "expires"}).
-			AddRow("084a4a0f-92cc-46e6-9b57-1d2aed3c389e", 1, "user", 1637510344)
-		mock.ExpectPrepare(query).ExpectQuery().WillReturnRows(row)
+		row := mock.NewRows([]string{"access_token", "user_id", "user_role", "client_id", "scopes", "expires", "issued_at"}).
+			AddRow(domain.HashAccessToken(atTest.AccessToken), 1, "user", "", "books:read orders:write", 1637510344, 1637337544)
+		mock.ExpectQuery(query).WithArgs(domain.HashAccessToken(atTest.AccessToken)).WillReturnRows(row)
 
-		atRepo := accessTokenRepository{db: db, rest: nil}
+		atRepo := accessTokenRepository{db: db}
 		at, err := atRepo.GetById("084a4a0f-92cc-46e6-9b57-1d2aed3c389e")
 
 		assert.Nil(t, err)
 		assert.NotNil(t, at)
 		assert.EqualValues(t, "084a4a0f-92cc-46e6-9b57-1d2aed3c389e", at.AccessToken)
 		assert.EqualValues(t, "user", at.UserRole)
+		assert.EqualValues(t, []string{"books:read", "orders:write"}, at.Scopes)
 	})
 
-	t.Run("ErrorPreparingStatement", func(t *testing.T) {
+	t.Run("ErrorScaningResult", func(t *testing.T) {
 		db, mock := NewMock()
-		mock.ExpectPrepare(query).WillReturnError(errors.New(""))
+		mock.ExpectQuery(query).WillReturnError(errors.New(""))
 
-		atRepo := accessTokenRepository{db: db, rest: nil}
+		atRepo := accessTokenRepository{db: db}
 		at, err := atRepo.GetById("084a4a0f-92cc-46e6-9b57-1d2aed3c389e")
 
 		assert.Nil(t, at)
 		assert.NotNil(t, err)
 	})
 
-	t.Run("ErrorScaningResult", func(t *testing.T) {
+	t.Run("ErrorNoRows", func(t *testing.T) {
 		db, mock := NewMock()
-		mock.ExpectPrepare(query).ExpectQuery().WillReturnError(errors.New(""))
+		mock.ExpectQuery(query).WillReturnError(sql.ErrNoRows)
 
-		atRepo := accessTokenRepository{db: db, rest: nil}
+		atRepo := accessTokenRepository{db: db}
 		at, err := atRepo.GetById("084a4a0f-92cc-46e6-9b57-1d2aed3c389e")
 
 		assert.Nil(t, at)
 		assert.NotNil(t, err)
+		assert.EqualValues(t, "access_token not found", err.Message())
 	})
+}
 
-	t.Run("ErrorNoRows", func(t *testing.T) {
+func TestDeleteById(t *testing.T) {
+	query := regexp.QuoteMeta(queryDeleteAccessToken)
+	queryRefreshTokens := regexp.QuoteMeta(queryDeleteRefreshTokenByAccessToken)
+
+	t.Run("NoError", func(t *testing.T) {
 		db, mock := NewMock()
-		mock.ExpectPrepare(query).ExpectQuery().WillReturnError(sql.ErrNoRows)
+		mock.ExpectPrepare(query).ExpectExec().WithArgs(domain.HashAccessToken(atTest.AccessToken)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(queryRefreshTokens).WithArgs(domain.HashAccessToken(atTest.AccessToken)).WillReturnResult(sqlmock.NewResult(0, 1))
 
-		atRepo := accessTokenRepository{db: db, rest: nil}
-		at, err := atRepo.GetById("084a4a0f-92cc-46e6-9b57-1d2aed3c389e")
+		atRepo := accessTokenRepository{db: db}
+		err := atRepo.DeleteById(atTest.AccessToken)
+
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("NoErrorUnknownToken", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectPrepare(query).ExpectExec().WithArgs(domain.HashAccessToken(atTest.AccessToken)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(queryRefreshTokens).WithArgs(domain.HashAccessToken(atTest.AccessToken)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		atRepo := accessTokenRepository{db: db}
+		err := atRepo.DeleteById(atTest.AccessToken)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("ErrorPreparingStatement", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectPrepare(query).WillReturnError(errors.New(""))
+
+		atRepo := accessTokenRepository{db: db}
+		err := atRepo.DeleteById(atTest.AccessToken)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestDeleteByUser(t *testing.T) {
+	queryCodes := regexp.QuoteMeta(queryDeleteAuthorizationCodesByUser)
+	queryAccessTokens := regexp.QuoteMeta(queryDeleteAccessTokensByUser)
+	queryRefreshTokens := regexp.QuoteMeta(queryDeleteRefreshTokensByUser)
+
+	t.Run("NoError", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectExec(queryCodes).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(queryAccessTokens).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(queryRefreshTokens).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 2))
+
+		atRepo := accessTokenRepository{db: db}
+		err := atRepo.DeleteByUser(1)
+
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ErrorDeleting", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectExec(queryCodes).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(queryAccessTokens).WithArgs(1).WillReturnError(sql.ErrConnDone)
+
+		atRepo := accessTokenRepository{db: db}
+		err := atRepo.DeleteByUser(1)
 
-		assert.Nil(t, at)
 		assert.NotNil(t, err)
-		assert.EqualValues(t, "access_token not found", err.Message())
 	})
 }
 
-func TestLoginUser(t *testing.T) {
+func TestUpdateExpirationTime(t *testing.T) {
+	query := regexp.QuoteMeta(queryUpdateExpires)
+
+	t.Run("NoError", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectExec(query).WithArgs(1637510344, domain.HashAccessToken(atTest.AccessToken), 1637510344).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		atRepo := accessTokenRepository{db: db}
+		err := atRepo.UpdateExpirationTime(atTest.AccessToken, 1637510344)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("NoErrorAlreadyExtended", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectExec(query).WithArgs(1637510344, domain.HashAccessToken(atTest.AccessToken), 1637510344).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		atRepo := accessTokenRepository{db: db}
+		err := atRepo.UpdateExpirationTime(atTest.AccessToken, 1637510344)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("ErrorUpdating", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectExec(query).WillReturnError(sql.ErrConnDone)
+
+		atRepo := accessTokenRepository{db: db}
+		err := atRepo.UpdateExpirationTime(atTest.AccessToken, 1637510344)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestCreateWithRefreshToken(t *testing.T) {
+	queryAccessToken := regexp.QuoteMeta(queryCreateAccessToken)
+	queryRefreshToken := regexp.QuoteMeta(queryCreateRefreshToken)
+
 	t.Run("NoError", func(t *testing.T) {
-		testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
-			rw.WriteHeader(http.StatusOK)
-			rw.Write([]byte(`{"id":1,"first_name":"Oscar","last_name":"Isaac","email": "oscaac@gmail.com","date_created": "2021-11-19 03:07:42","role":"user"}`))
-		}))
-		testServer.Listener.Close()
-		l, _ := net.Listen("tcp", "127.0.0.1:8080")
-		testServer.Listener = l
-		testServer.Start()
-		defer testServer.Close()
+		db, mock := NewMock()
+		mock.ExpectBegin()
+		mock.ExpectExec(queryAccessToken).WithArgs(domain.HashAccessToken(atTest.AccessToken), atTest.UserId, atTest.UserRole, atTest.ClientId, "books:read orders:write", atTest.Expires, atTest.IssuedAt).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(queryRefreshToken).WithArgs(domain.HashAccessToken(rtTest.RefreshToken), rtTest.FamilyId, domain.HashAccessToken(rtTest.AccessToken), rtTest.UserId, rtTest.UserRole, rtTest.ClientId, "books:read orders:write", rtTest.Expires).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		atRepo := accessTokenRepository{db: db}
+		err := atRepo.CreateWithRefreshToken(atTest, rtTest)
+
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ErrorInsertingRefreshToken", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectBegin()
+		mock.ExpectExec(queryAccessToken).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(queryRefreshToken).WillReturnError(sql.ErrConnDone)
+		// the access token goes away with the refresh token
+		mock.ExpectRollback()
+
+		atRepo := accessTokenRepository{db: db}
+		err := atRepo.CreateWithRefreshToken(atTest, rtTest)
+
+		assert.NotNil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
 
-		httpClient := testServer.Client()
-		atRepo := accessTokenRepository{db: nil, rest: httpClient}
+func TestGetRefreshToken(t *testing.T) {
+	query := regexp.QuoteMeta(queryGetRefreshToken)
 
-		user, err := atRepo.LoginUser("oscaac@gmail.com", "password")
+	t.Run("NoError", func(t *testing.T) {
+		db, mock := NewMock()
+		row := mock.NewRows([]string{"refresh_token", "family_id", "access_token", "user_id", "user_role", "client_id", "scopes", "expires", "used"}).
+			AddRow(domain.HashAccessToken(rtTest.RefreshToken), rtTest.FamilyId, domain.HashAccessToken(rtTest.AccessToken), 1, "user", "", "books:read orders:write", 1637510344, true)
+		mock.ExpectPrepare(query).ExpectQuery().WithArgs(domain.HashAccessToken(rtTest.RefreshToken)).WillReturnRows(row)
+
+		atRepo := accessTokenRepository{db: db}
+		rt, err := atRepo.GetRefreshToken(rtTest.RefreshToken)
 
 		assert.Nil(t, err)
-		assert.NotNil(t, user)
-		assert.EqualValues(t, 1, user.Id)
-		assert.EqualValues(t, "oscaac@gmail.com", user.Email)
+		assert.NotNil(t, rt)
+		assert.EqualValues(t, rtTest.RefreshToken, rt.RefreshToken)
+		assert.EqualValues(t, rtTest.FamilyId, rt.FamilyId)
+		assert.EqualValues(t, rtTest.Scopes, rt.Scopes)
+		assert.True(t, rt.Used)
 	})
 
-	t.Run("ErrorSendingRequest", func(t *testing.T) {
-		testServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}))
-		defer testServer.Close()
+	t.Run("ErrorNoRows", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectPrepare(query).ExpectQuery().WillReturnError(sql.ErrNoRows)
 
-		httpClient := testServer.Client()
-		atRepo := accessTokenRepository{db: nil, rest: httpClient}
+		atRepo := accessTokenRepository{db: db}
+		rt, err := atRepo.GetRefreshToken(rtTest.RefreshToken)
 
-		user, err := atRepo.LoginUser("oscaac@gmail.com", "password")
+		assert.Nil(t, rt)
+		assert.NotNil(t, err)
+		assert.EqualValues(t, http.StatusNotFound, err.Status())
+	})
+}
+
+func TestUseRefreshToken(t *testing.T) {
+	query := regexp.QuoteMeta(queryUseRefreshToken)
+
+	t.Run("NoError", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectExec(query).WithArgs(domain.HashAccessToken(rtTest.RefreshToken)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		atRepo := accessTokenRepository{db: db}
+		err := atRepo.UseRefreshToken(rtTest.RefreshToken)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("ErrorAlreadyUsed", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectExec(query).WithArgs(domain.HashAccessToken(rtTest.RefreshToken)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		atRepo := accessTokenRepository{db: db}
+		err := atRepo.UseRefreshToken(rtTest.RefreshToken)
 
-		assert.Nil(t, user)
 		assert.NotNil(t, err)
-		assert.EqualValues(t, `Post "http://localhost:8080/users/login": dial tcp [::1]:8080: connect: connection refused`, err.Message())
+		assert.EqualValues(t, http.StatusConflict, err.Status())
 	})
+}
+
+func TestRevokeRefreshTokenFamily(t *testing.T) {
+	queryAccessTokens := regexp.QuoteMeta(queryDeleteAccessTokenByFamily)
+	queryRefreshTokens := regexp.QuoteMeta(queryDeleteRefreshTokenByFamily)
+
+	t.Run("NoError", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectExec(queryAccessTokens).WithArgs(rtTest.FamilyId).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(queryRefreshTokens).WithArgs(rtTest.FamilyId).WillReturnResult(sqlmock.NewResult(0, 3))
 
-	t.Run("ErrorReceivedFromRequest", func(t *testing.T) {
-		testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
-			rw.WriteHeader(http.StatusBadRequest)
-			rw.Write([]byte(`{"message": "Invalid credentials","status": 400,"error": "bad_request"}`))
-		}))
-		testServer.Listener.Close()
-		l, _ := net.Listen("tcp", "127.0.0.1:8080")
-		testServer.Listener = l
-		testServer.Start()
-		defer testServer.Close()
+		atRepo := accessTokenRepository{db: db}
+		err := atRepo.RevokeRefreshTokenFamily(rtTest.FamilyId)
 
-		httpClient := testServer.Client()
-		atRepo := accessTokenRepository{db: nil, rest: httpClient}
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
 
-		user, err := atRepo.LoginUser("oscaac@gmail.com", "password")
+	t.Run("ErrorDeletingAccessTokens", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectExec(queryAccessTokens).WithArgs(rtTest.FamilyId).WillReturnError(sql.ErrConnDone)
+
+		atRepo := accessTokenRepository{db: db}
+		err := atRepo.RevokeRefreshTokenFamily(rtTest.FamilyId)
 
-		assert.Nil(t, user)
 		assert.NotNil(t, err)
-		assert.EqualValues(t, http.StatusBadRequest, err.Status())
-		assert.EqualValues(t, "Invalid credentials", err.Message())
 	})
 
-	t.Run("ErrorUnmarshalingErrorResponse", func(t *testing.T) {
-		testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
-			rw.WriteHeader(http.StatusBadRequest)
-			rw.Write([]byte(`{"message": "Invalid credentials","status": "400","error": "bad_request"}`))
-		}))
-		testServer.Listener.Close()
-		l, _ := net.Listen("tcp", "127.0.0.1:8080")
-		testServer.Listener = l
-		testServer.Start()
-		defer testServer.Close()
+	t.Run("NoErrorWithEvents", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectBegin()
+		mock.ExpectExec(queryAccessTokens).WithArgs(rtTest.FamilyId).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(queryRefreshTokens).WithArgs(rtTest.FamilyId).WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec(regexp.QuoteMeta(queryInsertOutboxEvent)).WithArgs(oauthEventTest.Id, domain.OAuthEventSessionEnded, sqlmock.AnyArg(), oauthEventTest.OccurredAt.Unix()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		atRepo := accessTokenRepository{db: db}
+		err := atRepo.RevokeRefreshTokenFamily(rtTest.FamilyId, oauthEventTest)
+
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
 
-		httpClient := testServer.Client()
-		atRepo := accessTokenRepository{db: nil, rest: httpClient}
+	t.Run("ErrorDeletingWithEvents", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectBegin()
+		mock.ExpectExec(queryAccessTokens).WithArgs(rtTest.FamilyId).WillReturnError(sql.ErrConnDone)
+		mock.ExpectRollback()
 
-		user, err := atRepo.LoginUser("oscaac@gmail.com", "password")
+		atRepo := accessTokenRepository{db: db}
+		err := atRepo.RevokeRefreshTokenFamily(rtTest.FamilyId, oauthEventTest)
 
-		assert.Nil(t, user)
+		// the event is never recorded
 		assert.NotNil(t, err)
-		assert.EqualValues(t, "invalid restclient response", err.Message())
+		assert.Nil(t, mock.ExpectationsWereMet())
 	})
+}
 
-	t.Run("ErrorUnmarshalingUserResponse", func(t *testing.T) {
-		testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
-			rw.WriteHeader(http.StatusOK)
-			rw.Write([]byte(`{"id":"1","first_name":"Oscar","last_name":"Isaac"}`))
-		}))
-		testServer.Listener.Close()
-		l, _ := net.Listen("tcp", "127.0.0.1:8080")
-		testServer.Listener = l
-		testServer.Start()
-		defer testServer.Close()
+func TestGetAuthorizationCode(t *testing.T) {
+	query := regexp.QuoteMeta(queryGetAuthorizationCode)
 
-		httpClient := testServer.Client()
-		atRepo := accessTokenRepository{db: nil, rest: httpClient}
+	t.Run("NoError", func(t *testing.T) {
+		db, mock := NewMock()
+		row := mock.NewRows([]string{"code", "family_id", "client_id", "redirect_uri", "scope", "nonce", "code_challenge", "code_challenge_method", "user_id", "user_role", "expires", "used"}).
+			AddRow("9a3e8c1d-2b4f-4a6e-8c0d-1e2f3a4b5c6d", "5f1b7c2e-6d3a-4e8f-9b0c-2a4d6e8f0b1c", "spa", "https://spa.bookstore.com/callback", "openid", "n-0S6_WzA2Mj", "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", "S256", 1, "user", 1637510344, false)
+		mock.ExpectPrepare(query).ExpectQuery().WithArgs("9a3e8c1d-2b4f-4a6e-8c0d-1e2f3a4b5c6d").WillReturnRows(row)
+
+		atRepo := accessTokenRepository{db: db}
+		ac, err := atRepo.GetAuthorizationCode("9a3e8c1d-2b4f-4a6e-8c0d-1e2f3a4b5c6d")
 
-		user, err := atRepo.LoginUser("oscaac@gmail.com", "password")
+		assert.Nil(t, err)
+		assert.NotNil(t, ac)
+		assert.EqualValues(t, "5f1b7c2e-6d3a-4e8f-9b0c-2a4d6e8f0b1c", ac.FamilyId)
+		assert.EqualValues(t, "spa", ac.ClientId)
+		assert.EqualValues(t, "https://spa.bookstore.com/callback", ac.RedirectUri)
+		assert.True(t, ac.HasScope("openid"))
+		assert.False(t, ac.Used)
+	})
 
-		assert.Nil(t, user)
+	t.Run("ErrorNoRows", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectPrepare(query).ExpectQuery().WillReturnError(sql.ErrNoRows)
+
+		atRepo := accessTokenRepository{db: db}
+		ac, err := atRepo.GetAuthorizationCode("9a3e8c1d-2b4f-4a6e-8c0d-1e2f3a4b5c6d")
+
+		assert.Nil(t, ac)
 		assert.NotNil(t, err)
-		assert.EqualValues(t, "error when trying to unmarshal users response", err.Message())
+		assert.EqualValues(t, http.StatusNotFound, err.Status())
 	})
 }
 
-// func TestDeleteById(t testing.T) {
-// 	query := regexp.QuoteMeta(queryDeleteAccessToken)
-// 	db, mock := NewMock()
-// 		mock.ExpectPrepare(query).WillReturnError(errors.New(""))
+func TestUseAuthorizationCode(t *testing.T) {
+	query := regexp.QuoteMeta(queryUseAuthorizationCode)
 
-// 		atRepo := accessTokenRepository{db: db, rest: nil}
-// 		at, err := atRepo.GetById("084a4a0f-92cc-46e6-9b57-1d2aed3c389e")
+	t.Run("NoError", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectExec(query).WithArgs("9a3e8c1d-2b4f-4a6e-8c0d-1e2f3a4b5c6d").WillReturnResult(sqlmock.NewResult(0, 1))
 
-// 		assert.Nil(t, at)
-// 		assert.NotNil(t, err)
-// }
+		atRepo := accessTokenRepository{db: db}
+		err := atRepo.UseAuthorizationCode("9a3e8c1d-2b4f-4a6e-8c0d-1e2f3a4b5c6d")
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("ErrorAlreadyUsed", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectExec(query).WithArgs("9a3e8c1d-2b4f-4a6e-8c0d-1e2f3a4b5c6d").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		atRepo := accessTokenRepository{db: db}
+		err := atRepo.UseAuthorizationCode("9a3e8c1d-2b4f-4a6e-8c0d-1e2f3a4b5c6d")
+
+		assert.NotNil(t, err)
+		assert.EqualValues(t, http.StatusConflict, err.Status())
+	})
+}
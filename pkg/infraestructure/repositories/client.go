@@ -0,0 +1,57 @@
+package repositories
+
+import (
+	"database/sql"
+	"strings"
+	"sync"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+)
+
+var (
+	onceClientRepo     sync.Once
+	instanceClientRepo *clientRepository
+)
+
+type clientRepository struct {
+	db *sql.DB
+}
+
+func NewClientRepository(db *sql.DB) ports.ClientRepository {
+	onceClientRepo.Do(func() {
+		instanceClientRepo = &clientRepository{
+			db: db,
+		}
+	})
+	return instanceClientRepo
+}
+
+const (
+	queryGetClient = "SELECT client_id, client_secret, grant_types, scopes, redirect_uris, access_token_ttl FROM oauth_clients WHERE client_id=?;"
+)
+
+func (r *clientRepository) GetById(clientId string) (*domain.Client, rest_errors.RestErr) {
+	stmt, err := r.db.Prepare(queryGetClient)
+	if err != nil {
+		return nil, rest_errors.NewInternalServerError("db error")
+	}
+	defer stmt.Close()
+
+	var client domain.Client
+	var grants, scopes, redirectUris string
+	result := stmt.QueryRow(clientId)
+	if err := result.Scan(&client.ClientId, &client.ClientSecret, &grants, &scopes, &redirectUris, &client.AccessTokenTTL); err != nil {
+		if strings.Contains(err.Error(), errNoRow) {
+			return nil, rest_errors.NewNotFoundError("client not found")
+		}
+		return nil, rest_errors.NewInternalServerError("db error")
+	}
+
+	// grants, scopes and redirect uris are stored as space separated lists
+	client.Grants = strings.Fields(grants)
+	client.Scopes = strings.Fields(scopes)
+	client.RedirectUris = strings.Fields(redirectUris)
+	return &client, nil
+}
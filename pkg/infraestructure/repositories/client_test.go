@@ -0,0 +1,43 @@
+package repositories
+
+import (
+	"database/sql"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetClientById(t *testing.T) {
+	query := regexp.QuoteMeta(queryGetClient)
+
+	t.Run("NoError", func(t *testing.T) {
+		db, mock := NewMock()
+		row := mock.NewRows([]string{"client_id", "client_secret", "grant_types", "scopes", "redirect_uris", "access_token_ttl"}).
+			AddRow("catalog", "$2a$10$hash", "client_credentials refresh_token", "books:read books:write", "", 3600)
+		mock.ExpectPrepare(query).ExpectQuery().WithArgs("catalog").WillReturnRows(row)
+
+		cRepo := clientRepository{db: db}
+		client, err := cRepo.GetById("catalog")
+
+		assert.Nil(t, err)
+		assert.NotNil(t, client)
+		assert.EqualValues(t, []string{"client_credentials", "refresh_token"}, client.Grants)
+		assert.EqualValues(t, []string{"books:read", "books:write"}, client.Scopes)
+		assert.EqualValues(t, 3600, client.AccessTokenTTL)
+		assert.Empty(t, client.RedirectUris)
+	})
+
+	t.Run("ErrorNoRows", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectPrepare(query).ExpectQuery().WillReturnError(sql.ErrNoRows)
+
+		cRepo := clientRepository{db: db}
+		client, err := cRepo.GetById("catalog")
+
+		assert.Nil(t, client)
+		assert.NotNil(t, err)
+		assert.EqualValues(t, http.StatusNotFound, err.Status())
+	})
+}
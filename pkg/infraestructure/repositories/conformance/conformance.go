@@ -0,0 +1,456 @@
+// Package conformance holds the behaviour every storage backend must have,
+// the tests of each backend run it against their own repositories
+package conformance
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TokenRepositories are the repositories of a backend that share the token
+// writes, the outbox gets the events passed to them
+type TokenRepositories struct {
+	AccessTokens ports.AccessTokenRepository
+	Outbox       ports.OutboxRepository
+}
+
+// AccessTokenRepository runs the suite, every call to newRepos must return
+// repositories with nothing stored
+func AccessTokenRepository(t *testing.T, newRepos func(t *testing.T) TokenRepositories) {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	newAccessToken := func(id string, userId int64) domain.AccessToken {
+		return domain.AccessToken{
+			AccessToken: id,
+			UserId:      userId,
+			UserRole:    "user",
+			ClientId:    "spa",
+			Scopes:      []string{"books:read", "orders:write"},
+			Expires:     now.Add(time.Hour).Unix(),
+			IssuedAt:    now.Unix(),
+		}
+	}
+	newRefreshToken := func(id string, familyId string, at domain.AccessToken) domain.RefreshToken {
+		return domain.RefreshToken{
+			RefreshToken: id,
+			FamilyId:     familyId,
+			AccessToken:  at.AccessToken,
+			UserId:       at.UserId,
+			UserRole:     at.UserRole,
+			ClientId:     at.ClientId,
+			Scopes:       at.Scopes,
+			Expires:      now.Add(24 * time.Hour).Unix(),
+		}
+	}
+	newCode := func(code string, userId int64) domain.AuthorizationCode {
+		return domain.AuthorizationCode{
+			Code:                code,
+			FamilyId:            "family-" + code,
+			ClientId:            "spa",
+			RedirectUri:         "https://spa.bookstore.com/callback",
+			Scope:               "openid books:read",
+			Nonce:               "n-0S6_WzA2Mj",
+			CodeChallenge:       "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+			CodeChallengeMethod: domain.CodeChallengeMethodS256,
+			UserId:              userId,
+			UserRole:            "user",
+			Expires:             now.Add(10 * time.Minute).Unix(),
+		}
+	}
+	assertNotFound := func(t *testing.T, repo ports.AccessTokenRepository, ids ...string) {
+		t.Helper()
+		for _, id := range ids {
+			_, err := repo.GetById(id)
+			if assert.NotNil(t, err, id) {
+				assert.EqualValues(t, http.StatusNotFound, err.Status(), id)
+			}
+		}
+	}
+
+	t.Run("CreateAndGetById", func(t *testing.T) {
+		repo := newRepos(t).AccessTokens
+		at := newAccessToken("at-1", 1)
+		require.Nil(t, repo.Create(at))
+
+		got, err := repo.GetById("at-1")
+
+		require.Nil(t, err)
+		assert.EqualValues(t, at.AccessToken, got.AccessToken)
+		assert.EqualValues(t, at.UserId, got.UserId)
+		assert.EqualValues(t, at.UserRole, got.UserRole)
+		assert.EqualValues(t, at.ClientId, got.ClientId)
+		assert.EqualValues(t, at.Scopes, got.Scopes)
+		assert.EqualValues(t, at.Expires, got.Expires)
+		assert.EqualValues(t, at.IssuedAt, got.IssuedAt)
+
+		// what is stored can't be used as a token
+		assertNotFound(t, repo, domain.HashAccessToken("at-1"))
+	})
+
+	t.Run("GetByIdNotFound", func(t *testing.T) {
+		repo := newRepos(t).AccessTokens
+
+		assertNotFound(t, repo, "unknown")
+	})
+
+	t.Run("DeleteById", func(t *testing.T) {
+		repo := newRepos(t).AccessTokens
+		at := newAccessToken("at-1", 1)
+		require.Nil(t, repo.CreateWithRefreshToken(at, newRefreshToken("rt-1", "family-1", at)))
+
+		require.Nil(t, repo.DeleteById("at-1"))
+
+		assertNotFound(t, repo, "at-1")
+		_, err := repo.GetRefreshToken("rt-1")
+		assert.NotNil(t, err)
+		// deleting a token that doesn't exist is not an error
+		assert.Nil(t, repo.DeleteById("unknown"))
+	})
+
+	t.Run("DeleteByUser", func(t *testing.T) {
+		repo := newRepos(t).AccessTokens
+		mine, theirs := newAccessToken("at-1", 1), newAccessToken("at-2", 2)
+		require.Nil(t, repo.CreateWithRefreshToken(mine, newRefreshToken("rt-1", "family-1", mine)))
+		require.Nil(t, repo.CreateWithRefreshToken(theirs, newRefreshToken("rt-2", "family-2", theirs)))
+		require.Nil(t, repo.CreateAuthorizationCode(newCode("code-1", 1)))
+		require.Nil(t, repo.CreateAuthorizationCode(newCode("code-2", 2)))
+
+		require.Nil(t, repo.DeleteByUser(1))
+
+		assertNotFound(t, repo, "at-1")
+		_, err := repo.GetRefreshToken("rt-1")
+		assert.NotNil(t, err)
+		_, err = repo.GetAuthorizationCode("code-1")
+		assert.NotNil(t, err)
+
+		_, err = repo.GetById("at-2")
+		assert.Nil(t, err)
+		_, err = repo.GetRefreshToken("rt-2")
+		assert.Nil(t, err)
+		_, err = repo.GetAuthorizationCode("code-2")
+		assert.Nil(t, err)
+	})
+
+	t.Run("UpdateExpirationTime", func(t *testing.T) {
+		repo := newRepos(t).AccessTokens
+		at := newAccessToken("at-1", 1)
+		require.Nil(t, repo.Create(at))
+
+		later := at.Expires + 3600
+		require.Nil(t, repo.UpdateExpirationTime("at-1", later))
+		got, _ := repo.GetById("at-1")
+		assert.EqualValues(t, later, got.Expires)
+
+		// the expiration never moves back
+		require.Nil(t, repo.UpdateExpirationTime("at-1", at.Expires))
+		got, _ = repo.GetById("at-1")
+		assert.EqualValues(t, later, got.Expires)
+	})
+
+	t.Run("RefreshTokens", func(t *testing.T) {
+		repo := newRepos(t).AccessTokens
+		at := newAccessToken("at-1", 1)
+		rt := newRefreshToken("rt-1", "family-1", at)
+		require.Nil(t, repo.CreateWithRefreshToken(at, rt))
+
+		_, err := repo.GetById("at-1")
+		require.Nil(t, err)
+		got, err := repo.GetRefreshToken("rt-1")
+		require.Nil(t, err)
+		// only the hash of the access token is kept
+		rt.AccessToken = domain.HashAccessToken(at.AccessToken)
+		assert.EqualValues(t, rt, *got)
+		// nor is the refresh token kept as is
+		_, err = repo.GetRefreshToken(domain.HashAccessToken("rt-1"))
+		assert.NotNil(t, err)
+
+		require.Nil(t, repo.UseRefreshToken("rt-1"))
+		got, _ = repo.GetRefreshToken("rt-1")
+		assert.True(t, got.Used)
+
+		// only the first use wins
+		err = repo.UseRefreshToken("rt-1")
+		if assert.NotNil(t, err) {
+			assert.EqualValues(t, http.StatusConflict, err.Status())
+		}
+
+		_, err = repo.GetRefreshToken("unknown")
+		if assert.NotNil(t, err) {
+			assert.EqualValues(t, http.StatusNotFound, err.Status())
+		}
+	})
+
+	t.Run("RevokeRefreshTokenFamily", func(t *testing.T) {
+		repo := newRepos(t).AccessTokens
+		first, second, other := newAccessToken("at-1", 1), newAccessToken("at-2", 1), newAccessToken("at-3", 1)
+		require.Nil(t, repo.CreateWithRefreshToken(first, newRefreshToken("rt-1", "family-1", first)))
+		require.Nil(t, repo.CreateWithRefreshToken(second, newRefreshToken("rt-2", "family-1", second)))
+		require.Nil(t, repo.CreateWithRefreshToken(other, newRefreshToken("rt-3", "family-2", other)))
+
+		require.Nil(t, repo.RevokeRefreshTokenFamily("family-1"))
+
+		assertNotFound(t, repo, "at-1", "at-2")
+		for _, id := range []string{"rt-1", "rt-2"} {
+			_, err := repo.GetRefreshToken(id)
+			assert.NotNil(t, err, id)
+		}
+		_, err := repo.GetById("at-3")
+		assert.Nil(t, err)
+		_, err = repo.GetRefreshToken("rt-3")
+		assert.Nil(t, err)
+	})
+
+	t.Run("AuthorizationCodes", func(t *testing.T) {
+		repo := newRepos(t).AccessTokens
+		ac := newCode("code-1", 1)
+		require.Nil(t, repo.CreateAuthorizationCode(ac))
+
+		got, err := repo.GetAuthorizationCode("code-1")
+		require.Nil(t, err)
+		assert.EqualValues(t, ac, *got)
+
+		require.Nil(t, repo.UseAuthorizationCode("code-1"))
+		got, _ = repo.GetAuthorizationCode("code-1")
+		assert.True(t, got.Used)
+
+		err = repo.UseAuthorizationCode("code-1")
+		if assert.NotNil(t, err) {
+			assert.EqualValues(t, http.StatusConflict, err.Status())
+		}
+
+		_, err = repo.GetAuthorizationCode("unknown")
+		if assert.NotNil(t, err) {
+			assert.EqualValues(t, http.StatusNotFound, err.Status())
+		}
+	})
+
+	t.Run("Outbox", func(t *testing.T) {
+		repos := newRepos(t)
+		at := newAccessToken("at-1", 1)
+		issued := domain.OAuthEvent{
+			Id:         "event-1",
+			Type:       domain.OAuthEventTokenIssued,
+			OccurredAt: now,
+			UserId:     1,
+			ClientId:   "spa",
+			SessionId:  "family-1",
+			Scopes:     at.Scopes,
+			Expires:    at.Expires,
+		}
+		revoked := domain.OAuthEvent{
+			Id:         "event-2",
+			Type:       domain.OAuthEventTokenRevoked,
+			OccurredAt: now,
+			UserId:     1,
+			Reason:     domain.OAuthEventReasonRevoked,
+		}
+		require.Nil(t, repos.AccessTokens.CreateWithRefreshToken(at, newRefreshToken("rt-1", "family-1", at), issued))
+		require.Nil(t, repos.AccessTokens.DeleteById("at-1", revoked))
+
+		events, err := repos.Outbox.Pending(10)
+		require.Nil(t, err)
+		assert.EqualValues(t, []domain.OAuthEvent{issued, revoked}, events)
+
+		events, _ = repos.Outbox.Pending(1)
+		assert.Len(t, events, 1)
+
+		require.Nil(t, repos.Outbox.MarkPublished([]string{"event-1"}))
+		events, _ = repos.Outbox.Pending(10)
+		assert.EqualValues(t, []domain.OAuthEvent{revoked}, events)
+
+		// pending events aren't purged however old they are
+		_, err = repos.Outbox.PurgePublished(now.Add(time.Hour), 10)
+		require.Nil(t, err)
+		events, _ = repos.Outbox.Pending(10)
+		assert.EqualValues(t, []domain.OAuthEvent{revoked}, events)
+	})
+
+	t.Run("OutboxLead", func(t *testing.T) {
+		repos := newRepos(t)
+
+		leader, err := repos.Outbox.Lead()
+		require.Nil(t, err)
+		assert.True(t, leader)
+		repos.Outbox.Resign()
+	})
+}
+
+// UsersRepository runs the suite, every call to newRepo must return a
+// repository with nothing stored
+func UsersRepository(t *testing.T, newRepo func(t *testing.T) ports.UsersRepository) {
+	newUser := func(id int64) domain.User {
+		return domain.User{
+			Id:       id,
+			Email:    fmt.Sprintf("user%d@bookstore.com", id),
+			Password: "$2a$10$hash",
+			Role:     "user",
+		}
+	}
+	event := func(id string, eventType string, version int64, user domain.User) *domain.UserEvent {
+		return &domain.UserEvent{
+			Id:          id,
+			Type:        eventType,
+			Version:     1,
+			UserVersion: version,
+			User:        user,
+		}
+	}
+	assertUser := func(t *testing.T, repo ports.UsersRepository, want *domain.User, id int64) {
+		t.Helper()
+		got, err := repo.GetById(id)
+		if want == nil {
+			if assert.NotNil(t, err) {
+				assert.EqualValues(t, http.StatusNotFound, err.Status())
+			}
+			return
+		}
+		if assert.Nil(t, err) {
+			assert.EqualValues(t, *want, *got)
+		}
+	}
+
+	t.Run("SaveAndGet", func(t *testing.T) {
+		repo := newRepo(t)
+		user := newUser(1)
+		require.Nil(t, repo.Save(&user))
+
+		assertUser(t, repo, &user, 1)
+		got, err := repo.GetByEmail(user.Email)
+		require.Nil(t, err)
+		assert.EqualValues(t, user, *got)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		repo := newRepo(t)
+
+		assertUser(t, repo, nil, 1)
+		_, err := repo.GetByEmail("nobody@bookstore.com")
+		if assert.NotNil(t, err) {
+			assert.EqualValues(t, http.StatusNotFound, err.Status())
+		}
+	})
+
+	t.Run("SaveConflict", func(t *testing.T) {
+		repo := newRepo(t)
+		user := newUser(1)
+		require.Nil(t, repo.Save(&user))
+
+		err := repo.Save(&user)
+
+		if assert.NotNil(t, err) {
+			assert.EqualValues(t, http.StatusConflict, err.Status())
+		}
+	})
+
+	t.Run("UpdateAndDelete", func(t *testing.T) {
+		repo := newRepo(t)
+		user := newUser(1)
+
+		// a user that isn't stored yet is inserted
+		require.Nil(t, repo.Update(&user))
+		assertUser(t, repo, &user, 1)
+
+		admin := user
+		admin.Role = "admin"
+		require.Nil(t, repo.Update(&admin))
+		assertUser(t, repo, &admin, 1)
+
+		other := newUser(2)
+		other.Email = user.Email
+		err := repo.Update(&other)
+		if assert.NotNil(t, err) {
+			assert.EqualValues(t, http.StatusConflict, err.Status())
+		}
+
+		require.Nil(t, repo.Delete(1))
+		assertUser(t, repo, nil, 1)
+		assert.Nil(t, repo.Delete(1))
+	})
+
+	t.Run("Apply", func(t *testing.T) {
+		repo := newRepo(t)
+		user := newUser(1)
+
+		result, err := repo.Apply(event("event-1", domain.UserEventRegister, 1, user), nil)
+		require.Nil(t, err)
+		assert.True(t, result.Applied)
+		assert.Nil(t, result.Previous)
+		assertUser(t, repo, &user, 1)
+
+		// the same event twice is applied once
+		result, err = repo.Apply(event("event-1", domain.UserEventRegister, 1, user), nil)
+		require.Nil(t, err)
+		assert.False(t, result.Applied)
+
+		admin := user
+		admin.Role = "admin"
+		result, err = repo.Apply(event("event-3", domain.UserEventUpdate, 3, admin), nil)
+		require.Nil(t, err)
+		assert.True(t, result.Applied)
+		if assert.NotNil(t, result.Previous) {
+			assert.EqualValues(t, user, *result.Previous)
+		}
+		assertUser(t, repo, &admin, 1)
+
+		// an update that arrives after a newer one changes nothing
+		result, err = repo.Apply(event("event-2", domain.UserEventUpdate, 2, user), nil)
+		require.Nil(t, err)
+		assert.False(t, result.Applied)
+		assertUser(t, repo, &admin, 1)
+
+		result, err = repo.Apply(event("event-4", domain.UserEventDelete, 4, admin), nil)
+		require.Nil(t, err)
+		assert.True(t, result.Applied)
+		assertUser(t, repo, nil, 1)
+
+		// nor does it bring back a deleted user
+		result, err = repo.Apply(event("event-2b", domain.UserEventUpdate, 2, user), nil)
+		require.Nil(t, err)
+		assert.False(t, result.Applied)
+		assertUser(t, repo, nil, 1)
+	})
+
+	t.Run("ApplyThenFails", func(t *testing.T) {
+		repo := newRepo(t)
+		user := newUser(1)
+
+		failed := rest_errors.NewInternalServerError("revoking tokens failed")
+		_, err := repo.Apply(event("event-1", domain.UserEventRegister, 1, user), func(*domain.UserEventResult) rest_errors.RestErr {
+			return failed
+		})
+		assert.EqualValues(t, failed, err)
+		assertUser(t, repo, nil, 1)
+
+		// nothing was recorded, so the redelivered event applies
+		called := false
+		result, err := repo.Apply(event("event-1", domain.UserEventRegister, 1, user), func(result *domain.UserEventResult) rest_errors.RestErr {
+			called = result.Applied
+			return nil
+		})
+		require.Nil(t, err)
+		assert.True(t, result.Applied)
+		assert.True(t, called)
+		assertUser(t, repo, &user, 1)
+	})
+
+	t.Run("ApplyLegacyEvents", func(t *testing.T) {
+		repo := newRepo(t)
+		user := newUser(1)
+
+		// events without id or version are applied every time
+		for i := 0; i < 2; i++ {
+			result, err := repo.Apply(event("", domain.UserEventUpdate, 0, user), nil)
+			require.Nil(t, err)
+			assert.True(t, result.Applied)
+		}
+		assertUser(t, repo, &user, 1)
+	})
+}
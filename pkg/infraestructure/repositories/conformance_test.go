@@ -0,0 +1,49 @@
+package repositories
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/infraestructure/repositories/conformance"
+)
+
+// openConformanceDB connects to OAUTH_TEST_MYSQL_DSN, a database with the
+// migrations applied, and empties the tables the suite uses
+func openConformanceDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("OAUTH_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("OAUTH_TEST_MYSQL_DSN not set")
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatalf("opening db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, table := range []string{"access_tokens", "refresh_tokens", "authorization_codes", "users", "user_events", "user_versions", "oauth_outbox"} {
+		if _, err := db.Exec("TRUNCATE TABLE " + table + ";"); err != nil {
+			t.Fatalf("truncating %s: %v", table, err)
+		}
+	}
+	return db
+}
+
+// the constructors return singletons, the suite needs a repository per db
+func TestAccessTokenRepositoryConformance(t *testing.T) {
+	conformance.AccessTokenRepository(t, func(t *testing.T) conformance.TokenRepositories {
+		db := openConformanceDB(t)
+		return conformance.TokenRepositories{
+			AccessTokens: &accessTokenRepository{db: db},
+			Outbox:       &outboxRepository{db: db},
+		}
+	})
+}
+
+func TestUsersRepositoryConformance(t *testing.T) {
+	conformance.UsersRepository(t, func(t *testing.T) ports.UsersRepository {
+		return &usersRepository{db: openConformanceDB(t)}
+	})
+}
@@ -0,0 +1,159 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"expvar"
+	"log"
+	"sync"
+	"time"
+)
+
+// janitorLock is the MySQL advisory lock held by the replica that purges,
+// it's released by the server when the connection holding it goes away
+const janitorLock = "bookstore_oauth_janitor"
+
+const (
+	queryPurgeAccessTokens       = "DELETE FROM access_tokens WHERE expires<? LIMIT ?;"
+	queryPurgeRefreshTokens      = "DELETE FROM refresh_tokens WHERE expires<? LIMIT ?;"
+	queryPurgeAuthorizationCodes = "DELETE FROM authorization_codes WHERE expires<? LIMIT ?;"
+	// sessions are created after the first refresh token of their family,
+	// one without any left has ended
+	queryPurgeSessions = "DELETE FROM sessions WHERE NOT EXISTS (SELECT 1 FROM refresh_tokens WHERE refresh_tokens.family_id=sessions.id) LIMIT ?;"
+)
+
+// janitorMetrics are published on /debug/vars, counters add up the rows
+// purged from each table since the process started
+var janitorMetrics = expvar.NewMap("janitor")
+
+// Janitor deletes the expired tokens, authorization codes and the sessions
+// left without refresh tokens, in batches so no delete holds locks for
+// long. Only the replica holding the advisory lock purges.
+type Janitor struct {
+	db        *sql.DB
+	batchSize int
+
+	mu   sync.Mutex
+	lock advisoryLock
+}
+
+func NewJanitor(db *sql.DB, batchSize int) *Janitor {
+	return &Janitor{
+		db:        db,
+		batchSize: batchSize,
+		lock:      advisoryLock{db: db, name: janitorLock},
+	}
+}
+
+// Start purges every interval until the returned func is called, the lock
+// is released then so another replica can take over right away
+func (j *Janitor) Start(interval time.Duration) func() {
+	done := make(chan struct{})
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := j.Purge(); err != nil {
+					log.Printf("error while purging expired tokens: %v", err)
+				}
+			case <-done:
+				ticker.Stop()
+				j.mu.Lock()
+				j.lock.release()
+				j.mu.Unlock()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// Purge deletes everything expired when this replica is the leader, it
+// returns how many rows were deleted
+func (j *Janitor) Purge() (int64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	ctx := context.Background()
+	// deletes run on the connection holding the lock so they fail if it's
+	// lost
+	leader, err := j.lock.hold(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !leader {
+		janitorMetrics.Set("leader", intVar(0))
+		return 0, nil
+	}
+	janitorMetrics.Set("leader", intVar(1))
+
+	start := time.Now()
+	now := start.UTC().Unix()
+	purges := []struct {
+		metric string
+		query  string
+		args   []interface{}
+	}{
+		{"purged_access_tokens", queryPurgeAccessTokens, []interface{}{now}},
+		{"purged_refresh_tokens", queryPurgeRefreshTokens, []interface{}{now}},
+		{"purged_authorization_codes", queryPurgeAuthorizationCodes, []interface{}{now}},
+		// after the refresh tokens, so the sessions they ended go too
+		{"purged_sessions", queryPurgeSessions, nil},
+	}
+
+	var purged int64
+	for _, purge := range purges {
+		rows, err := j.purge(ctx, purge.query, purge.args...)
+		janitorMetrics.Add(purge.metric, rows)
+		purged += rows
+		if err != nil {
+			// the connection may be gone and the lock with it
+			j.lock.release()
+			return purged, err
+		}
+	}
+
+	duration := time.Since(start)
+	janitorMetrics.Add("runs", 1)
+	janitorMetrics.Set("last_run_duration_seconds", floatVar(duration.Seconds()))
+	janitorMetrics.Set("last_run_purged", intVar(purged))
+	log.Printf("janitor purged %d rows in %v", purged, duration)
+
+	return purged, nil
+}
+
+// purge runs query in batches until a batch deletes less than a full one
+func (j *Janitor) purge(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	args = append(args, j.batchSize)
+
+	var purged int64
+	for {
+		result, err := j.lock.conn.ExecContext(ctx, query, args...)
+		if err != nil {
+			return purged, err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return purged, err
+		}
+		purged += rows
+		if rows < int64(j.batchSize) {
+			return purged, nil
+		}
+	}
+}
+
+func intVar(value int64) *expvar.Int {
+	v := new(expvar.Int)
+	v.Set(value)
+	return v
+}
+
+func floatVar(value float64) *expvar.Float {
+	v := new(expvar.Float)
+	v.Set(value)
+	return v
+}
@@ -0,0 +1,61 @@
+package repositories
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJanitorPurge(t *testing.T) {
+	lock := regexp.QuoteMeta(queryGetLock)
+
+	t.Run("NotLeader", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectQuery(lock).WithArgs(janitorLock).WillReturnRows(mock.NewRows([]string{"locked"}).AddRow(0))
+
+		purged, err := NewJanitor(db, 2).Purge()
+
+		assert.Nil(t, err)
+		assert.EqualValues(t, 0, purged)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("NoError", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectQuery(lock).WithArgs(janitorLock).WillReturnRows(mock.NewRows([]string{"locked"}).AddRow(1))
+		// a full batch is followed by another one
+		mock.ExpectExec(regexp.QuoteMeta(queryPurgeAccessTokens)).WithArgs(sqlmock.AnyArg(), 2).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(regexp.QuoteMeta(queryPurgeAccessTokens)).WithArgs(sqlmock.AnyArg(), 2).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(queryPurgeRefreshTokens)).WithArgs(sqlmock.AnyArg(), 2).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(queryPurgeAuthorizationCodes)).WithArgs(sqlmock.AnyArg(), 2).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(queryPurgeSessions)).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		janitor := NewJanitor(db, 2)
+		purged, err := janitor.Purge()
+
+		assert.Nil(t, err)
+		assert.EqualValues(t, 5, purged)
+		assert.EqualValues(t, "5", janitorMetrics.Get("last_run_purged").String())
+		assert.EqualValues(t, "1", janitorMetrics.Get("leader").String())
+		assert.NotNil(t, janitor.lock.conn)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ErrorPurging", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectQuery(lock).WithArgs(janitorLock).WillReturnRows(mock.NewRows([]string{"locked"}).AddRow(1))
+		mock.ExpectExec(regexp.QuoteMeta(queryPurgeAccessTokens)).WithArgs(sqlmock.AnyArg(), 2).WillReturnError(sql.ErrConnDone)
+		mock.ExpectQuery(regexp.QuoteMeta(queryReleaseLock)).WithArgs(janitorLock).WillReturnRows(mock.NewRows([]string{"released"}).AddRow(1))
+
+		janitor := NewJanitor(db, 2)
+		_, err := janitor.Purge()
+
+		assert.NotNil(t, err)
+		// the lock is let go, the next run has to win it again
+		assert.Nil(t, janitor.lock.conn)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"log"
+)
+
+const (
+	queryGetLock     = "SELECT GET_LOCK(?, 0);"
+	queryReleaseLock = "SELECT RELEASE_LOCK(?);"
+)
+
+// advisoryLock elects a leader among the replicas with a MySQL advisory
+// lock, it's released by the server when the connection holding it goes
+// away
+type advisoryLock struct {
+	db   *sql.DB
+	name string
+
+	// conn holds the lock while this replica is the leader
+	conn *sql.Conn
+}
+
+// hold tells whether this replica holds the lock, taking it when it's free
+func (l *advisoryLock) hold(ctx context.Context) (bool, error) {
+	if l.conn != nil {
+		if err := l.conn.PingContext(ctx); err == nil {
+			return true, nil
+		}
+		l.conn.Close()
+		l.conn = nil
+	}
+
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	// GET_LOCK returns NULL on errors, 0 when another session holds it
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, queryGetLock, l.name).Scan(&locked); err != nil {
+		conn.Close()
+		return false, err
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		conn.Close()
+		return false, nil
+	}
+
+	l.conn = conn
+	return true, nil
+}
+
+func (l *advisoryLock) release() {
+	if l.conn == nil {
+		return
+	}
+	var released sql.NullInt64
+	if err := l.conn.QueryRowContext(context.Background(), queryReleaseLock, l.name).Scan(&released); err != nil {
+		log.Printf("error while releasing lock %s: %v", l.name, err)
+	}
+	l.conn.Close()
+	l.conn = nil
+}
@@ -0,0 +1,195 @@
+package memory
+
+import (
+	"net/http"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+)
+
+type accessTokenRepository struct {
+	store *Store
+}
+
+func NewAccessTokenRepository(store *Store) ports.AccessTokenRepository {
+	return &accessTokenRepository{
+		store: store,
+	}
+}
+
+func (r *accessTokenRepository) Create(at domain.AccessToken, events ...domain.OAuthEvent) rest_errors.RestErr {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.create(at)
+	r.store.addEvents(events)
+	return nil
+}
+
+// create must be called holding the lock of the store
+func (r *accessTokenRepository) create(at domain.AccessToken) {
+	// only what the sql backends have columns for is kept, tokens are
+	// hashed the same way so refresh tokens point to the same values
+	hash := domain.HashAccessToken(at.AccessToken)
+	r.store.accessTokens[hash] = domain.AccessToken{
+		AccessToken: hash,
+		UserId:      at.UserId,
+		UserRole:    at.UserRole,
+		ClientId:    at.ClientId,
+		Scopes:      copyScopes(at.Scopes),
+		Expires:     at.Expires,
+		IssuedAt:    at.IssuedAt,
+	}
+}
+
+func (r *accessTokenRepository) GetById(id string) (*domain.AccessToken, rest_errors.RestErr) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	at, ok := r.store.accessTokens[domain.HashAccessToken(id)]
+	if !ok {
+		return nil, rest_errors.NewNotFoundError("access_token not found")
+	}
+	at.AccessToken = id
+	at.Scopes = copyScopes(at.Scopes)
+	return &at, nil
+}
+
+func (r *accessTokenRepository) DeleteById(id string, events ...domain.OAuthEvent) rest_errors.RestErr {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	hash := domain.HashAccessToken(id)
+	delete(r.store.accessTokens, hash)
+	for token, rt := range r.store.refreshTokens {
+		if rt.AccessToken == hash {
+			delete(r.store.refreshTokens, token)
+		}
+	}
+	r.store.addEvents(events)
+	return nil
+}
+
+func (r *accessTokenRepository) DeleteByUser(userId int64, events ...domain.OAuthEvent) rest_errors.RestErr {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for code, ac := range r.store.codes {
+		if ac.UserId == userId {
+			delete(r.store.codes, code)
+		}
+	}
+	for token, at := range r.store.accessTokens {
+		if at.UserId == userId {
+			delete(r.store.accessTokens, token)
+		}
+	}
+	for token, rt := range r.store.refreshTokens {
+		if rt.UserId == userId {
+			delete(r.store.refreshTokens, token)
+		}
+	}
+	r.store.addEvents(events)
+	return nil
+}
+
+func (r *accessTokenRepository) UpdateExpirationTime(id string, expires int64) rest_errors.RestErr {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	hash := domain.HashAccessToken(id)
+	if at, ok := r.store.accessTokens[hash]; ok && at.Expires < expires {
+		at.Expires = expires
+		r.store.accessTokens[hash] = at
+	}
+	return nil
+}
+
+func (r *accessTokenRepository) CreateWithRefreshToken(at domain.AccessToken, rt domain.RefreshToken, events ...domain.OAuthEvent) rest_errors.RestErr {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.create(at)
+	rt.Used = false
+	rt.RefreshToken = domain.HashAccessToken(rt.RefreshToken)
+	rt.AccessToken = domain.HashAccessToken(rt.AccessToken)
+	rt.Scopes = copyScopes(rt.Scopes)
+	r.store.refreshTokens[rt.RefreshToken] = rt
+	r.store.addEvents(events)
+	return nil
+}
+
+func (r *accessTokenRepository) GetRefreshToken(token string) (*domain.RefreshToken, rest_errors.RestErr) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	rt, ok := r.store.refreshTokens[domain.HashAccessToken(token)]
+	if !ok {
+		return nil, rest_errors.NewNotFoundError("refresh_token not found")
+	}
+	rt.RefreshToken = token
+	rt.Scopes = copyScopes(rt.Scopes)
+	return &rt, nil
+}
+
+func (r *accessTokenRepository) UseRefreshToken(token string) rest_errors.RestErr {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	hash := domain.HashAccessToken(token)
+	rt, ok := r.store.refreshTokens[hash]
+	if !ok || rt.Used {
+		return rest_errors.NewRestError("refresh_token already used", http.StatusConflict, "conflict")
+	}
+	rt.Used = true
+	r.store.refreshTokens[hash] = rt
+	return nil
+}
+
+func (r *accessTokenRepository) RevokeRefreshTokenFamily(familyId string, events ...domain.OAuthEvent) rest_errors.RestErr {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for token, rt := range r.store.refreshTokens {
+		if rt.FamilyId == familyId {
+			delete(r.store.accessTokens, rt.AccessToken)
+			delete(r.store.refreshTokens, token)
+		}
+	}
+	r.store.addEvents(events)
+	return nil
+}
+
+func (r *accessTokenRepository) CreateAuthorizationCode(ac domain.AuthorizationCode) rest_errors.RestErr {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	ac.Used = false
+	r.store.codes[ac.Code] = ac
+	return nil
+}
+
+func (r *accessTokenRepository) GetAuthorizationCode(code string) (*domain.AuthorizationCode, rest_errors.RestErr) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	ac, ok := r.store.codes[code]
+	if !ok {
+		return nil, rest_errors.NewNotFoundError("authorization_code not found")
+	}
+	return &ac, nil
+}
+
+func (r *accessTokenRepository) UseAuthorizationCode(code string) rest_errors.RestErr {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	ac, ok := r.store.codes[code]
+	if !ok || ac.Used {
+		return rest_errors.NewRestError("authorization_code already used", http.StatusConflict, "conflict")
+	}
+	ac.Used = true
+	r.store.codes[code] = ac
+	return nil
+}
@@ -0,0 +1,24 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/infraestructure/repositories/conformance"
+)
+
+func TestAccessTokenRepository(t *testing.T) {
+	conformance.AccessTokenRepository(t, func(t *testing.T) conformance.TokenRepositories {
+		store := NewStore()
+		return conformance.TokenRepositories{
+			AccessTokens: NewAccessTokenRepository(store),
+			Outbox:       NewOutboxRepository(store),
+		}
+	})
+}
+
+func TestUsersRepository(t *testing.T) {
+	conformance.UsersRepository(t, func(t *testing.T) ports.UsersRepository {
+		return NewUsersRepository(NewStore())
+	})
+}
@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"time"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+)
+
+type outboxRepository struct {
+	store *Store
+}
+
+func NewOutboxRepository(store *Store) ports.OutboxRepository {
+	return &outboxRepository{
+		store: store,
+	}
+}
+
+func (r *outboxRepository) Pending(limit int) ([]domain.OAuthEvent, rest_errors.RestErr) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	events := []domain.OAuthEvent{}
+	for _, event := range r.store.outbox {
+		if len(events) == limit {
+			break
+		}
+		event.Scopes = copyScopes(event.Scopes)
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// MarkPublished drops the published events, nobody reads them again
+func (r *outboxRepository) MarkPublished(ids []string) rest_errors.RestErr {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	published := map[string]bool{}
+	for _, id := range ids {
+		published[id] = true
+	}
+
+	pending := []domain.OAuthEvent{}
+	for _, event := range r.store.outbox {
+		if !published[event.Id] {
+			pending = append(pending, event)
+		}
+	}
+	r.store.outbox = pending
+	return nil
+}
+
+// PurgePublished has nothing to do, published events are already dropped
+func (r *outboxRepository) PurgePublished(before time.Time, limit int) (int64, rest_errors.RestErr) {
+	return 0, nil
+}
+
+// Lead always succeeds, the store lives in a single process
+func (r *outboxRepository) Lead() (bool, rest_errors.RestErr) {
+	return true, nil
+}
+
+func (r *outboxRepository) Resign() {}
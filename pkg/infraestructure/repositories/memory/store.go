@@ -0,0 +1,57 @@
+// Package memory keeps everything in process, it's meant for local
+// development and tests. Nothing survives a restart and replicas don't
+// share anything.
+package memory
+
+import (
+	"sync"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+)
+
+// Store is an in memory database, the repositories built on the same store
+// see each other's writes the way the MySQL ones share a database. Every
+// write holds the lock for its whole duration, so writes are as atomic as
+// a transaction.
+type Store struct {
+	mu sync.Mutex
+
+	accessTokens  map[string]domain.AccessToken
+	refreshTokens map[string]domain.RefreshToken
+	codes         map[string]domain.AuthorizationCode
+
+	users        map[int64]domain.User
+	userEvents   map[string]struct{}
+	userVersions map[int64]int64
+
+	// outbox keeps the pending events in the order they were added
+	outbox []domain.OAuthEvent
+}
+
+func NewStore() *Store {
+	return &Store{
+		accessTokens:  map[string]domain.AccessToken{},
+		refreshTokens: map[string]domain.RefreshToken{},
+		codes:         map[string]domain.AuthorizationCode{},
+		users:         map[int64]domain.User{},
+		userEvents:    map[string]struct{}{},
+		userVersions:  map[int64]int64{},
+	}
+}
+
+// addEvents must be called with the lock held, by the write the events
+// tell about
+func (s *Store) addEvents(events []domain.OAuthEvent) {
+	for _, event := range events {
+		event.Scopes = copyScopes(event.Scopes)
+		s.outbox = append(s.outbox, event)
+	}
+}
+
+// copyScopes keeps callers from changing what's stored through the slice
+func copyScopes(scopes []string) []string {
+	if scopes == nil {
+		return nil
+	}
+	return append([]string{}, scopes...)
+}
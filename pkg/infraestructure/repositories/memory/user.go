@@ -0,0 +1,160 @@
+package memory
+
+import (
+	"net/http"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+)
+
+type usersRepository struct {
+	store *Store
+}
+
+func NewUsersRepository(store *Store) ports.UsersRepository {
+	return &usersRepository{
+		store: store,
+	}
+}
+
+func (r *usersRepository) GetByEmail(email string) (*domain.User, rest_errors.RestErr) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, user := range r.store.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, rest_errors.NewNotFoundError("user not found")
+}
+
+func (r *usersRepository) GetById(id int64) (*domain.User, rest_errors.RestErr) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[id]
+	if !ok {
+		return nil, rest_errors.NewNotFoundError("user not found")
+	}
+	return &user, nil
+}
+
+func (r *usersRepository) Save(user *domain.User) rest_errors.RestErr {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[user.Id]; ok || r.emailTaken(user) {
+		return rest_errors.NewRestError("email already in user", http.StatusConflict, "conflict")
+	}
+	r.store.users[user.Id] = *user
+	return nil
+}
+
+func (r *usersRepository) Update(user *domain.User) rest_errors.RestErr {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	return r.update(user)
+}
+
+func (r *usersRepository) Delete(id int64) rest_errors.RestErr {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	delete(r.store.users, id)
+	return nil
+}
+
+// update is Update for callers already holding the lock
+func (r *usersRepository) update(user *domain.User) rest_errors.RestErr {
+	if r.emailTaken(user) {
+		return rest_errors.NewRestError("email already in user", http.StatusConflict, "conflict")
+	}
+	r.store.users[user.Id] = *user
+	return nil
+}
+
+// Apply works the same way as the MySQL one, versions are kept after a
+// user is deleted so a late update can't bring it back. then may use the
+// tokens kept in the same store, so it runs unlocked and the event is
+// checked again before it's recorded.
+func (r *usersRepository) Apply(event *domain.UserEvent, then func(*domain.UserEventResult) rest_errors.RestErr) (*domain.UserEventResult, rest_errors.RestErr) {
+	r.store.mu.Lock()
+	result, err := r.check(event)
+	r.store.mu.Unlock()
+	if err != nil || !result.Applied {
+		return result, err
+	}
+
+	if then != nil {
+		if err := then(result); err != nil {
+			return nil, err
+		}
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	// another delivery of the event may have been applied meanwhile
+	if again, err := r.check(event); err != nil || !again.Applied {
+		return again, err
+	}
+
+	userId := event.User.Id
+	switch event.Type {
+	case domain.UserEventDelete:
+		delete(r.store.users, userId)
+	default:
+		if err := r.update(&event.User); err != nil {
+			return nil, err
+		}
+	}
+
+	if event.Id != "" {
+		r.store.userEvents[event.Id] = struct{}{}
+	}
+	if event.UserVersion > 0 {
+		r.store.userVersions[userId] = event.UserVersion
+	}
+	return result, nil
+}
+
+// check tells whether the event applies and what it would replace, the ids
+// of events too old to apply are recorded right away
+func (r *usersRepository) check(event *domain.UserEvent) (*domain.UserEventResult, rest_errors.RestErr) {
+	userId := event.User.Id
+	if event.Id != "" {
+		if _, ok := r.store.userEvents[event.Id]; ok {
+			return &domain.UserEventResult{Applied: false}, nil
+		}
+	}
+
+	if event.UserVersion > 0 && event.UserVersion <= r.store.userVersions[userId] {
+		if event.Id != "" {
+			r.store.userEvents[event.Id] = struct{}{}
+		}
+		return &domain.UserEventResult{Applied: false}, nil
+	}
+
+	if event.Type != domain.UserEventDelete && r.emailTaken(&event.User) {
+		return nil, rest_errors.NewRestError("email already in user", http.StatusConflict, "conflict")
+	}
+
+	result := domain.UserEventResult{Applied: true}
+	if previous, ok := r.store.users[userId]; ok {
+		result.Previous = &previous
+	}
+	return &result, nil
+}
+
+// emailTaken tells whether another user has the email of user
+func (r *usersRepository) emailTaken(user *domain.User) bool {
+	for id, other := range r.store.users {
+		if id != user.Id && other.Email == user.Email {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,358 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationLock keeps replicas that start together from migrating at once,
+// the ones that wait find the migrations already applied
+const migrationLock = "bookstore_oauth_migrate"
+
+// migrationLockTimeout is how long a replica waits for another to migrate,
+// in seconds
+const migrationLockTimeout = 300
+
+const (
+	queryGetMigrationLock     = "SELECT GET_LOCK(?, ?);"
+	queryReleaseMigrationLock = "SELECT RELEASE_LOCK(?);"
+
+	queryCreateSchemaVersions = "CREATE TABLE IF NOT EXISTS schema_versions (version bigint PRIMARY KEY NOT NULL, dirty boolean NOT NULL, applied_at bigint NOT NULL);"
+
+	queryGetSchemaVersions   = "SELECT version, dirty FROM schema_versions ORDER BY version;"
+	queryInsertSchemaVersion = "INSERT INTO schema_versions(version, dirty, applied_at) VALUES (?, true, ?);"
+	queryCleanSchemaVersion  = "UPDATE schema_versions SET dirty=false WHERE version=?;"
+	queryDirtySchemaVersion  = "UPDATE schema_versions SET dirty=true WHERE version=?;"
+	queryDeleteSchemaVersion = "DELETE FROM schema_versions WHERE version=?;"
+
+	// the table the migrate cli kept its version in, read once to carry
+	// the schema of existing deploys over
+	queryHasLegacySchemaVersion = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema=DATABASE() AND table_name='schema_migrations';"
+	queryGetLegacySchemaVersion = "SELECT version, dirty FROM schema_migrations LIMIT 1;"
+)
+
+// Migration is a version of the schema and whether it's applied
+type Migration struct {
+	Version int64
+	Name    string
+	Applied bool
+	// Dirty migrations failed half way, the schema has to be fixed by hand
+	// and the version deleted from schema_versions before migrating again
+	Dirty bool
+
+	up   string
+	down string
+}
+
+// Migrator applies the migrations in files, every statement of a version
+// runs in order. MySQL commits DDL right away, so a version that fails
+// half way is left dirty instead of being rolled back.
+type Migrator struct {
+	db    *sql.DB
+	files fs.FS
+}
+
+func NewMigrator(db *sql.DB, files fs.FS) *Migrator {
+	return &Migrator{
+		db:    db,
+		files: files,
+	}
+}
+
+// Up applies every migration that isn't applied yet, it returns how many
+func (m *Migrator) Up() (int, error) {
+	applied := 0
+	err := m.locked(func(conn *sql.Conn, migrations []Migration) error {
+		for _, migration := range migrations {
+			if migration.Applied {
+				continue
+			}
+			if err := m.up(conn, migration); err != nil {
+				return err
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the last steps applied migrations, newest first
+func (m *Migrator) Down(steps int) (int, error) {
+	reverted := 0
+	err := m.locked(func(conn *sql.Conn, migrations []Migration) error {
+		for i := len(migrations) - 1; i >= 0 && reverted < steps; i-- {
+			if !migrations[i].Applied {
+				continue
+			}
+			if err := m.down(conn, migrations[i]); err != nil {
+				return err
+			}
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists every migration, oldest first
+func (m *Migrator) Status() ([]Migration, error) {
+	var status []Migration
+	err := m.locked(func(conn *sql.Conn, migrations []Migration) error {
+		status = migrations
+		return nil
+	})
+	return status, err
+}
+
+// locked runs f holding the migration lock, with the migrations as they
+// are right after it was taken. A dirty migration stops everything.
+func (m *Migrator) locked(f func(*sql.Conn, []Migration) error) error {
+	ctx := context.Background()
+
+	migrations, err := m.load()
+	if err != nil {
+		return err
+	}
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, queryGetMigrationLock, migrationLock, migrationLockTimeout).Scan(&locked); err != nil {
+		return err
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		return fmt.Errorf("couldn't take the %s lock", migrationLock)
+	}
+	defer func() {
+		var released sql.NullInt64
+		if err := conn.QueryRowContext(ctx, queryReleaseMigrationLock, migrationLock).Scan(&released); err != nil {
+			log.Printf("error while releasing migration lock: %v", err)
+		}
+	}()
+
+	if err := m.markApplied(conn, migrations); err != nil {
+		return err
+	}
+	for _, migration := range migrations {
+		if migration.Dirty {
+			return fmt.Errorf("migration %d is dirty, fix the schema and delete it from schema_versions", migration.Version)
+		}
+	}
+
+	return f(conn, migrations)
+}
+
+// markApplied fills in which migrations are applied, the first time it
+// runs on a schema the migrate cli managed it takes its version over
+func (m *Migrator) markApplied(conn *sql.Conn, migrations []Migration) error {
+	ctx := context.Background()
+
+	if _, err := conn.ExecContext(ctx, queryCreateSchemaVersions); err != nil {
+		return err
+	}
+
+	versions, err := m.versions(conn)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		if versions, err = m.legacyVersions(conn, migrations); err != nil {
+			return err
+		}
+	}
+
+	for i := range migrations {
+		dirty, ok := versions[migrations[i].Version]
+		migrations[i].Applied = ok
+		migrations[i].Dirty = dirty
+	}
+	return nil
+}
+
+// versions returns the applied versions and whether they are dirty
+func (m *Migrator) versions(conn *sql.Conn) (map[int64]bool, error) {
+	rows, err := conn.QueryContext(context.Background(), queryGetSchemaVersions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := map[int64]bool{}
+	for rows.Next() {
+		var version int64
+		var dirty bool
+		if err := rows.Scan(&version, &dirty); err != nil {
+			return nil, err
+		}
+		versions[version] = dirty
+	}
+	return versions, rows.Err()
+}
+
+// legacyVersions records every migration up to the version in
+// schema_migrations as applied
+func (m *Migrator) legacyVersions(conn *sql.Conn, migrations []Migration) (map[int64]bool, error) {
+	ctx := context.Background()
+	versions := map[int64]bool{}
+
+	var tables int
+	if err := conn.QueryRowContext(ctx, queryHasLegacySchemaVersion).Scan(&tables); err != nil {
+		return nil, err
+	}
+	if tables == 0 {
+		return versions, nil
+	}
+
+	var legacy int64
+	var dirty bool
+	if err := conn.QueryRowContext(ctx, queryGetLegacySchemaVersion).Scan(&legacy, &dirty); err != nil {
+		if err == sql.ErrNoRows {
+			return versions, nil
+		}
+		return nil, err
+	}
+	if dirty {
+		return nil, fmt.Errorf("schema_migrations is dirty at version %d, fix it with the migrate cli first", legacy)
+	}
+
+	now := time.Now().UTC().Unix()
+	for _, migration := range migrations {
+		if migration.Version > legacy {
+			break
+		}
+		if _, err := conn.ExecContext(ctx, queryInsertSchemaVersion, migration.Version, now); err != nil {
+			return nil, err
+		}
+		if _, err := conn.ExecContext(ctx, queryCleanSchemaVersion, migration.Version); err != nil {
+			return nil, err
+		}
+		versions[migration.Version] = false
+	}
+	log.Printf("schema taken over from schema_migrations at version %d", legacy)
+	return versions, nil
+}
+
+// up marks the version dirty until every statement ran
+func (m *Migrator) up(conn *sql.Conn, migration Migration) error {
+	ctx := context.Background()
+
+	if _, err := conn.ExecContext(ctx, queryInsertSchemaVersion, migration.Version, time.Now().UTC().Unix()); err != nil {
+		return err
+	}
+	if err := execStatements(conn, migration.up); err != nil {
+		return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+	if _, err := conn.ExecContext(ctx, queryCleanSchemaVersion, migration.Version); err != nil {
+		return err
+	}
+
+	log.Printf("migration %d_%s applied", migration.Version, migration.Name)
+	return nil
+}
+
+func (m *Migrator) down(conn *sql.Conn, migration Migration) error {
+	ctx := context.Background()
+
+	if _, err := conn.ExecContext(ctx, queryDirtySchemaVersion, migration.Version); err != nil {
+		return err
+	}
+	if err := execStatements(conn, migration.down); err != nil {
+		return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+	if _, err := conn.ExecContext(ctx, queryDeleteSchemaVersion, migration.Version); err != nil {
+		return err
+	}
+
+	log.Printf("migration %d_%s reverted", migration.Version, migration.Name)
+	return nil
+}
+
+// load reads the migrations in files ordered by version, every version
+// needs both its up and its down file
+func (m *Migrator) load() ([]Migration, error) {
+	paths, err := fs.Glob(m.files, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, path := range paths {
+		name := strings.TrimSuffix(path, ".sql")
+		direction := name[strings.LastIndex(name, ".")+1:]
+		name = strings.TrimSuffix(name, "."+direction)
+
+		separator := strings.Index(name, "_")
+		if separator < 0 || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %q", path)
+		}
+		version, err := strconv.ParseInt(name[:separator], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration file name %q", path)
+		}
+
+		content, err := fs.ReadFile(m.files, path)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name[separator+1:]}
+			byVersion[version] = migration
+		}
+		if direction == "up" {
+			migration.up = string(content)
+		} else {
+			migration.down = string(content)
+		}
+	}
+
+	migrations := []Migration{}
+	for _, migration := range byVersion {
+		if migration.up == "" || migration.down == "" {
+			return nil, fmt.Errorf("migration %d needs an up and a down file", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// execStatements runs the statements of a migration one by one, the
+// connection isn't opened with multiStatements. Migrations have no
+// semicolons other than the ones ending their statements.
+func execStatements(conn *sql.Conn, migration string) error {
+	for _, statement := range strings.Split(migration, ";") {
+		if isComment(statement) {
+			continue
+		}
+		if _, err := conn.ExecContext(context.Background(), statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isComment tells whether statement has nothing but comments and spaces
+func isComment(statement string) bool {
+	for _, line := range strings.Split(statement, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package repositories
+
+import (
+	"regexp"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/FacuBar/bookstore_oauth-api/migration"
+	"github.com/stretchr/testify/assert"
+)
+
+var migrationsTest = fstest.MapFS{
+	"000002_init_schema.up.sql":      {Data: []byte("CREATE TABLE `a` (`id` bigint);\n\nCREATE TABLE `b` (`id` bigint)")},
+	"000002_init_schema.down.sql":    {Data: []byte("DROP TABLE IF EXISTS `a`;\nDROP TABLE IF EXISTS `b`")},
+	"000010_sessions.up.sql":         {Data: []byte("-- sessions of the users;\nCREATE TABLE `c` (`id` bigint);\n")},
+	"000010_sessions.down.sql":       {Data: []byte("DROP TABLE IF EXISTS `c`")},
+	"000003_refresh_tokens.up.sql":   {Data: []byte("CREATE TABLE `d` (`id` bigint);")},
+	"000003_refresh_tokens.down.sql": {Data: []byte("DROP TABLE IF EXISTS `d`")},
+}
+
+// expectLocked expects the migration lock to be taken and the applied
+// versions to be read, with no schema_migrations to take over
+func expectLocked(mock sqlmock.Sqlmock, versions *sqlmock.Rows) {
+	mock.ExpectQuery(regexp.QuoteMeta(queryGetMigrationLock)).WithArgs(migrationLock, migrationLockTimeout).WillReturnRows(mock.NewRows([]string{"locked"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta(queryCreateSchemaVersions)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(queryGetSchemaVersions)).WillReturnRows(versions)
+}
+
+func expectReleased(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta(queryReleaseMigrationLock)).WithArgs(migrationLock).WillReturnRows(mock.NewRows([]string{"released"}).AddRow(1))
+}
+
+func TestMigratorUp(t *testing.T) {
+	t.Run("NoError", func(t *testing.T) {
+		db, mock := NewMock()
+		expectLocked(mock, mock.NewRows([]string{"version", "dirty"}).AddRow(2, false))
+		// versions are applied in order, gaps and all
+		mock.ExpectExec(regexp.QuoteMeta(queryInsertSchemaVersion)).WithArgs(3, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE `d` (`id` bigint)")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(queryCleanSchemaVersion)).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(queryInsertSchemaVersion)).WithArgs(10, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE `c` (`id` bigint)")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(queryCleanSchemaVersion)).WithArgs(10).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectReleased(mock)
+
+		applied, err := NewMigrator(db, migrationsTest).Up()
+
+		assert.Nil(t, err)
+		assert.EqualValues(t, 2, applied)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("TakesOverSchemaMigrations", func(t *testing.T) {
+		db, mock := NewMock()
+		expectLocked(mock, mock.NewRows([]string{"version", "dirty"}))
+		mock.ExpectQuery(regexp.QuoteMeta(queryHasLegacySchemaVersion)).WillReturnRows(mock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery(regexp.QuoteMeta(queryGetLegacySchemaVersion)).WillReturnRows(mock.NewRows([]string{"version", "dirty"}).AddRow(10, false))
+		for _, version := range []int{2, 3, 10} {
+			mock.ExpectExec(regexp.QuoteMeta(queryInsertSchemaVersion)).WithArgs(version, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectExec(regexp.QuoteMeta(queryCleanSchemaVersion)).WithArgs(version).WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		expectReleased(mock)
+
+		applied, err := NewMigrator(db, migrationsTest).Up()
+
+		assert.Nil(t, err)
+		assert.EqualValues(t, 0, applied)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ErrorDirty", func(t *testing.T) {
+		db, mock := NewMock()
+		expectLocked(mock, mock.NewRows([]string{"version", "dirty"}).AddRow(2, false).AddRow(3, true))
+		expectReleased(mock)
+
+		applied, err := NewMigrator(db, migrationsTest).Up()
+
+		assert.NotNil(t, err)
+		assert.EqualValues(t, 0, applied)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ErrorLockTaken", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectQuery(regexp.QuoteMeta(queryGetMigrationLock)).WithArgs(migrationLock, migrationLockTimeout).WillReturnRows(mock.NewRows([]string{"locked"}).AddRow(0))
+
+		_, err := NewMigrator(db, migrationsTest).Up()
+
+		assert.NotNil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestMigratorDown(t *testing.T) {
+	db, mock := NewMock()
+	expectLocked(mock, mock.NewRows([]string{"version", "dirty"}).AddRow(2, false).AddRow(3, false))
+	// the newest applied version goes first
+	mock.ExpectExec(regexp.QuoteMeta(queryDirtySchemaVersion)).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS `d`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(queryDeleteSchemaVersion)).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectReleased(mock)
+
+	reverted, err := NewMigrator(db, migrationsTest).Down(1)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, reverted)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMigratorLoad(t *testing.T) {
+	t.Run("Embedded", func(t *testing.T) {
+		migrations, err := NewMigrator(nil, migration.Files).load()
+
+		assert.Nil(t, err)
+		assert.NotEmpty(t, migrations)
+		for i := 1; i < len(migrations); i++ {
+			assert.Less(t, migrations[i-1].Version, migrations[i].Version)
+		}
+	})
+
+	t.Run("ErrorMissingDown", func(t *testing.T) {
+		_, err := NewMigrator(nil, fstest.MapFS{"000002_init_schema.up.sql": {Data: []byte("SELECT 1")}}).load()
+
+		assert.NotNil(t, err)
+	})
+}
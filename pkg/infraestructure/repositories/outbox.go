@@ -0,0 +1,170 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+)
+
+var (
+	onceOutboxRepo     sync.Once
+	instanceOutboxRepo *outboxRepository
+)
+
+// relayLock is the advisory lock held by the replica relaying the outbox
+const relayLock = "bookstore_oauth_relay"
+
+type outboxRepository struct {
+	db *sql.DB
+
+	mu   sync.Mutex
+	lock advisoryLock
+}
+
+func NewOutboxRepository(db *sql.DB) ports.OutboxRepository {
+	onceOutboxRepo.Do(func() {
+		instanceOutboxRepo = &outboxRepository{
+			db:   db,
+			lock: advisoryLock{db: db, name: relayLock},
+		}
+	})
+	return instanceOutboxRepo
+}
+
+const (
+	queryInsertOutboxEvent = "INSERT INTO oauth_outbox(id, type, payload, occurred_at) VALUES (?, ?, ?, ?);"
+
+	queryGetPendingOutboxEvents = "SELECT id, type, payload, occurred_at FROM oauth_outbox WHERE published_at IS NULL ORDER BY seq LIMIT ?;"
+
+	queryMarkOutboxEventsPublished = "UPDATE oauth_outbox SET published_at=? WHERE id IN (%s);"
+
+	queryPurgePublishedOutboxEvents = "DELETE FROM oauth_outbox WHERE published_at<? LIMIT ?;"
+)
+
+func (r *outboxRepository) Pending(limit int) ([]domain.OAuthEvent, rest_errors.RestErr) {
+	rows, err := r.db.Query(queryGetPendingOutboxEvents, limit)
+	if err != nil {
+		return nil, rest_errors.NewInternalServerError("db error")
+	}
+	defer rows.Close()
+
+	events := []domain.OAuthEvent{}
+	for rows.Next() {
+		var event domain.OAuthEvent
+		var payload string
+		var occurredAt int64
+		if err := rows.Scan(&event.Id, &event.Type, &payload, &occurredAt); err != nil {
+			return nil, rest_errors.NewInternalServerError("db error")
+		}
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			return nil, rest_errors.NewInternalServerError("invalid outbox event payload")
+		}
+		event.OccurredAt = time.Unix(occurredAt, 0).UTC()
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, rest_errors.NewInternalServerError("db error")
+	}
+
+	return events, nil
+}
+
+func (r *outboxRepository) MarkPublished(ids []string) rest_errors.RestErr {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	args := []interface{}{time.Now().UTC().Unix()}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+
+	if _, err := r.db.Exec(fmt.Sprintf(queryMarkOutboxEventsPublished, placeholders), args...); err != nil {
+		return rest_errors.NewInternalServerError("db error")
+	}
+	return nil
+}
+
+func (r *outboxRepository) PurgePublished(before time.Time, limit int) (int64, rest_errors.RestErr) {
+	result, err := r.db.Exec(queryPurgePublishedOutboxEvents, before.UTC().Unix(), limit)
+	if err != nil {
+		return 0, rest_errors.NewInternalServerError("db error")
+	}
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, rest_errors.NewInternalServerError("db error")
+	}
+	return purged, nil
+}
+
+func (r *outboxRepository) Lead() (bool, rest_errors.RestErr) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	leader, err := r.lock.hold(context.Background())
+	if err != nil {
+		return false, rest_errors.NewInternalServerError("db error")
+	}
+	return leader, nil
+}
+
+func (r *outboxRepository) Resign() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lock.release()
+}
+
+// execer runs statements either on their own or as part of a transaction
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Prepare(query string) (*sql.Stmt, error)
+}
+
+// withEvents runs write and adds events to the outbox in one transaction,
+// so an event is only ever published if the write it tells about was
+// committed. Without events write isn't wrapped in a transaction.
+func withEvents(db *sql.DB, events []domain.OAuthEvent, write func(execer) rest_errors.RestErr) rest_errors.RestErr {
+	if len(events) == 0 {
+		return write(db)
+	}
+	return inTransaction(db, events, write)
+}
+
+// inTransaction is withEvents for writes of more than one statement, they
+// are wrapped in a transaction even without events
+func inTransaction(db *sql.DB, events []domain.OAuthEvent, write func(execer) rest_errors.RestErr) rest_errors.RestErr {
+	tx, err := db.Begin()
+	if err != nil {
+		return rest_errors.NewInternalServerError("db error")
+	}
+	defer tx.Rollback()
+
+	if err := write(tx); err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return rest_errors.NewInternalServerError("invalid outbox event payload")
+		}
+		if _, err := tx.Exec(queryInsertOutboxEvent, event.Id, event.Type, string(payload), event.OccurredAt.Unix()); err != nil {
+			return rest_errors.NewInternalServerError("db error")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return rest_errors.NewInternalServerError("db error")
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package repositories
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+var oauthEventTest = domain.OAuthEvent{
+	Id:         "4e7a2c9b-1d3f-4b8a-9e6c-5f0a1b2c3d4e",
+	Type:       domain.OAuthEventSessionEnded,
+	OccurredAt: time.Unix(1637337544, 0).UTC(),
+	UserId:     1,
+	SessionId:  "c3e9d6b2-8f4a-4e1b-a7c5-0d2f9b6e4a33",
+	Reason:     domain.OAuthEventReasonRevoked,
+}
+
+func TestGetPendingOutboxEvents(t *testing.T) {
+	query := regexp.QuoteMeta(queryGetPendingOutboxEvents)
+
+	t.Run("NoError", func(t *testing.T) {
+		db, mock := NewMock()
+		rows := mock.NewRows([]string{"id", "type", "payload", "occurred_at"}).
+			AddRow(oauthEventTest.Id, oauthEventTest.Type, `{"user_id":1,"session_id":"c3e9d6b2-8f4a-4e1b-a7c5-0d2f9b6e4a33","reason":"revoked"}`, 1637337544).
+			AddRow("8b1c3d5e-7f9a-4b2c-8d4e-6f8a0b2c4d6e", domain.OAuthEventTokenIssued, `{"client_id":"reports","scopes":["books:read"],"expires":1637510344}`, 1637337545)
+		mock.ExpectQuery(query).WithArgs(100).WillReturnRows(rows)
+
+		oRepo := outboxRepository{db: db}
+		events, err := oRepo.Pending(100)
+
+		assert.Nil(t, err)
+		assert.Len(t, events, 2)
+		assert.EqualValues(t, oauthEventTest, events[0])
+		assert.EqualValues(t, "reports", events[1].ClientId)
+		assert.EqualValues(t, []string{"books:read"}, events[1].Scopes)
+	})
+
+	t.Run("ErrorQuerying", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectQuery(query).WillReturnError(sql.ErrConnDone)
+
+		oRepo := outboxRepository{db: db}
+		events, err := oRepo.Pending(100)
+
+		assert.Nil(t, events)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestMarkOutboxEventsPublished(t *testing.T) {
+	t.Run("NoError", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE oauth_outbox SET published_at=? WHERE id IN (?, ?);")).
+			WithArgs(sqlmock.AnyArg(), "a", "b").WillReturnResult(sqlmock.NewResult(0, 2))
+
+		oRepo := outboxRepository{db: db}
+		err := oRepo.MarkPublished([]string{"a", "b"})
+
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("NoEvents", func(t *testing.T) {
+		db, mock := NewMock()
+
+		oRepo := outboxRepository{db: db}
+		err := oRepo.MarkPublished(nil)
+
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPurgePublishedOutboxEvents(t *testing.T) {
+	query := regexp.QuoteMeta(queryPurgePublishedOutboxEvents)
+	before := time.Unix(1637337544, 0)
+
+	t.Run("NoError", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectExec(query).WithArgs(1637337544, 10).WillReturnResult(sqlmock.NewResult(0, 3))
+
+		oRepo := outboxRepository{db: db}
+		purged, err := oRepo.PurgePublished(before, 10)
+
+		assert.Nil(t, err)
+		assert.EqualValues(t, 3, purged)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ErrorDeleting", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectExec(query).WillReturnError(sql.ErrConnDone)
+
+		oRepo := outboxRepository{db: db}
+		_, err := oRepo.PurgePublished(before, 10)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestLeadOutbox(t *testing.T) {
+	lock := regexp.QuoteMeta(queryGetLock)
+
+	t.Run("NotLeader", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectQuery(lock).WithArgs(relayLock).WillReturnRows(mock.NewRows([]string{"locked"}).AddRow(0))
+
+		oRepo := outboxRepository{db: db, lock: advisoryLock{db: db, name: relayLock}}
+		leader, err := oRepo.Lead()
+
+		assert.Nil(t, err)
+		assert.False(t, leader)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("LeaderUntilResigned", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectQuery(lock).WithArgs(relayLock).WillReturnRows(mock.NewRows([]string{"locked"}).AddRow(1))
+		mock.ExpectQuery(regexp.QuoteMeta(queryReleaseLock)).WithArgs(relayLock).WillReturnRows(mock.NewRows([]string{"released"}).AddRow(1))
+
+		oRepo := outboxRepository{db: db, lock: advisoryLock{db: db, name: relayLock}}
+		leader, err := oRepo.Lead()
+		assert.Nil(t, err)
+		assert.True(t, leader)
+
+		// the lock is kept, it's not asked for again
+		leader, _ = oRepo.Lead()
+		assert.True(t, leader)
+
+		oRepo.Resign()
+		assert.Nil(t, oRepo.lock.conn)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
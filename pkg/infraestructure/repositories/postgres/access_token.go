@@ -0,0 +1,192 @@
+package postgres
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+)
+
+type accessTokenRepository struct {
+	db *sql.DB
+}
+
+func NewAccessTokenRepository(db *sql.DB) ports.AccessTokenRepository {
+	return &accessTokenRepository{
+		db: db,
+	}
+}
+
+const (
+	queryGetAccessToken = "SELECT access_token, user_id, user_role, client_id, scopes, expires, issued_at FROM access_tokens WHERE access_token=$1;"
+
+	queryCreateAccessToken = "INSERT INTO access_tokens(access_token, user_id, user_role, client_id, scopes, expires, issued_at) VALUES ($1, $2, $3, $4, $5, $6, $7);"
+
+	queryDeleteAccessToken               = "DELETE FROM access_tokens WHERE access_token=$1;"
+	queryDeleteRefreshTokenByAccessToken = "DELETE FROM refresh_tokens WHERE access_token=$1;"
+
+	queryDeleteAccessTokensByUser       = "DELETE FROM access_tokens WHERE user_id=$1;"
+	queryDeleteRefreshTokensByUser      = "DELETE FROM refresh_tokens WHERE user_id=$1;"
+	queryDeleteAuthorizationCodesByUser = "DELETE FROM authorization_codes WHERE user_id=$1;"
+
+	queryCreateRefreshToken = "INSERT INTO refresh_tokens(refresh_token, family_id, access_token, user_id, user_role, client_id, scopes, expires) VALUES ($1, $2, $3, $4, $5, $6, $7, $8);"
+
+	queryGetRefreshToken = "SELECT refresh_token, family_id, access_token, user_id, user_role, client_id, scopes, expires, used FROM refresh_tokens WHERE refresh_token=$1;"
+
+	queryUseRefreshToken = "UPDATE refresh_tokens SET used=true WHERE refresh_token=$1 AND used=false;"
+
+	queryDeleteAccessTokenByFamily  = "DELETE FROM access_tokens WHERE access_token IN (SELECT access_token FROM refresh_tokens WHERE family_id=$1);"
+	queryDeleteRefreshTokenByFamily = "DELETE FROM refresh_tokens WHERE family_id=$1;"
+
+	queryCreateAuthorizationCode = "INSERT INTO authorization_codes(code, family_id, client_id, redirect_uri, scope, nonce, code_challenge, code_challenge_method, user_id, user_role, expires) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);"
+
+	queryGetAuthorizationCode = "SELECT code, family_id, client_id, redirect_uri, scope, nonce, code_challenge, code_challenge_method, user_id, user_role, expires, used FROM authorization_codes WHERE code=$1;"
+
+	queryUseAuthorizationCode = "UPDATE authorization_codes SET used=true WHERE code=$1 AND used=false;"
+
+	queryUpdateExpires = "UPDATE access_tokens SET expires=$1 WHERE access_token=$2 AND expires<$1;"
+)
+
+func (r *accessTokenRepository) Create(at domain.AccessToken, events ...domain.OAuthEvent) rest_errors.RestErr {
+	return withEvents(r.db, events, func(db execer) rest_errors.RestErr {
+		if _, err := db.Exec(queryCreateAccessToken, domain.HashAccessToken(at.AccessToken), at.UserId, at.UserRole, at.ClientId, domain.FormatScopes(at.Scopes), at.Expires, at.IssuedAt); err != nil {
+			return rest_errors.NewInternalServerError("db error")
+		}
+		return nil
+	})
+}
+
+// GetById looks the token up by its hash, the token returned carries the id
+// it was looked up with
+func (r *accessTokenRepository) GetById(id string) (*domain.AccessToken, rest_errors.RestErr) {
+	var at domain.AccessToken
+	var scopes string
+	result := r.db.QueryRow(queryGetAccessToken, domain.HashAccessToken(id))
+	if err := result.Scan(&at.AccessToken, &at.UserId, &at.UserRole, &at.ClientId, &scopes, &at.Expires, &at.IssuedAt); err != nil {
+		if isNoRows(err) {
+			return nil, rest_errors.NewNotFoundError("access_token not found")
+		}
+		return nil, rest_errors.NewInternalServerError("db error")
+	}
+	at.AccessToken = id
+	at.Scopes = domain.ParseScopes(scopes)
+
+	return &at, nil
+}
+
+func (r *accessTokenRepository) DeleteById(id string, events ...domain.OAuthEvent) rest_errors.RestErr {
+	return withEvents(r.db, events, func(db execer) rest_errors.RestErr {
+		for _, query := range []string{queryDeleteAccessToken, queryDeleteRefreshTokenByAccessToken} {
+			if _, err := db.Exec(query, domain.HashAccessToken(id)); err != nil {
+				return rest_errors.NewInternalServerError("db error")
+			}
+		}
+		return nil
+	})
+}
+
+func (r *accessTokenRepository) DeleteByUser(userId int64, events ...domain.OAuthEvent) rest_errors.RestErr {
+	return withEvents(r.db, events, func(db execer) rest_errors.RestErr {
+		// codes go first so none can be exchanged for new tokens in between
+		for _, query := range []string{queryDeleteAuthorizationCodesByUser, queryDeleteAccessTokensByUser, queryDeleteRefreshTokensByUser} {
+			if _, err := db.Exec(query, userId); err != nil {
+				return rest_errors.NewInternalServerError("db error")
+			}
+		}
+		return nil
+	})
+}
+
+func (r *accessTokenRepository) UpdateExpirationTime(id string, expires int64) rest_errors.RestErr {
+	if _, err := r.db.Exec(queryUpdateExpires, expires, domain.HashAccessToken(id)); err != nil {
+		return rest_errors.NewInternalServerError("db error")
+	}
+	return nil
+}
+
+func (r *accessTokenRepository) CreateWithRefreshToken(at domain.AccessToken, rt domain.RefreshToken, events ...domain.OAuthEvent) rest_errors.RestErr {
+	return inTransaction(r.db, events, func(db execer) rest_errors.RestErr {
+		if _, err := db.Exec(queryCreateAccessToken, domain.HashAccessToken(at.AccessToken), at.UserId, at.UserRole, at.ClientId, domain.FormatScopes(at.Scopes), at.Expires, at.IssuedAt); err != nil {
+			return rest_errors.NewInternalServerError("db error")
+		}
+		if _, err := db.Exec(queryCreateRefreshToken, domain.HashAccessToken(rt.RefreshToken), rt.FamilyId, domain.HashAccessToken(rt.AccessToken), rt.UserId, rt.UserRole, rt.ClientId, domain.FormatScopes(rt.Scopes), rt.Expires); err != nil {
+			return rest_errors.NewInternalServerError("db error")
+		}
+		return nil
+	})
+}
+
+func (r *accessTokenRepository) GetRefreshToken(token string) (*domain.RefreshToken, rest_errors.RestErr) {
+	var rt domain.RefreshToken
+	var scopes string
+	result := r.db.QueryRow(queryGetRefreshToken, domain.HashAccessToken(token))
+	if err := result.Scan(&rt.RefreshToken, &rt.FamilyId, &rt.AccessToken, &rt.UserId, &rt.UserRole, &rt.ClientId, &scopes, &rt.Expires, &rt.Used); err != nil {
+		if isNoRows(err) {
+			return nil, rest_errors.NewNotFoundError("refresh_token not found")
+		}
+		return nil, rest_errors.NewInternalServerError("db error")
+	}
+	rt.RefreshToken = token
+	rt.Scopes = domain.ParseScopes(scopes)
+
+	return &rt, nil
+}
+
+func (r *accessTokenRepository) UseRefreshToken(token string) rest_errors.RestErr {
+	return r.useOnce(queryUseRefreshToken, domain.HashAccessToken(token), "refresh_token already used")
+}
+
+func (r *accessTokenRepository) RevokeRefreshTokenFamily(familyId string, events ...domain.OAuthEvent) rest_errors.RestErr {
+	return withEvents(r.db, events, func(db execer) rest_errors.RestErr {
+		for _, query := range []string{queryDeleteAccessTokenByFamily, queryDeleteRefreshTokenByFamily} {
+			if _, err := db.Exec(query, familyId); err != nil {
+				return rest_errors.NewInternalServerError("db error")
+			}
+		}
+		return nil
+	})
+}
+
+func (r *accessTokenRepository) CreateAuthorizationCode(ac domain.AuthorizationCode) rest_errors.RestErr {
+	if _, err := r.db.Exec(queryCreateAuthorizationCode, ac.Code, ac.FamilyId, ac.ClientId, ac.RedirectUri, ac.Scope, ac.Nonce, ac.CodeChallenge, ac.CodeChallengeMethod, ac.UserId, ac.UserRole, ac.Expires); err != nil {
+		return rest_errors.NewInternalServerError("db error")
+	}
+	return nil
+}
+
+func (r *accessTokenRepository) GetAuthorizationCode(code string) (*domain.AuthorizationCode, rest_errors.RestErr) {
+	var ac domain.AuthorizationCode
+	result := r.db.QueryRow(queryGetAuthorizationCode, code)
+	if err := result.Scan(&ac.Code, &ac.FamilyId, &ac.ClientId, &ac.RedirectUri, &ac.Scope, &ac.Nonce, &ac.CodeChallenge, &ac.CodeChallengeMethod, &ac.UserId, &ac.UserRole, &ac.Expires, &ac.Used); err != nil {
+		if isNoRows(err) {
+			return nil, rest_errors.NewNotFoundError("authorization_code not found")
+		}
+		return nil, rest_errors.NewInternalServerError("db error")
+	}
+
+	return &ac, nil
+}
+
+func (r *accessTokenRepository) UseAuthorizationCode(code string) rest_errors.RestErr {
+	return r.useOnce(queryUseAuthorizationCode, code, "authorization_code already used")
+}
+
+// useOnce runs a conditional update, only one caller can succeed and the
+// rest get a conflict
+func (r *accessTokenRepository) useOnce(query string, id string, message string) rest_errors.RestErr {
+	result, err := r.db.Exec(query, id)
+	if err != nil {
+		return rest_errors.NewInternalServerError("db error")
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return rest_errors.NewInternalServerError("db error")
+	}
+	if rows == 0 {
+		return rest_errors.NewRestError(message, http.StatusConflict, "conflict")
+	}
+	return nil
+}
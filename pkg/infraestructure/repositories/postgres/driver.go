@@ -0,0 +1,8 @@
+//go:build postgres
+// +build postgres
+
+package postgres
+
+import (
+	_ "github.com/lib/pq"
+)
@@ -0,0 +1,152 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+)
+
+// relayLockKey is the session advisory lock held by the replica relaying
+// the outbox, it's released by the server when the connection holding it
+// goes away
+const relayLockKey = 7354290187
+
+type outboxRepository struct {
+	db *sql.DB
+
+	mu sync.Mutex
+	// conn holds the lock while this replica is the leader
+	conn *sql.Conn
+}
+
+func NewOutboxRepository(db *sql.DB) ports.OutboxRepository {
+	return &outboxRepository{
+		db: db,
+	}
+}
+
+const (
+	queryGetPendingOutboxEvents = "SELECT id, type, payload, occurred_at FROM oauth_outbox WHERE published_at IS NULL ORDER BY seq LIMIT $1;"
+
+	queryMarkOutboxEventsPublished = "UPDATE oauth_outbox SET published_at=$1 WHERE id IN (%s);"
+
+	queryPurgePublishedOutboxEvents = "DELETE FROM oauth_outbox WHERE seq IN (SELECT seq FROM oauth_outbox WHERE published_at<$1 LIMIT $2);"
+
+	queryGetRelayLock     = "SELECT pg_try_advisory_lock($1);"
+	queryReleaseRelayLock = "SELECT pg_advisory_unlock($1);"
+)
+
+func (r *outboxRepository) Pending(limit int) ([]domain.OAuthEvent, rest_errors.RestErr) {
+	rows, err := r.db.Query(queryGetPendingOutboxEvents, limit)
+	if err != nil {
+		return nil, rest_errors.NewInternalServerError("db error")
+	}
+	defer rows.Close()
+
+	events := []domain.OAuthEvent{}
+	for rows.Next() {
+		var event domain.OAuthEvent
+		var payload string
+		var occurredAt int64
+		if err := rows.Scan(&event.Id, &event.Type, &payload, &occurredAt); err != nil {
+			return nil, rest_errors.NewInternalServerError("db error")
+		}
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			return nil, rest_errors.NewInternalServerError("invalid outbox event payload")
+		}
+		event.OccurredAt = time.Unix(occurredAt, 0).UTC()
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, rest_errors.NewInternalServerError("db error")
+	}
+
+	return events, nil
+}
+
+func (r *outboxRepository) MarkPublished(ids []string) rest_errors.RestErr {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	args := []interface{}{time.Now().UTC().Unix()}
+	placeholders := []string{}
+	for _, id := range ids {
+		args = append(args, id)
+		placeholders = append(placeholders, "$"+strconv.Itoa(len(args)))
+	}
+
+	query := strings.Replace(queryMarkOutboxEventsPublished, "%s", strings.Join(placeholders, ", "), 1)
+	if _, err := r.db.Exec(query, args...); err != nil {
+		return rest_errors.NewInternalServerError("db error")
+	}
+	return nil
+}
+
+func (r *outboxRepository) PurgePublished(before time.Time, limit int) (int64, rest_errors.RestErr) {
+	result, err := r.db.Exec(queryPurgePublishedOutboxEvents, before.UTC().Unix(), limit)
+	if err != nil {
+		return 0, rest_errors.NewInternalServerError("db error")
+	}
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, rest_errors.NewInternalServerError("db error")
+	}
+	return purged, nil
+}
+
+func (r *outboxRepository) Lead() (bool, rest_errors.RestErr) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ctx := context.Background()
+	if r.conn != nil {
+		if err := r.conn.PingContext(ctx); err == nil {
+			return true, nil
+		}
+		r.conn.Close()
+		r.conn = nil
+	}
+
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return false, rest_errors.NewInternalServerError("db error")
+	}
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, queryGetRelayLock, relayLockKey).Scan(&locked); err != nil {
+		conn.Close()
+		return false, rest_errors.NewInternalServerError("db error")
+	}
+	if !locked {
+		conn.Close()
+		return false, nil
+	}
+
+	r.conn = conn
+	return true, nil
+}
+
+func (r *outboxRepository) Resign() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conn == nil {
+		return
+	}
+	var released bool
+	if err := r.conn.QueryRowContext(context.Background(), queryReleaseRelayLock, relayLockKey).Scan(&released); err != nil {
+		log.Printf("error while releasing relay lock: %v", err)
+	}
+	r.conn.Close()
+	r.conn = nil
+}
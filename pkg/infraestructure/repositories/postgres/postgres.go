@@ -0,0 +1,78 @@
+// Package postgres stores tokens and users in PostgreSQL. The driver isn't
+// linked by default: build with -tags postgres to register lib/pq.
+package postgres
+
+import (
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+)
+
+// Schema creates the tables the repositories of this package use, it can
+// be run more than once
+//
+//go:embed schema.sql
+var Schema string
+
+// errUniqueViolation is the SQLSTATE of a unique key violation
+const errUniqueViolation = "23505"
+
+// isUniqueViolation doesn't depend on the driver, both lib/pq and pgx
+// errors tell their SQLSTATE
+func isUniqueViolation(err error) bool {
+	var pgErr interface{ SQLState() string }
+	return errors.As(err, &pgErr) && pgErr.SQLState() == errUniqueViolation
+}
+
+func isNoRows(err error) bool {
+	return errors.Is(err, sql.ErrNoRows)
+}
+
+const queryInsertOutboxEvent = "INSERT INTO oauth_outbox(id, type, payload, occurred_at) VALUES ($1, $2, $3, $4);"
+
+// execer runs statements either on their own or as part of a transaction
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// withEvents runs write and adds events to the outbox in one transaction,
+// the same way the MySQL repositories do
+func withEvents(db *sql.DB, events []domain.OAuthEvent, write func(execer) rest_errors.RestErr) rest_errors.RestErr {
+	if len(events) == 0 {
+		return write(db)
+	}
+	return inTransaction(db, events, write)
+}
+
+// inTransaction is withEvents for writes of more than one statement, they
+// are wrapped in a transaction even without events
+func inTransaction(db *sql.DB, events []domain.OAuthEvent, write func(execer) rest_errors.RestErr) rest_errors.RestErr {
+	tx, err := db.Begin()
+	if err != nil {
+		return rest_errors.NewInternalServerError("db error")
+	}
+	defer tx.Rollback()
+
+	if err := write(tx); err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return rest_errors.NewInternalServerError("invalid outbox event payload")
+		}
+		if _, err := tx.Exec(queryInsertOutboxEvent, event.Id, event.Type, string(payload), event.OccurredAt.Unix()); err != nil {
+			return rest_errors.NewInternalServerError("db error")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return rest_errors.NewInternalServerError("db error")
+	}
+	return nil
+}
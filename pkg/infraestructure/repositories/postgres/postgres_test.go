@@ -0,0 +1,53 @@
+//go:build postgres
+// +build postgres
+
+package postgres
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/infraestructure/repositories/conformance"
+)
+
+// openTestDB connects to OAUTH_TEST_POSTGRES_DSN and empties every table,
+// the suite runs with go test -tags postgres and is skipped when the dsn
+// isn't set
+func openTestDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("OAUTH_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("OAUTH_TEST_POSTGRES_DSN not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("opening db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(Schema); err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+	if _, err := db.Exec("TRUNCATE access_tokens, refresh_tokens, authorization_codes, users, user_events, user_versions, oauth_outbox;"); err != nil {
+		t.Fatalf("truncating tables: %v", err)
+	}
+	return db
+}
+
+func TestAccessTokenRepository(t *testing.T) {
+	conformance.AccessTokenRepository(t, func(t *testing.T) conformance.TokenRepositories {
+		db := openTestDB(t)
+		return conformance.TokenRepositories{
+			AccessTokens: NewAccessTokenRepository(db),
+			Outbox:       NewOutboxRepository(db),
+		}
+	})
+}
+
+func TestUsersRepository(t *testing.T) {
+	conformance.UsersRepository(t, func(t *testing.T) ports.UsersRepository {
+		return NewUsersRepository(openTestDB(t))
+	})
+}
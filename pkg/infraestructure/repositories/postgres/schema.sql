@@ -0,0 +1,73 @@
+CREATE TABLE IF NOT EXISTS access_tokens (
+  access_token varchar(255) PRIMARY KEY,
+  user_id bigint NOT NULL,
+  user_role varchar(255) NOT NULL,
+  client_id varchar(255) NOT NULL DEFAULT '',
+  scopes varchar(1024) NOT NULL DEFAULT '',
+  expires bigint NOT NULL,
+  issued_at bigint NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS access_tokens_user_id ON access_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+  refresh_token varchar(255) PRIMARY KEY,
+  family_id varchar(255) NOT NULL,
+  access_token varchar(255) NOT NULL,
+  user_id bigint NOT NULL,
+  user_role varchar(255) NOT NULL,
+  client_id varchar(255) NOT NULL DEFAULT '',
+  scopes varchar(1024) NOT NULL DEFAULT '',
+  expires bigint NOT NULL,
+  used boolean NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id ON refresh_tokens (family_id);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_user_id ON refresh_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS authorization_codes (
+  code varchar(255) PRIMARY KEY,
+  family_id varchar(255) NOT NULL DEFAULT '',
+  client_id varchar(255) NOT NULL,
+  redirect_uri varchar(2048) NOT NULL,
+  scope varchar(1024) NOT NULL DEFAULT '',
+  nonce varchar(255) NOT NULL DEFAULT '',
+  code_challenge varchar(255) NOT NULL,
+  code_challenge_method varchar(16) NOT NULL,
+  user_id bigint NOT NULL,
+  user_role varchar(255) NOT NULL,
+  expires bigint NOT NULL,
+  used boolean NOT NULL DEFAULT false
+);
+
+CREATE TABLE IF NOT EXISTS users (
+  id bigint PRIMARY KEY,
+  email varchar(255) NOT NULL UNIQUE,
+  password varchar(255) NOT NULL,
+  role varchar(255) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_events (
+  event_id varchar(255) PRIMARY KEY,
+  user_id bigint NOT NULL,
+  processed_at bigint NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS user_events_processed_at ON user_events (processed_at);
+
+CREATE TABLE IF NOT EXISTS user_versions (
+  user_id bigint PRIMARY KEY,
+  version bigint NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS oauth_outbox (
+  seq bigserial PRIMARY KEY,
+  id varchar(255) NOT NULL UNIQUE,
+  type varchar(255) NOT NULL,
+  payload text NOT NULL,
+  occurred_at bigint NOT NULL,
+  published_at bigint
+);
+
+CREATE INDEX IF NOT EXISTS oauth_outbox_pending ON oauth_outbox (published_at, seq);
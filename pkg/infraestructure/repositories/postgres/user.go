@@ -0,0 +1,161 @@
+package postgres
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+)
+
+type usersRepository struct {
+	db *sql.DB
+}
+
+func NewUsersRepository(db *sql.DB) ports.UsersRepository {
+	return &usersRepository{
+		db: db,
+	}
+}
+
+const (
+	queryGetUserByEmail = "SELECT id, email, role, password FROM users WHERE email=$1;"
+	queryGetUserById    = "SELECT id, email, role, password FROM users WHERE id=$1;"
+	queryInsertUser     = "INSERT INTO users(id, email, password, role) VALUES($1, $2, $3, $4);"
+	queryDeleteUser     = "DELETE FROM users WHERE id=$1;"
+
+	queryUpsertUser = "INSERT INTO users(id, email, password, role) VALUES($1, $2, $3, $4) ON CONFLICT (id) DO UPDATE SET email=EXCLUDED.email, password=EXCLUDED.password, role=EXCLUDED.role;"
+
+	queryInsertUserEvent      = "INSERT INTO user_events(event_id, user_id, processed_at) VALUES($1, $2, $3) ON CONFLICT DO NOTHING;"
+	queryGetUserVersion       = "SELECT version FROM user_versions WHERE user_id=$1 FOR UPDATE;"
+	queryUpsertUserVersion    = "INSERT INTO user_versions(user_id, version) VALUES($1, $2) ON CONFLICT (user_id) DO UPDATE SET version=EXCLUDED.version;"
+	queryGetUserByIdForUpdate = "SELECT id, email, role, password FROM users WHERE id=$1 FOR UPDATE;"
+)
+
+func (r *usersRepository) GetByEmail(email string) (*domain.User, rest_errors.RestErr) {
+	return r.get(queryGetUserByEmail, email)
+}
+
+func (r *usersRepository) GetById(id int64) (*domain.User, rest_errors.RestErr) {
+	return r.get(queryGetUserById, id)
+}
+
+func (r *usersRepository) get(query string, arg interface{}) (*domain.User, rest_errors.RestErr) {
+	var user domain.User
+	result := r.db.QueryRow(query, arg)
+	if err := result.Scan(&user.Id, &user.Email, &user.Role, &user.Password); err != nil {
+		if isNoRows(err) {
+			return nil, rest_errors.NewNotFoundError("user not found")
+		}
+		return nil, rest_errors.NewInternalServerError("db error")
+	}
+	return &user, nil
+}
+
+func (r *usersRepository) Save(user *domain.User) rest_errors.RestErr {
+	if _, err := r.db.Exec(queryInsertUser, user.Id, user.Email, user.Password, user.Role); err != nil {
+		if isUniqueViolation(err) {
+			return rest_errors.NewRestError("email already in user", http.StatusConflict, "conflict")
+		}
+		return rest_errors.NewInternalServerError("db error")
+	}
+	return nil
+}
+
+func (r *usersRepository) Update(user *domain.User) rest_errors.RestErr {
+	return updateUser(r.db, user)
+}
+
+func (r *usersRepository) Delete(id int64) rest_errors.RestErr {
+	return deleteUser(r.db, id)
+}
+
+func updateUser(db execer, user *domain.User) rest_errors.RestErr {
+	if _, err := db.Exec(queryUpsertUser, user.Id, user.Email, user.Password, user.Role); err != nil {
+		if isUniqueViolation(err) {
+			return rest_errors.NewRestError("email already in user", http.StatusConflict, "conflict")
+		}
+		return rest_errors.NewInternalServerError("db error")
+	}
+	return nil
+}
+
+func deleteUser(db execer, id int64) rest_errors.RestErr {
+	if _, err := db.Exec(queryDeleteUser, id); err != nil {
+		return rest_errors.NewInternalServerError("db error")
+	}
+	return nil
+}
+
+// Apply works the same way as the MySQL one, a duplicated event id inserts
+// nothing instead of failing since an error would abort the transaction
+func (r *usersRepository) Apply(event *domain.UserEvent, then func(*domain.UserEventResult) rest_errors.RestErr) (*domain.UserEventResult, rest_errors.RestErr) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, rest_errors.NewInternalServerError("db error")
+	}
+	defer tx.Rollback()
+
+	userId := event.User.Id
+	if event.Id != "" {
+		result, err := tx.Exec(queryInsertUserEvent, event.Id, userId, time.Now().UTC().Unix())
+		if err != nil {
+			return nil, rest_errors.NewInternalServerError("db error")
+		}
+		if rows, err := result.RowsAffected(); err != nil {
+			return nil, rest_errors.NewInternalServerError("db error")
+		} else if rows == 0 {
+			return &domain.UserEventResult{Applied: false}, nil
+		}
+	}
+
+	if event.UserVersion > 0 {
+		var version int64
+		if err := tx.QueryRow(queryGetUserVersion, userId).Scan(&version); err != nil && !isNoRows(err) {
+			return nil, rest_errors.NewInternalServerError("db error")
+		}
+		if event.UserVersion <= version {
+			if err := tx.Commit(); err != nil {
+				return nil, rest_errors.NewInternalServerError("db error")
+			}
+			return &domain.UserEventResult{Applied: false}, nil
+		}
+		if _, err := tx.Exec(queryUpsertUserVersion, userId, event.UserVersion); err != nil {
+			return nil, rest_errors.NewInternalServerError("db error")
+		}
+	}
+
+	result := domain.UserEventResult{Applied: true}
+	var previous domain.User
+	err = tx.QueryRow(queryGetUserByIdForUpdate, userId).Scan(&previous.Id, &previous.Email, &previous.Role, &previous.Password)
+	switch {
+	case err == nil:
+		result.Previous = &previous
+	case !isNoRows(err):
+		return nil, rest_errors.NewInternalServerError("db error")
+	}
+
+	var restErr rest_errors.RestErr
+	switch event.Type {
+	case domain.UserEventDelete:
+		restErr = deleteUser(tx, userId)
+	default:
+		restErr = updateUser(tx, &event.User)
+	}
+	if restErr != nil {
+		return nil, restErr
+	}
+
+	if then != nil {
+		if err := then(&result); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, rest_errors.NewInternalServerError("db error")
+	}
+	return &result, nil
+}
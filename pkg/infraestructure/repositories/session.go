@@ -0,0 +1,119 @@
+package repositories
+
+import (
+	"database/sql"
+	"strings"
+	"sync"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+)
+
+var (
+	onceSessionRepo     sync.Once
+	instanceSessionRepo *sessionRepository
+)
+
+type sessionRepository struct {
+	db *sql.DB
+}
+
+func NewSessionRepository(db *sql.DB) ports.SessionRepository {
+	onceSessionRepo.Do(func() {
+		instanceSessionRepo = &sessionRepository{
+			db: db,
+		}
+	})
+	return instanceSessionRepo
+}
+
+const (
+	queryCreateSession = "INSERT INTO sessions(id, user_id, client_id, user_agent, ip, created_at, last_used_at) VALUES (?, ?, ?, ?, ?, ?, ?);"
+
+	queryGetSession = "SELECT id, user_id, client_id, user_agent, ip, created_at, last_used_at FROM sessions WHERE id=?;"
+
+	queryGetSessionsByUser = "SELECT id, user_id, client_id, user_agent, ip, created_at, last_used_at FROM sessions WHERE user_id=? ORDER BY created_at;"
+
+	queryTouchSession = "UPDATE sessions SET last_used_at=? WHERE id=?;"
+
+	queryDeleteSession = "DELETE FROM sessions WHERE id=?;"
+
+	queryDeleteSessionsByUser = "DELETE FROM sessions WHERE user_id=?;"
+)
+
+func (r *sessionRepository) Create(s domain.Session) rest_errors.RestErr {
+	stmt, err := r.db.Prepare(queryCreateSession)
+	if err != nil {
+		return rest_errors.NewInternalServerError("db error")
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.Exec(s.Id, s.UserId, s.ClientId, s.UserAgent, s.Ip, s.CreatedAt, s.LastUsedAt); err != nil {
+		return rest_errors.NewInternalServerError("db error")
+	}
+	return nil
+}
+
+func (r *sessionRepository) GetById(id string) (*domain.Session, rest_errors.RestErr) {
+	stmt, err := r.db.Prepare(queryGetSession)
+	if err != nil {
+		return nil, rest_errors.NewInternalServerError("db error")
+	}
+	defer stmt.Close()
+
+	var s domain.Session
+	result := stmt.QueryRow(id)
+	if err := result.Scan(&s.Id, &s.UserId, &s.ClientId, &s.UserAgent, &s.Ip, &s.CreatedAt, &s.LastUsedAt); err != nil {
+		if strings.Contains(err.Error(), errNoRow) {
+			return nil, rest_errors.NewNotFoundError("session not found")
+		}
+		return nil, rest_errors.NewInternalServerError("db error")
+	}
+	return &s, nil
+}
+
+func (r *sessionRepository) GetByUser(userId int64) ([]domain.Session, rest_errors.RestErr) {
+	rows, err := r.db.Query(queryGetSessionsByUser, userId)
+	if err != nil {
+		return nil, rest_errors.NewInternalServerError("db error")
+	}
+	defer rows.Close()
+
+	sessions := make([]domain.Session, 0)
+	for rows.Next() {
+		var s domain.Session
+		if err := rows.Scan(&s.Id, &s.UserId, &s.ClientId, &s.UserAgent, &s.Ip, &s.CreatedAt, &s.LastUsedAt); err != nil {
+			return nil, rest_errors.NewInternalServerError("db error")
+		}
+		sessions = append(sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, rest_errors.NewInternalServerError("db error")
+	}
+
+	return sessions, nil
+}
+
+// Touch records that the session was just used, sessions that don't exist
+// are ignored since they predate session tracking
+func (r *sessionRepository) Touch(id string, at int64) rest_errors.RestErr {
+	if _, err := r.db.Exec(queryTouchSession, at, id); err != nil {
+		return rest_errors.NewInternalServerError("db error")
+	}
+	return nil
+}
+
+func (r *sessionRepository) Delete(id string) rest_errors.RestErr {
+	if _, err := r.db.Exec(queryDeleteSession, id); err != nil {
+		return rest_errors.NewInternalServerError("db error")
+	}
+	return nil
+}
+
+func (r *sessionRepository) DeleteByUser(userId int64) rest_errors.RestErr {
+	if _, err := r.db.Exec(queryDeleteSessionsByUser, userId); err != nil {
+		return rest_errors.NewInternalServerError("db error")
+	}
+	return nil
+}
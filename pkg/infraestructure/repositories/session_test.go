@@ -0,0 +1,107 @@
+package repositories
+
+import (
+	"database/sql"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+var sessionTest = domain.Session{
+	Id:         "c3e9d6b2-8f4a-4e1b-a7c5-0d2f9b6e4a33",
+	UserId:     1,
+	UserAgent:  "Mozilla/5.0 (iPhone; CPU iPhone OS 15_0 like Mac OS X)",
+	Ip:         "203.0.113.7",
+	CreatedAt:  1637337544,
+	LastUsedAt: 1637337544,
+}
+
+func TestCreateSession(t *testing.T) {
+	query := regexp.QuoteMeta(queryCreateSession)
+
+	db, mock := NewMock()
+	mock.ExpectPrepare(query).ExpectExec().WithArgs(sessionTest.Id, sessionTest.UserId, "", sessionTest.UserAgent, sessionTest.Ip, sessionTest.CreatedAt, sessionTest.LastUsedAt).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	sRepo := sessionRepository{db: db}
+	err := sRepo.Create(sessionTest)
+
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGetSessionById(t *testing.T) {
+	query := regexp.QuoteMeta(queryGetSession)
+
+	t.Run("NoError", func(t *testing.T) {
+		db, mock := NewMock()
+		row := mock.NewRows([]string{"id", "user_id", "client_id", "user_agent", "ip", "created_at", "last_used_at"}).
+			AddRow(sessionTest.Id, 1, "", sessionTest.UserAgent, sessionTest.Ip, 1637337544, 1637510344)
+		mock.ExpectPrepare(query).ExpectQuery().WithArgs(sessionTest.Id).WillReturnRows(row)
+
+		sRepo := sessionRepository{db: db}
+		s, err := sRepo.GetById(sessionTest.Id)
+
+		assert.Nil(t, err)
+		assert.NotNil(t, s)
+		assert.EqualValues(t, 1, s.UserId)
+		assert.EqualValues(t, 1637510344, s.LastUsedAt)
+	})
+
+	t.Run("ErrorNoRows", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectPrepare(query).ExpectQuery().WillReturnError(sql.ErrNoRows)
+
+		sRepo := sessionRepository{db: db}
+		s, err := sRepo.GetById(sessionTest.Id)
+
+		assert.Nil(t, s)
+		assert.NotNil(t, err)
+		assert.EqualValues(t, http.StatusNotFound, err.Status())
+	})
+}
+
+func TestGetSessionsByUser(t *testing.T) {
+	query := regexp.QuoteMeta(queryGetSessionsByUser)
+
+	db, mock := NewMock()
+	rows := mock.NewRows([]string{"id", "user_id", "client_id", "user_agent", "ip", "created_at", "last_used_at"}).
+		AddRow("6f1c1f4e-5d0a-4c8e-9d7a-2b8e0f3c1a11", 1, "", "curl/7.79.1", "198.51.100.2", 1637337000, 1637337000).
+		AddRow(sessionTest.Id, 1, "spa", sessionTest.UserAgent, sessionTest.Ip, 1637337544, 1637510344)
+	mock.ExpectQuery(query).WithArgs(1).WillReturnRows(rows)
+
+	sRepo := sessionRepository{db: db}
+	sessions, err := sRepo.GetByUser(1)
+
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 2)
+	assert.EqualValues(t, "spa", sessions[1].ClientId)
+}
+
+func TestDeleteSession(t *testing.T) {
+	query := regexp.QuoteMeta(queryDeleteSession)
+
+	t.Run("NoError", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectExec(query).WithArgs(sessionTest.Id).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		sRepo := sessionRepository{db: db}
+		err := sRepo.Delete(sessionTest.Id)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("ErrorDeleting", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectExec(query).WithArgs(sessionTest.Id).WillReturnError(sql.ErrConnDone)
+
+		sRepo := sessionRepository{db: db}
+		err := sRepo.Delete(sessionTest.Id)
+
+		assert.NotNil(t, err)
+		assert.EqualValues(t, http.StatusInternalServerError, err.Status())
+	})
+}
@@ -0,0 +1,88 @@
+package repositories
+
+import (
+	"database/sql"
+	"net/http"
+	"sync"
+
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+)
+
+var (
+	onceSigningKeyRepo     sync.Once
+	instanceSigningKeyRepo *signingKeyRepository
+)
+
+type signingKeyRepository struct {
+	db *sql.DB
+}
+
+func NewSigningKeyRepository(db *sql.DB) ports.SigningKeyRepository {
+	onceSigningKeyRepo.Do(func() {
+		instanceSigningKeyRepo = &signingKeyRepository{
+			db: db,
+		}
+	})
+	return instanceSigningKeyRepo
+}
+
+const (
+	queryCreateSigningKey = "INSERT INTO signing_keys(kid, algorithm, private_key, state, created_at, state_changed_at) VALUES (?, ?, ?, ?, ?, ?);"
+
+	queryGetSigningKeys = "SELECT kid, algorithm, private_key, state, created_at, state_changed_at FROM signing_keys WHERE state<>'retired' ORDER BY created_at;"
+
+	queryUpdateSigningKeyState = "UPDATE signing_keys SET state=?, state_changed_at=? WHERE kid=? AND state=?;"
+)
+
+func (r *signingKeyRepository) Create(key domain.SigningKey) rest_errors.RestErr {
+	stmt, err := r.db.Prepare(queryCreateSigningKey)
+	if err != nil {
+		return rest_errors.NewInternalServerError("db error")
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.Exec(key.Kid, key.Algorithm, key.PrivateKey, key.State, key.CreatedAt, key.StateChangedAt); err != nil {
+		return rest_errors.NewInternalServerError("db error")
+	}
+	return nil
+}
+
+func (r *signingKeyRepository) GetAll() ([]domain.SigningKey, rest_errors.RestErr) {
+	rows, err := r.db.Query(queryGetSigningKeys)
+	if err != nil {
+		return nil, rest_errors.NewInternalServerError("db error")
+	}
+	defer rows.Close()
+
+	keys := make([]domain.SigningKey, 0)
+	for rows.Next() {
+		var key domain.SigningKey
+		if err := rows.Scan(&key.Kid, &key.Algorithm, &key.PrivateKey, &key.State, &key.CreatedAt, &key.StateChangedAt); err != nil {
+			return nil, rest_errors.NewInternalServerError("db error")
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, rest_errors.NewInternalServerError("db error")
+	}
+
+	return keys, nil
+}
+
+func (r *signingKeyRepository) UpdateState(kid string, from string, to string, at int64) rest_errors.RestErr {
+	result, err := r.db.Exec(queryUpdateSigningKeyState, to, at, kid, from)
+	if err != nil {
+		return rest_errors.NewInternalServerError("db error")
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return rest_errors.NewInternalServerError("db error")
+	}
+	if rows == 0 {
+		return rest_errors.NewRestError("signing key state changed", http.StatusConflict, "conflict")
+	}
+	return nil
+}
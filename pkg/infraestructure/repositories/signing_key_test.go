@@ -0,0 +1,53 @@
+package repositories
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAllSigningKeys(t *testing.T) {
+	query := regexp.QuoteMeta(queryGetSigningKeys)
+
+	db, mock := NewMock()
+	rows := mock.NewRows([]string{"kid", "algorithm", "private_key", "state", "created_at", "state_changed_at"}).
+		AddRow("kid-1", "RS256", "pem", domain.SigningKeyRetiring, 1637337544, 1637510344).
+		AddRow("kid-2", "RS256", "pem", domain.SigningKeyActive, 1637337544, 1637510344)
+	mock.ExpectQuery(query).WillReturnRows(rows)
+
+	kRepo := signingKeyRepository{db: db}
+	keys, err := kRepo.GetAll()
+
+	assert.Nil(t, err)
+	assert.Len(t, keys, 2)
+	assert.EqualValues(t, domain.SigningKeyActive, keys[1].State)
+}
+
+func TestUpdateSigningKeyState(t *testing.T) {
+	query := regexp.QuoteMeta(queryUpdateSigningKeyState)
+
+	t.Run("NoError", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectExec(query).WithArgs(domain.SigningKeyRetiring, 1637510344, "kid-1", domain.SigningKeyActive).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		kRepo := signingKeyRepository{db: db}
+		err := kRepo.UpdateState("kid-1", domain.SigningKeyActive, domain.SigningKeyRetiring, 1637510344)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("ErrorStateChanged", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectExec(query).WithArgs(domain.SigningKeyRetiring, 1637510344, "kid-1", domain.SigningKeyActive).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		kRepo := signingKeyRepository{db: db}
+		err := kRepo.UpdateState("kid-1", domain.SigningKeyActive, domain.SigningKeyRetiring, 1637510344)
+
+		assert.NotNil(t, err)
+		assert.EqualValues(t, http.StatusConflict, err.Status())
+	})
+}
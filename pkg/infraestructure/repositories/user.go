@@ -1,12 +1,11 @@
 package repositories
 
-// TODO: pulish implementation, add proper error handling and finish testing
-
 import (
 	"database/sql"
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
 	"github.com/FacuBar/bookstore_oauth-api/pkg/core/ports"
@@ -33,7 +32,16 @@ func NewUsersRepository(db *sql.DB) ports.UsersRepository {
 
 const (
 	queryGetUserByEmail = "SELECT id, email, role, password FROM users WHERE email=?;"
+	queryGetUserById    = "SELECT id, email, role, password FROM users WHERE id=?;"
 	queryInsertUser     = "INSERT INTO users(id, email, password, role) VALUES(?, ?, ?, ?);"
+	queryDeleteUser     = "DELETE FROM users WHERE id=?;"
+
+	queryUpsertUser = "INSERT INTO users(id, email, password, role) VALUES(?, ?, ?, ?) ON DUPLICATE KEY UPDATE email=VALUES(email), password=VALUES(password), role=VALUES(role);"
+
+	queryInsertUserEvent      = "INSERT INTO user_events(event_id, user_id, processed_at) VALUES(?, ?, ?);"
+	queryGetUserVersion       = "SELECT version FROM user_versions WHERE user_id=? FOR UPDATE;"
+	queryUpsertUserVersion    = "INSERT INTO user_versions(user_id, version) VALUES(?, ?) ON DUPLICATE KEY UPDATE version=VALUES(version);"
+	queryGetUserByIdForUpdate = "SELECT id, email, role, password FROM users WHERE id=? FOR UPDATE;"
 )
 
 const (
@@ -58,6 +66,24 @@ func (r *usersRepository) GetByEmail(email string) (*domain.User, rest_errors.Re
 	return &user, nil
 }
 
+func (r *usersRepository) GetById(id int64) (*domain.User, rest_errors.RestErr) {
+	stmt, err := r.db.Prepare(queryGetUserById)
+	if err != nil {
+		return nil, rest_errors.NewInternalServerError("db error")
+	}
+	defer stmt.Close()
+
+	var user domain.User
+	result := stmt.QueryRow(id)
+	if err := result.Scan(&user.Id, &user.Email, &user.Role, &user.Password); err != nil {
+		if strings.Contains(err.Error(), errNoRow) {
+			return nil, rest_errors.NewNotFoundError("user not found")
+		}
+		return nil, rest_errors.NewInternalServerError("db error")
+	}
+	return &user, nil
+}
+
 func (r *usersRepository) Save(user *domain.User) rest_errors.RestErr {
 	stmt, err := r.db.Prepare(queryInsertUser)
 	if err != nil {
@@ -67,7 +93,7 @@ func (r *usersRepository) Save(user *domain.User) rest_errors.RestErr {
 
 	insertResult, err := stmt.Exec(user.Id, user.Email, user.Password, user.Role)
 	if err != nil {
-		if strings.Contains(err.Error(), "Duplicate entry") {
+		if isDuplicateEntry(err) {
 			return rest_errors.NewRestError("email already in user", http.StatusConflict, "conflict")
 		}
 		return rest_errors.NewInternalServerError("db error")
@@ -80,3 +106,102 @@ func (r *usersRepository) Save(user *domain.User) rest_errors.RestErr {
 	user.Id = userId
 	return nil
 }
+
+func (r *usersRepository) Update(user *domain.User) rest_errors.RestErr {
+	return updateUser(r.db, user)
+}
+
+func (r *usersRepository) Delete(id int64) rest_errors.RestErr {
+	return deleteUser(r.db, id)
+}
+
+// updateUser and deleteUser take an execer so that Apply can run them in
+// its transaction
+func updateUser(db execer, user *domain.User) rest_errors.RestErr {
+	if _, err := db.Exec(queryUpsertUser, user.Id, user.Email, user.Password, user.Role); err != nil {
+		if isDuplicateEntry(err) {
+			return rest_errors.NewRestError("email already in user", http.StatusConflict, "conflict")
+		}
+		return rest_errors.NewInternalServerError("db error")
+	}
+	return nil
+}
+
+func deleteUser(db execer, id int64) rest_errors.RestErr {
+	if _, err := db.Exec(queryDeleteUser, id); err != nil {
+		return rest_errors.NewInternalServerError("db error")
+	}
+	return nil
+}
+
+// Apply records the event id and the version of the user in the same
+// transaction that applies the event, so a redelivered event finds its id
+// taken and an event that arrives late finds a newer version. Versions are
+// kept after a user is deleted, a late update can't bring it back. then
+// runs before the commit, so the event is only recorded once it succeeded.
+func (r *usersRepository) Apply(event *domain.UserEvent, then func(*domain.UserEventResult) rest_errors.RestErr) (*domain.UserEventResult, rest_errors.RestErr) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, rest_errors.NewInternalServerError("db error")
+	}
+	defer tx.Rollback()
+
+	userId := event.User.Id
+	if event.Id != "" {
+		if _, err := tx.Exec(queryInsertUserEvent, event.Id, userId, time.Now().UTC().Unix()); err != nil {
+			if isDuplicateEntry(err) {
+				return &domain.UserEventResult{Applied: false}, nil
+			}
+			return nil, rest_errors.NewInternalServerError("db error")
+		}
+	}
+
+	if event.UserVersion > 0 {
+		var version int64
+		if err := tx.QueryRow(queryGetUserVersion, userId).Scan(&version); err != nil && !strings.Contains(err.Error(), errNoRow) {
+			return nil, rest_errors.NewInternalServerError("db error")
+		}
+		if event.UserVersion <= version {
+			// the event id is still recorded, it's done with
+			if err := tx.Commit(); err != nil {
+				return nil, rest_errors.NewInternalServerError("db error")
+			}
+			return &domain.UserEventResult{Applied: false}, nil
+		}
+		if _, err := tx.Exec(queryUpsertUserVersion, userId, event.UserVersion); err != nil {
+			return nil, rest_errors.NewInternalServerError("db error")
+		}
+	}
+
+	result := domain.UserEventResult{Applied: true}
+	var previous domain.User
+	err = tx.QueryRow(queryGetUserByIdForUpdate, userId).Scan(&previous.Id, &previous.Email, &previous.Role, &previous.Password)
+	switch {
+	case err == nil:
+		result.Previous = &previous
+	case !strings.Contains(err.Error(), errNoRow):
+		return nil, rest_errors.NewInternalServerError("db error")
+	}
+
+	var restErr rest_errors.RestErr
+	switch event.Type {
+	case domain.UserEventDelete:
+		restErr = deleteUser(tx, userId)
+	default:
+		restErr = updateUser(tx, &event.User)
+	}
+	if restErr != nil {
+		return nil, restErr
+	}
+
+	if then != nil {
+		if err := then(&result); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, rest_errors.NewInternalServerError("db error")
+	}
+	return &result, nil
+}
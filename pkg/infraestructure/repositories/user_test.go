@@ -0,0 +1,220 @@
+package repositories
+
+import (
+	"database/sql"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/FacuBar/bookstore_oauth-api/pkg/core/domain"
+	"github.com/FacuBar/bookstore_utils-go/rest_errors"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+var userEventTest = domain.UserEvent{
+	Id:          "9b2d7c1e-4f6a-4b3e-8c5d-1a7e0f2b3c44",
+	Type:        domain.UserEventUpdate,
+	Version:     1,
+	UserVersion: 3,
+	User: domain.User{
+		Id:       1,
+		Email:    "user@email.com",
+		Password: "$2a$10$Wfn3zl3n/4iVw5nTl1q1kOYXo.LhJ6gKDo7x9eUv7g6Q6VbQ8vC3a",
+		Role:     "admin",
+	},
+}
+
+func TestApplyUserEvent(t *testing.T) {
+	insertEvent := regexp.QuoteMeta(queryInsertUserEvent)
+	getVersion := regexp.QuoteMeta(queryGetUserVersion)
+	upsertVersion := regexp.QuoteMeta(queryUpsertUserVersion)
+	getUser := regexp.QuoteMeta(queryGetUserByIdForUpdate)
+	upsertUser := regexp.QuoteMeta(queryUpsertUser)
+	deleteUser := regexp.QuoteMeta(queryDeleteUser)
+
+	t.Run("NoErrorUpdate", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectBegin()
+		mock.ExpectExec(insertEvent).WithArgs(userEventTest.Id, 1, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(getVersion).WithArgs(1).WillReturnRows(mock.NewRows([]string{"version"}).AddRow(2))
+		mock.ExpectExec(upsertVersion).WithArgs(1, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(getUser).WithArgs(1).WillReturnRows(mock.NewRows([]string{"id", "email", "role", "password"}).
+			AddRow(1, "user@email.com", "user", userEventTest.User.Password))
+		mock.ExpectExec(upsertUser).WithArgs(1, "user@email.com", userEventTest.User.Password, "admin").WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		uRepo := usersRepository{db: db}
+		result, err := uRepo.Apply(&userEventTest, nil)
+
+		assert.Nil(t, err)
+		assert.True(t, result.Applied)
+		assert.NotNil(t, result.Previous)
+		assert.EqualValues(t, "user", result.Previous.Role)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("NoErrorDeleteUnknownUser", func(t *testing.T) {
+		event := userEventTest
+		event.Type = domain.UserEventDelete
+
+		db, mock := NewMock()
+		mock.ExpectBegin()
+		mock.ExpectExec(insertEvent).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(getVersion).WithArgs(1).WillReturnError(sql.ErrNoRows)
+		mock.ExpectExec(upsertVersion).WithArgs(1, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(getUser).WithArgs(1).WillReturnError(sql.ErrNoRows)
+		mock.ExpectExec(deleteUser).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		uRepo := usersRepository{db: db}
+		result, err := uRepo.Apply(&event, nil)
+
+		assert.Nil(t, err)
+		assert.True(t, result.Applied)
+		assert.Nil(t, result.Previous)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("NoErrorLegacyEvent", func(t *testing.T) {
+		event := userEventTest
+		event.Id = ""
+		event.UserVersion = 0
+
+		db, mock := NewMock()
+		mock.ExpectBegin()
+		mock.ExpectQuery(getUser).WithArgs(1).WillReturnError(sql.ErrNoRows)
+		mock.ExpectExec(upsertUser).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		uRepo := usersRepository{db: db}
+		result, err := uRepo.Apply(&event, nil)
+
+		assert.Nil(t, err)
+		assert.True(t, result.Applied)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("DuplicatedEvent", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectBegin()
+		mock.ExpectExec(insertEvent).WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry '9b2d7c1e-4f6a-4b3e-8c5d-1a7e0f2b3c44' for key 'PRIMARY'"})
+		mock.ExpectRollback()
+
+		uRepo := usersRepository{db: db}
+		result, err := uRepo.Apply(&userEventTest, nil)
+
+		assert.Nil(t, err)
+		assert.False(t, result.Applied)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("StaleEvent", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectBegin()
+		mock.ExpectExec(insertEvent).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(getVersion).WithArgs(1).WillReturnRows(mock.NewRows([]string{"version"}).AddRow(3))
+		mock.ExpectCommit()
+
+		uRepo := usersRepository{db: db}
+		result, err := uRepo.Apply(&userEventTest, nil)
+
+		assert.Nil(t, err)
+		assert.False(t, result.Applied)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ErrorThen", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectBegin()
+		mock.ExpectExec(insertEvent).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(getVersion).WithArgs(1).WillReturnRows(mock.NewRows([]string{"version"}).AddRow(2))
+		mock.ExpectExec(upsertVersion).WithArgs(1, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(getUser).WithArgs(1).WillReturnError(sql.ErrNoRows)
+		mock.ExpectExec(upsertUser).WillReturnResult(sqlmock.NewResult(0, 1))
+		// the event id goes away with the rest, the event can be retried
+		mock.ExpectRollback()
+
+		uRepo := usersRepository{db: db}
+		result, err := uRepo.Apply(&userEventTest, func(*domain.UserEventResult) rest_errors.RestErr {
+			return rest_errors.NewInternalServerError("db error")
+		})
+
+		assert.Nil(t, result)
+		assert.NotNil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ErrorEmailTaken", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectBegin()
+		mock.ExpectExec(insertEvent).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(getVersion).WillReturnError(sql.ErrNoRows)
+		mock.ExpectExec(upsertVersion).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(getUser).WillReturnError(sql.ErrNoRows)
+		mock.ExpectExec(upsertUser).WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'user@email.com' for key 'email'"})
+		mock.ExpectRollback()
+
+		uRepo := usersRepository{db: db}
+		result, err := uRepo.Apply(&userEventTest, nil)
+
+		assert.Nil(t, result)
+		assert.NotNil(t, err)
+		assert.EqualValues(t, http.StatusConflict, err.Status())
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUpdateUser(t *testing.T) {
+	query := regexp.QuoteMeta(queryUpsertUser)
+	user := userEventTest.User
+
+	t.Run("NoError", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectExec(query).WithArgs(1, "user@email.com", user.Password, "admin").WillReturnResult(sqlmock.NewResult(0, 2))
+
+		uRepo := usersRepository{db: db}
+		err := uRepo.Update(&user)
+
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ErrorEmailTaken", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectExec(query).WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'user@email.com' for key 'email'"})
+
+		uRepo := usersRepository{db: db}
+		err := uRepo.Update(&user)
+
+		assert.NotNil(t, err)
+		assert.EqualValues(t, http.StatusConflict, err.Status())
+	})
+}
+
+func TestDeleteUser(t *testing.T) {
+	query := regexp.QuoteMeta(queryDeleteUser)
+
+	t.Run("NoError", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectExec(query).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		uRepo := usersRepository{db: db}
+		err := uRepo.Delete(1)
+
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		db, mock := NewMock()
+		mock.ExpectExec(query).WithArgs(1).WillReturnError(sql.ErrConnDone)
+
+		uRepo := usersRepository{db: db}
+		err := uRepo.Delete(1)
+
+		assert.NotNil(t, err)
+		assert.EqualValues(t, http.StatusInternalServerError, err.Status())
+	})
+}